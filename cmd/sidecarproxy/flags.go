@@ -0,0 +1,395 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"flag"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/v3io/sidecar-proxy/pkg/common"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/activityfilter"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/auth"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/errorpage"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/forwarded"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/headerrule"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metriclabels"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/pusher"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/reloader"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/tcproute"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/tracing"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+)
+
+// configurationFlags are the flags of the commands that load the configuration (serve, validate and probe)
+type configurationFlags struct {
+	metricNames               common.StringArrayFlag
+	ignoreRuleStrs            common.StringArrayFlag
+	headerRuleStrs            common.StringArrayFlag
+	tcpRouteStrs              common.StringArrayFlag
+	staticMetricLabels        common.StringArrayFlag
+	podLabelMetricLabels      common.StringArrayFlag
+	podAnnotationMetricLabels common.StringArrayFlag
+	renamedMetricLabels       common.StringArrayFlag
+	droppedMetricLabels       common.StringArrayFlag
+	pollIntervalStrs          common.StringArrayFlag
+	listenAddress             *string
+	adminListenAddress        *string
+	adminInsecure             *bool
+	debugEndpoints            *bool
+	forwardAddress            *string
+	namespace                 *string
+	serviceName               *string
+	instanceName              *string
+	logLevel                  *string
+	configFilePath            *string
+	configCheckInterval       *time.Duration
+	metricNamespace           *string
+	metricSubsystem           *string
+	podLabelsFilePath         *string
+	podAnnotationsFilePath    *string
+	sshConnectionFilePath     *string
+	codeServerHeartbeatFile   *string
+	rstudioSessionsDirPath    *string
+	rayDashboardAddress       *string
+	daskDashboardAddress      *string
+	upstreamMetricsURL        *string
+	upstreamMetricsFilter     *string
+	h2c                       *bool
+	upstreamH2C               *bool
+	proxyProtocol             *bool
+	trustedProxies            *string
+	errorPages                *bool
+	errorPagesDirPath         *string
+	errorPagesRetryAfter      *time.Duration
+	includeRuntimeMetrics     *bool
+	pushMode                  *string
+	pushURL                   *string
+	pushInterval              *time.Duration
+	pushJob                   *string
+	shutdownTimeout           *time.Duration
+	tracingEndpoint           *string
+	tracingURLPath            *string
+	tracingInsecure           *bool
+	tracingSampleRatio        *float64
+	upstreamAuthFlags         *authFlags
+	metricsAuthFlags          *authFlags
+	adminAuthFlags            *authFlags
+}
+
+// loadedConfiguration is what the configuration flags (and config file, if any) resolve to
+type loadedConfiguration struct {
+	server          sidecarproxy.Configuration
+	logLevel        logger.Level
+	tracing         tracing.Configuration
+	shutdownTimeout time.Duration
+
+	// watches the config file, nil if there isn't one
+	reloader *reloader.Reloader
+}
+
+func registerConfigurationFlags(flagSet *flag.FlagSet) *configurationFlags {
+	f := configurationFlags{}
+
+	f.listenAddress = flagSet.String("listen-addr", os.Getenv("PROXY_LISTEN_ADDRESS"), "Port to listen on")
+	f.adminListenAddress = flagSet.String("admin-listen-addr", os.Getenv("PROXY_ADMIN_LISTEN_ADDRESS"), "Address the admin endpoints (e.g. /status) are served on (disabled if empty)")
+	f.adminInsecure = flagSet.Bool("admin-insecure", getEnvBool("PROXY_ADMIN_INSECURE", false), "Serve the admin endpoints without authentication (refused otherwise)")
+	f.debugEndpoints = flagSet.Bool("debug-endpoints", getEnvBool("PROXY_DEBUG_ENDPOINTS", false), "Serve pprof, goroutine dump and GC stats endpoints on the admin listener")
+	f.h2c = flagSet.Bool("h2c", getEnvBool("PROXY_H2C", false), "Accept HTTP/2 without TLS (h2c), as gRPC clients send")
+	f.upstreamH2C = flagSet.Bool("upstream-h2c", getEnvBool("PROXY_UPSTREAM_H2C", false), "Forward all requests over HTTP/2 without TLS (h2c), rather than just gRPC ones")
+	f.proxyProtocol = flagSet.Bool("proxy-protocol", getEnvBool("PROXY_PROXY_PROTOCOL", false), "Read the client's address from PROXY protocol (v1 / v2) headers sent by a load balancer (one of --trusted-proxies)")
+	f.trustedProxies = flagSet.String("trusted-proxies", os.Getenv("PROXY_TRUSTED_PROXIES"), "Comma separated CIDRs of proxies whose X-Forwarded-For / Forwarded and PROXY protocol headers are trusted")
+	f.forwardAddress = flagSet.String("forward-addr", os.Getenv("PROXY_FORWARD_ADDRESS"), "IP /w port to forward to (without protocol)")
+	f.namespace = flagSet.String("namespace", os.Getenv("PROXY_NAMESPACE"), "Kubernetes namespace")
+	f.serviceName = flagSet.String("service-name", os.Getenv("PROXY_SERVICE_NAME"), "Service which the proxy serves")
+	f.instanceName = flagSet.String("instance-name", os.Getenv("PROXY_INSTANCE_NAME"), "Deployment instance name")
+	f.logLevel = flagSet.String("log-level", getEnvString("LOG_LEVEL", "info"), "Set proxy's log level (debug, info, warn, error)")
+	flagSet.Var(&f.metricNames, "metric-name", "Set which metrics to collect")
+	flagSet.Var(&f.pollIntervalStrs, "poll-interval", "Poll interval (metricName=duration) of a metrics handler that polls")
+	f.configFilePath = flagSet.String("config-file", os.Getenv("PROXY_CONFIG_FILE"), "YAML file (e.g. a mounted ConfigMap) with settings that are reloaded when it changes or on SIGHUP")
+	f.configCheckInterval = flagSet.Duration("config-check-interval", 10*time.Second, "Interval in which the config file is checked for changes")
+	f.metricNamespace = flagSet.String("metric-namespace", os.Getenv("PROXY_METRIC_NAMESPACE"), "Namespace prefixed to all metric names")
+	f.metricSubsystem = flagSet.String("metric-subsystem", os.Getenv("PROXY_METRIC_SUBSYSTEM"), "Subsystem prefixed to all metric names (after the namespace)")
+	flagSet.Var(&f.staticMetricLabels, "metric-label", "Extra label (name=value) added to all metrics")
+	flagSet.Var(&f.podLabelMetricLabels, "metric-label-from-pod-label", "Extra label (name=podLabelKey) added to all metrics, valued by a pod label")
+	flagSet.Var(&f.podAnnotationMetricLabels, "metric-label-from-pod-annotation", "Extra label (name=podAnnotationKey) added to all metrics, valued by a pod annotation")
+	f.podLabelsFilePath = flagSet.String("pod-labels-file", getEnvString("PROXY_POD_LABELS_FILE", "/etc/podinfo/labels"), "Downward API file holding the pod's labels")
+	f.podAnnotationsFilePath = flagSet.String("pod-annotations-file", getEnvString("PROXY_POD_ANNOTATIONS_FILE", "/etc/podinfo/annotations"), "Downward API file holding the pod's annotations")
+	flagSet.Var(&f.renamedMetricLabels, "rename-metric-label", "Rename a built-in metric label (builtinName=newName)")
+	flagSet.Var(&f.droppedMetricLabels, "drop-metric-label", "Drop a built-in metric label")
+	f.sshConnectionFilePath = flagSet.String("ssh-connection-file-path", getEnvString("PROXY_SSH_CONNECTION_FILE_PATH", metricshandler.DefaultOpenSSHConnectionFilePath), "File shared with the main container that indicates an open SSH connection")
+	f.codeServerHeartbeatFile = flagSet.String("code-server-heartbeat-file", os.Getenv("PROXY_CODE_SERVER_HEARTBEAT_FILE"), "code-server's heartbeat file, shared with the main container (code-server's /healthz endpoint is queried if empty)")
+	f.rstudioSessionsDirPath = flagSet.String("rstudio-sessions-dir", getEnvString("PROXY_RSTUDIO_SESSIONS_DIR", metricshandler.DefaultRStudioSessionsDirPath), "RStudio's active sessions directory, shared with the main container")
+	f.rayDashboardAddress = flagSet.String("ray-dashboard-addr", getEnvString("PROXY_RAY_DASHBOARD_ADDRESS", metricshandler.DefaultRayDashboardAddress), "host:port of the Ray dashboard")
+	f.daskDashboardAddress = flagSet.String("dask-dashboard-addr", getEnvString("PROXY_DASK_DASHBOARD_ADDRESS", metricshandler.DefaultDaskDashboardAddress), "host:port of the Dask scheduler's dashboard")
+	f.upstreamMetricsURL = flagSet.String("upstream-metrics-url", os.Getenv("PROXY_UPSTREAM_METRICS_URL"), "URL of the upstream's own metrics, re-exposed by upstream_metrics (defaults to the forward address' /metrics)")
+	f.upstreamMetricsFilter = flagSet.String("upstream-metrics-filter", os.Getenv("PROXY_UPSTREAM_METRICS_FILTER"), "Regex the names of re-exposed upstream metrics must fully match (all are exposed if empty)")
+	f.errorPages = flagSet.Bool("error-pages", getEnvBool("PROXY_ERROR_PAGES", false), "Return HTML / JSON error pages (by the Accept header) rather than bare statuses when the upstream fails")
+	f.errorPagesDirPath = flagSet.String("error-pages-dir", os.Getenv("PROXY_ERROR_PAGES_DIR"), "Directory of templates (e.g. 502.html, 503.json) overriding the built-in error pages")
+	f.errorPagesRetryAfter = flagSet.Duration("error-pages-retry-after", errorpage.DefaultRetryAfter, "Retry hint and auto-refresh interval of error pages, unless the upstream gives one (0 disables both)")
+	f.includeRuntimeMetrics = flagSet.Bool("runtime-metrics", getEnvBool("PROXY_RUNTIME_METRICS", true), "Include Go runtime and process metrics in /metrics")
+	f.pushMode = flagSet.String("push-mode", os.Getenv("PROXY_PUSH_MODE"), "Push metrics to a receiver (none, pushgateway, remote-write)")
+	f.pushURL = flagSet.String("push-url", os.Getenv("PROXY_PUSH_URL"), "Pushgateway base URL or remote write endpoint URL")
+	f.pushInterval = flagSet.Duration("push-interval", 15*time.Second, "Interval in which metrics are pushed")
+	f.pushJob = flagSet.String("push-job", getEnvString("PROXY_PUSH_JOB", "sidecar-proxy"), "Job pushed metrics are grouped by / labeled with")
+	f.shutdownTimeout = flagSet.Duration("shutdown-timeout", 10*time.Second, "Time to wait for in flight requests and the last metrics push on shutdown")
+	flagSet.Var(&f.ignoreRuleStrs, "ignore-rule", "Rule (e.g. \"path=^/api/kernels$;method=GET\") of requests that are forwarded but not counted as activity")
+	flagSet.Var(&f.headerRuleStrs, "header-rule", "Rule (e.g. \"on=response;path=^/lab;set=X-Frame-Options;value=DENY\") changing a header of forwarded requests or their responses")
+	flagSet.Var(&f.tcpRouteStrs, "tcp-route", "Route (e.g. \"name=postgres;listen=:5432;forward=127.0.0.1:5432\") of TCP connections forwarded by num_of_tcp_connections")
+	f.tracingEndpoint = flagSet.String("tracing-endpoint", os.Getenv("PROXY_TRACING_ENDPOINT"), "OTLP/HTTP collector host:port to export traces to (tracing is disabled if empty)")
+	f.tracingURLPath = flagSet.String("tracing-url-path", os.Getenv("PROXY_TRACING_URL_PATH"), "URL path on the collector to export traces to")
+	f.tracingInsecure = flagSet.Bool("tracing-insecure", getEnvBool("PROXY_TRACING_INSECURE", false), "Export traces over plain HTTP")
+	f.tracingSampleRatio = flagSet.Float64("tracing-sample-ratio", getEnvFloat("PROXY_TRACING_SAMPLE_RATIO", 1), "Fraction of new traces to sample")
+	f.upstreamAuthFlags = registerAuthFlags(flagSet, "auth-", "PROXY_AUTH_", "requests to the upstream")
+	f.metricsAuthFlags = registerAuthFlags(flagSet, "metrics-auth-", "PROXY_METRICS_AUTH_", "requests to /metrics")
+	f.adminAuthFlags = registerAuthFlags(flagSet, "admin-auth-", "PROXY_ADMIN_AUTH_", "requests to the admin listener")
+
+	return &f
+}
+
+// load resolves the flags and config file into a configuration, collecting all problems so they can be fixed at once
+func (f *configurationFlags) load(logger logger.Logger) (*loadedConfiguration, error) {
+	var configurationErrors common.MultiError
+
+	if len(f.metricNames) == 0 && *f.configFilePath == "" {
+		configurationErrors.Addf("At least one metric name must be given")
+	}
+
+	// settings that can be reloaded - given by flags, and overridden by the config file if there is one
+	pollIntervals, err := parsePollIntervals(f.pollIntervalStrs)
+	configurationErrors.AddWrap(err, "Failed to parse poll intervals")
+	reloadableConfiguration := reloader.Merge(reloader.Configuration{
+		ForwardAddress: *f.forwardAddress,
+		LogLevel:       *f.logLevel,
+		MetricNames:    f.metricNames,
+		PollIntervals:  pollIntervals,
+	}, reloader.Configuration{})
+
+	var configurationReloader *reloader.Reloader
+	if *f.configFilePath != "" {
+		configurationReloader, err = reloader.NewReloader(logger,
+			*f.configFilePath,
+			*f.configCheckInterval,
+			reloadableConfiguration)
+		if err != nil {
+			configurationErrors.AddWrap(err, "Failed to create configuration reloader")
+		} else if fileConfiguration, err := configurationReloader.Load(); err != nil {
+			configurationErrors.AddWrap(err, "Failed to load configuration file")
+		} else {
+			reloadableConfiguration = fileConfiguration
+		}
+	}
+
+	parsedLogLevel, err := common.ParseLogLevel(reloadableConfiguration.LogLevel)
+	configurationErrors.AddWrap(err, "Invalid log level")
+
+	metricLabelsConfiguration := metriclabels.Configuration{
+		PodLabelsFilePath:      *f.podLabelsFilePath,
+		PodAnnotationsFilePath: *f.podAnnotationsFilePath,
+		DroppedLabels:          f.droppedMetricLabels,
+	}
+	metricLabelsConfiguration.StaticLabels, err = common.ParseKeyValuePairs(f.staticMetricLabels)
+	configurationErrors.AddWrap(err, "Failed to parse metric labels")
+	metricLabelsConfiguration.PodLabels, err = common.ParseKeyValuePairs(f.podLabelMetricLabels)
+	configurationErrors.AddWrap(err, "Failed to parse metric labels from pod labels")
+	metricLabelsConfiguration.PodAnnotations, err = common.ParseKeyValuePairs(f.podAnnotationMetricLabels)
+	configurationErrors.AddWrap(err, "Failed to parse metric labels from pod annotations")
+	metricLabelsConfiguration.RenamedLabels, err = common.ParseKeyValuePairs(f.renamedMetricLabels)
+	configurationErrors.AddWrap(err, "Failed to parse renamed metric labels")
+
+	ignoreRules, err := activityfilter.ParseRules(f.ignoreRuleStrs)
+	configurationErrors.AddWrap(err, "Failed to parse ignore rules")
+
+	headerRules, err := headerrule.ParseRules(f.headerRuleStrs)
+	configurationErrors.AddWrap(err, "Failed to parse header rules")
+
+	tcpRoutes, err := tcproute.ParseRoutes(f.tcpRouteStrs)
+	configurationErrors.AddWrap(err, "Failed to parse TCP routes")
+
+	trustedProxies, err := forwarded.ParseNetworks(*f.trustedProxies)
+	configurationErrors.AddWrap(err, "Failed to parse trusted proxies")
+
+	parsedPushMode, err := pusher.ParseMode(*f.pushMode)
+	configurationErrors.AddWrap(err, "Failed to parse push mode")
+
+	upstreamAuthConfiguration, err := f.upstreamAuthFlags.configuration()
+	configurationErrors.AddWrap(err, "Failed to parse upstream auth configuration")
+	metricsAuthConfiguration, err := f.metricsAuthFlags.configuration()
+	configurationErrors.AddWrap(err, "Failed to parse metrics auth configuration")
+	adminAuthConfiguration, err := f.adminAuthFlags.configuration()
+	configurationErrors.AddWrap(err, "Failed to parse admin auth configuration")
+
+	serverConfiguration := sidecarproxy.Configuration{
+		ListenAddress:               *f.listenAddress,
+		AdminListenAddress:          *f.adminListenAddress,
+		AdminInsecure:               *f.adminInsecure,
+		DebugEndpoints:              *f.debugEndpoints,
+		ForwardAddress:              reloadableConfiguration.ForwardAddress,
+		H2C:                         *f.h2c,
+		UpstreamH2C:                 *f.upstreamH2C,
+		ProxyProtocol:               *f.proxyProtocol,
+		TrustedProxies:              trustedProxies,
+		Namespace:                   *f.namespace,
+		ServiceName:                 *f.serviceName,
+		InstanceName:                *f.instanceName,
+		MetricNames:                 reloadableConfiguration.MetricNames,
+		PollIntervals:               reloadableConfiguration.PollIntervals,
+		MetricLabels:                metricLabelsConfiguration,
+		MetricNamespace:             *f.metricNamespace,
+		MetricSubsystem:             *f.metricSubsystem,
+		SSHConnectionFilePath:       *f.sshConnectionFilePath,
+		CodeServerHeartbeatFilePath: *f.codeServerHeartbeatFile,
+		RStudioSessionsDirPath:      *f.rstudioSessionsDirPath,
+		RayDashboardAddress:         *f.rayDashboardAddress,
+		DaskDashboardAddress:        *f.daskDashboardAddress,
+		UpstreamMetricsURL:          *f.upstreamMetricsURL,
+		UpstreamMetricsFilter:       *f.upstreamMetricsFilter,
+		IgnoreRules:                 ignoreRules,
+		HeaderRules:                 headerRules,
+		TCPRoutes:                   tcpRoutes,
+		UpstreamAuth:                upstreamAuthConfiguration,
+		MetricsAuth:                 metricsAuthConfiguration,
+		AdminAuth:                   adminAuthConfiguration,
+		IncludeRuntimeMetrics:       *f.includeRuntimeMetrics,
+		ErrorPages: errorpage.Configuration{
+			Enabled:    *f.errorPages || *f.errorPagesDirPath != "",
+			DirPath:    *f.errorPagesDirPath,
+			RetryAfter: *f.errorPagesRetryAfter,
+		},
+		Pusher: pusher.Configuration{
+			Mode:     parsedPushMode,
+			URL:      *f.pushURL,
+			Interval: *f.pushInterval,
+			Job:      *f.pushJob,
+		},
+	}
+	configurationErrors.Add(serverConfiguration.Validate())
+
+	if err := configurationErrors.ErrorOrNil(); err != nil {
+		return nil, errors.Wrap(err, "Invalid configuration")
+	}
+
+	return &loadedConfiguration{
+		server:   serverConfiguration,
+		logLevel: parsedLogLevel,
+		tracing: tracing.Configuration{
+			Endpoint:    *f.tracingEndpoint,
+			URLPath:     *f.tracingURLPath,
+			Insecure:    *f.tracingInsecure,
+			SampleRatio: *f.tracingSampleRatio,
+		},
+		shutdownTimeout: *f.shutdownTimeout,
+		reloader:        configurationReloader,
+	}, nil
+}
+
+type authFlags struct {
+	mode                *string
+	tokens              common.StringArrayFlag
+	tokensFile          *string
+	htpasswdFile        *string
+	jwksFile            *string
+	jwksURL             *string
+	jwksRefreshInterval *time.Duration
+	issuer              *string
+	audience            *string
+	claimRules          common.StringArrayFlag
+	passAuthorization   *bool
+}
+
+// registerAuthFlags registers the same set of auth flags for each authenticated endpoint, prefixed differently
+func registerAuthFlags(flagSet *flag.FlagSet, flagPrefix string, envPrefix string, description string) *authFlags {
+	newAuthFlags := authFlags{}
+	newAuthFlags.mode = flagSet.String(flagPrefix+"mode", os.Getenv(envPrefix+"MODE"), "Authentication mode for "+description+" (none, bearer, basic, jwt)")
+	flagSet.Var(&newAuthFlags.tokens, flagPrefix+"token", "Bearer token accepted for "+description)
+	newAuthFlags.tokensFile = flagSet.String(flagPrefix+"tokens-file", os.Getenv(envPrefix+"TOKENS_FILE"), "File with bearer tokens (one per line) accepted for "+description)
+	newAuthFlags.htpasswdFile = flagSet.String(flagPrefix+"htpasswd-file", os.Getenv(envPrefix+"HTPASSWD_FILE"), "htpasswd file used to authenticate "+description)
+	newAuthFlags.jwksFile = flagSet.String(flagPrefix+"jwks-file", os.Getenv(envPrefix+"JWKS_FILE"), "JWKS file used to validate JWTs of "+description)
+	newAuthFlags.jwksURL = flagSet.String(flagPrefix+"jwks-url", os.Getenv(envPrefix+"JWKS_URL"), "JWKS URL used to validate JWTs of "+description)
+	newAuthFlags.jwksRefreshInterval = flagSet.Duration(flagPrefix+"jwks-refresh-interval", 5*time.Minute, "Interval in which the JWKS is reloaded")
+	newAuthFlags.issuer = flagSet.String(flagPrefix+"jwt-issuer", os.Getenv(envPrefix+"JWT_ISSUER"), "Required JWT issuer of "+description)
+	newAuthFlags.audience = flagSet.String(flagPrefix+"jwt-audience", os.Getenv(envPrefix+"JWT_AUDIENCE"), "Required JWT audience of "+description)
+	flagSet.Var(&newAuthFlags.claimRules, flagPrefix+"jwt-claim", "claim=value rule JWTs of "+description+" must match")
+	newAuthFlags.passAuthorization = flagSet.Bool(flagPrefix+"pass-authorization", getEnvBool(envPrefix+"PASS_AUTHORIZATION", false), "Pass the Authorization header of authenticated "+description+" on, rather than removing it")
+	return &newAuthFlags
+}
+
+func (a *authFlags) configuration() (auth.Configuration, error) {
+	mode, err := auth.ParseMode(*a.mode)
+	if err != nil {
+		return auth.Configuration{}, errors.Wrap(err, "Failed to parse auth mode")
+	}
+
+	return auth.Configuration{
+		Mode:                mode,
+		Tokens:              a.tokens,
+		TokensFile:          *a.tokensFile,
+		HtpasswdFile:        *a.htpasswdFile,
+		JWKSFile:            *a.jwksFile,
+		JWKSURL:             *a.jwksURL,
+		JWKSRefreshInterval: *a.jwksRefreshInterval,
+		Issuer:              *a.issuer,
+		Audience:            *a.audience,
+		ClaimRules:          a.claimRules,
+		PassAuthorization:   *a.passAuthorization,
+	}, nil
+}
+
+// parsePollIntervals parses metricName=duration pairs
+func parsePollIntervals(pollIntervalStrs []string) (map[metricshandler.MetricName]time.Duration, error) {
+	pollIntervalStrsByName, err := common.ParseKeyValuePairs(pollIntervalStrs)
+	if err != nil {
+		return nil, err
+	}
+
+	pollIntervals := map[metricshandler.MetricName]time.Duration{}
+	for metricName, pollIntervalStr := range pollIntervalStrsByName {
+		pollInterval, err := time.ParseDuration(pollIntervalStr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse poll interval of %s", metricName)
+		}
+		pollIntervals[metricshandler.MetricName(metricName)] = pollInterval
+	}
+	return pollIntervals, nil
+}
+
+func getEnvString(key string, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
@@ -4,68 +4,81 @@
 // you may not use this file except in compliance with the License.
 // You may obtain a copy of the License at
 //
-//	http://www.apache.org/licenses/LICENSE-2.0
+//     http://www.apache.org/licenses/LICENSE-2.0
 //
 // Unless required by applicable law or agreed to in writing, software
 // distributed under the License is distributed on an "AS IS" BASIS,
 // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
 // See the License for the specific language governing permissions and
 // limitations under the License.
+//
+
 package main
 
 import (
-	"flag"
+	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	"github.com/v3io/sidecar-proxy/pkg/common"
-	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy"
 
 	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
 	"github.com/nuclio/loggerus"
 	"github.com/sirupsen/logrus"
 )
 
-func run() error {
-	var metricNames common.StringArrayFlag
+const usage = `Usage: sidecarproxy [command] [flags]
 
-	// args
-	listenAddress := flag.String("listen-addr", os.Getenv("PROXY_LISTEN_ADDRESS"), "Port to listen on")
-	forwardAddress := flag.String("forward-addr", os.Getenv("PROXY_FORWARD_ADDRESS"), "IP /w port to forward to (without protocol)")
-	namespace := flag.String("namespace", os.Getenv("PROXY_NAMESPACE"), "Kubernetes namespace")
-	serviceName := flag.String("service-name", os.Getenv("PROXY_SERVICE_NAME"), "Service which the proxy serves")
-	instanceName := flag.String("instance-name", os.Getenv("PROXY_INSTANCE_NAME"), "Deployment instance name")
-	logLevel := flag.String("log-level", os.Getenv("LOG_LEVEL"), "Set proxy's log level")
-	flag.Var(&metricNames, "metric-name", "Set which metrics to collect")
-	flag.Parse()
+Commands:
+  serve     Run the proxy (the default if no command is given)
+  validate  Check the configuration without starting anything
+  probe     Run each enabled metrics handler's collection once and print the values
+  version   Print build information
+  help      Print this message
 
-	// logger conf
-	parsedLogLevel, err := logrus.ParseLevel(*logLevel)
-	if err != nil {
-		return errors.Wrap(err, "Failed to parse log level")
-	}
-	logger, err := loggerus.NewJSONLoggerus("main", parsedLogLevel, os.Stdout)
-	if err != nil {
-		return errors.Wrap(err, "Failed to create new logger")
+Run "sidecarproxy <command> -h" to list a command's flags
+`
+
+func run(arguments []string) error {
+
+	// flags without a command run the proxy, as before commands were introduced
+	command := "serve"
+	if len(arguments) > 0 && !strings.HasPrefix(arguments[0], "-") {
+		command, arguments = arguments[0], arguments[1:]
 	}
 
-	if len(metricNames) == 0 {
-		return errors.New("at least one metric name should be given")
+	switch command {
+	case "serve":
+		return runServe(arguments)
+	case "validate":
+		return runValidate(arguments)
+	case "probe":
+		return runProbe(arguments)
+	case "version":
+		return runVersion(arguments)
+	case "help":
+		fmt.Print(usage)
+		return nil
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return errors.Errorf("Unknown command: %s", command)
 	}
+}
 
-	// server start
-	server, err := sidecarproxy.NewServer(logger, *listenAddress, *forwardAddress, *namespace, *serviceName, *instanceName, metricNames)
+// newLogger creates a logger whose level can be changed at runtime. the underlying logger logs everything, and the
+// level is applied by a wrapper
+func newLogger(level logger.Level, output io.Writer) (*common.LeveledLogger, error) {
+	baseLogger, err := loggerus.NewJSONLoggerus("main", logrus.DebugLevel, output)
 	if err != nil {
-		return errors.Wrap(err, "Failed to create new server")
+		return nil, err
 	}
-	if err = server.Start(); err != nil {
-		return errors.Wrap(err, "Failed to start server")
-	}
-
-	return nil
+	return common.NewLeveledLogger(baseLogger, level), nil
 }
 
 func main() {
-	if err := run(); err != nil {
+	if err := run(os.Args[1:]); err != nil {
 		errors.PrintErrorStack(os.Stderr, err, 5)
 		os.Exit(1)
 	}
@@ -0,0 +1,131 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+)
+
+type probeOutput struct {
+	metricshandler.Status
+	ProbeError string `json:"probeError,omitempty"`
+}
+
+// runProbe runs each enabled handler's collection once and prints its values, e.g. to debug handlers inside a
+// running pod with kubectl exec
+func runProbe(arguments []string) error {
+	flagSet := flag.NewFlagSet("probe", flag.ExitOnError)
+	configurationFlags := registerConfigurationFlags(flagSet)
+	outputJSON := flagSet.Bool("json", false, "Print the results as JSON")
+	flagSet.Parse(arguments) // nolint: errcheck
+
+	// logs go to stderr, so they don't mix with the results
+	logger, err := newLogger(logger.LevelWarn, os.Stderr)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create new logger")
+	}
+
+	configuration, err := configurationFlags.load(logger)
+	if err != nil {
+		return err
+	}
+
+	server, err := sidecarproxy.NewServer(logger, configuration.server)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create new server")
+	}
+
+	probeResults, err := server.Probe()
+	if err != nil {
+		return errors.Wrap(err, "Failed to probe metrics handlers")
+	}
+
+	numOfFailures := 0
+	var probeOutputs []probeOutput
+	for _, probeResult := range probeResults {
+		output := probeOutput{Status: probeResult.Status}
+		if probeResult.Err != nil {
+			output.ProbeError = errors.Cause(probeResult.Err).Error()
+			numOfFailures++
+		}
+		probeOutputs = append(probeOutputs, output)
+	}
+
+	if *outputJSON {
+		encodedProbeOutputs, err := json.MarshalIndent(probeOutputs, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "Failed to encode probe results")
+		}
+		fmt.Println(string(encodedProbeOutputs))
+	} else {
+		for _, output := range probeOutputs {
+			printProbeOutput(output)
+		}
+	}
+
+	if numOfFailures > 0 {
+		return errors.Errorf("%d of %d metrics handlers failed", numOfFailures, len(probeOutputs))
+	}
+	return nil
+}
+
+func printProbeOutput(output probeOutput) {
+	if output.ProbeError != "" {
+		fmt.Printf("%s: failed - %s\n", output.Name, output.ProbeError)
+	} else {
+		fmt.Printf("%s: ok\n", output.Name)
+	}
+
+	numOfSamples := 0
+	for _, metric := range output.Metrics {
+		for _, sample := range metric.Samples {
+			fmt.Printf("  %s%s %v\n", metric.Name, formatLabels(sample.Labels), sample.Value)
+			numOfSamples++
+		}
+	}
+	if numOfSamples == 0 {
+		fmt.Println("  (no samples)")
+	}
+}
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var labelNames []string
+	for labelName := range labels {
+		labelNames = append(labelNames, labelName)
+	}
+	sort.Strings(labelNames)
+
+	var formattedLabels []string
+	for _, labelName := range labelNames {
+		formattedLabels = append(formattedLabels, fmt.Sprintf("%s=%q", labelName, labels[labelName]))
+	}
+	return "{" + strings.Join(formattedLabels, ",") + "}"
+}
@@ -0,0 +1,100 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/tracing"
+	"github.com/v3io/sidecar-proxy/pkg/version"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+)
+
+// runServe runs the proxy until it's signaled to stop
+func runServe(arguments []string) error {
+	flagSet := flag.NewFlagSet("serve", flag.ExitOnError)
+	configurationFlags := registerConfigurationFlags(flagSet)
+	flagSet.Parse(arguments) // nolint: errcheck
+
+	logger, err := newLogger(logger.LevelInfo, os.Stdout)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create new logger")
+	}
+
+	configuration, err := configurationFlags.load(logger)
+	if err != nil {
+		return err
+	}
+
+	logger.SetLevel(configuration.logLevel)
+
+	versionInfo := version.Get()
+	logger.InfoWith("Starting sidecar proxy", "version", versionInfo.Version, "gitCommit", versionInfo.GitCommit)
+
+	// tracing
+	shutdownTracing, err := tracing.Setup(logger,
+		configuration.tracing,
+		configuration.server.Namespace,
+		configuration.server.ServiceName,
+		configuration.server.InstanceName)
+	if err != nil {
+		return errors.Wrap(err, "Failed to set up tracing")
+	}
+	defer shutdownTracing(context.Background()) // nolint: errcheck
+
+	// server start
+	server, err := sidecarproxy.NewServer(logger, configuration.server)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create new server")
+	}
+
+	serverErrChan := make(chan error, 1)
+	go func() {
+		serverErrChan <- server.Start()
+	}()
+
+	if configuration.reloader != nil {
+		configuration.reloader.Start(server.ApplyConfiguration)
+		defer configuration.reloader.Stop()
+	}
+
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-serverErrChan:
+		if err != nil {
+			return errors.Wrap(err, "Failed to start server")
+		}
+	case receivedSignal := <-signalChan:
+		logger.InfoWith("Received signal, shutting down", "signal", receivedSignal.String())
+
+		ctx, cancel := context.WithTimeout(context.Background(), configuration.shutdownTimeout)
+		defer cancel()
+		if err := server.Stop(ctx); err != nil {
+			return errors.Wrap(err, "Failed to stop server")
+		}
+	}
+
+	return nil
+}
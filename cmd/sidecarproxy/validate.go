@@ -0,0 +1,44 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+)
+
+// runValidate checks the configuration without starting anything
+func runValidate(arguments []string) error {
+	flagSet := flag.NewFlagSet("validate", flag.ExitOnError)
+	configurationFlags := registerConfigurationFlags(flagSet)
+	flagSet.Parse(arguments) // nolint: errcheck
+
+	logger, err := newLogger(logger.LevelWarn, os.Stderr)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create new logger")
+	}
+
+	if _, err := configurationFlags.load(logger); err != nil {
+		return err
+	}
+
+	fmt.Println("Configuration is valid")
+	return nil
+}
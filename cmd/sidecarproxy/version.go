@@ -0,0 +1,46 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"github.com/v3io/sidecar-proxy/pkg/version"
+
+	"github.com/nuclio/errors"
+)
+
+// runVersion prints the build info injected at link time
+func runVersion(arguments []string) error {
+	flagSet := flag.NewFlagSet("version", flag.ExitOnError)
+	outputJSON := flagSet.Bool("json", false, "Print the build info as JSON")
+	flagSet.Parse(arguments) // nolint: errcheck
+
+	versionInfo := version.Get()
+	if !*outputJSON {
+		fmt.Print(versionInfo.String())
+		return nil
+	}
+
+	encodedVersionInfo, err := json.MarshalIndent(versionInfo, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to encode build info")
+	}
+	fmt.Println(string(encodedVersionInfo))
+	return nil
+}
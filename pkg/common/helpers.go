@@ -16,7 +16,10 @@
 package common
 
 import (
+	"net"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/nuclio/errors"
 )
@@ -43,3 +46,32 @@ func FileExists(filePath string) (bool, error) {
 	// sanity: file may or may not exist
 	return false, err
 }
+
+// ParseKeyValuePairs parses "key=value" strings into a map
+func ParseKeyValuePairs(pairs []string) (map[string]string, error) {
+	parsedPairs := map[string]string{}
+	for _, pair := range pairs {
+		key, value, found := strings.Cut(pair, "=")
+		if !found || key == "" {
+			return nil, errors.Errorf("Expected key=value, got: %s", pair)
+		}
+		parsedPairs[key] = value
+	}
+	return parsedPairs, nil
+}
+
+// ValidateAddress checks that an address is in the form host:port. The host may be omitted (e.g. ":8080") unless
+// hostRequired is set
+func ValidateAddress(address string, hostRequired bool) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return errors.Errorf("Expected host:port, got: %q", address)
+	}
+	if hostRequired && host == "" {
+		return errors.Errorf("Missing host in address: %q", address)
+	}
+	if portNumber, err := strconv.Atoi(port); err != nil || portNumber < 0 || portNumber > 65535 {
+		return errors.Errorf("Invalid port in address: %q", address)
+	}
+	return nil
+}
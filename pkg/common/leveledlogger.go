@@ -0,0 +1,191 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package common
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+)
+
+// LeveledLogger filters the entries of a logger by a level that can be changed at runtime. The level is shared with
+// all of the logger's children
+type LeveledLogger struct {
+	logger logger.Logger
+	level  *int32
+}
+
+// NewLeveledLogger wraps the given logger, which should itself log at debug level
+func NewLeveledLogger(baseLogger logger.Logger, level logger.Level) *LeveledLogger {
+	sharedLevel := int32(level)
+	return &LeveledLogger{
+		logger: baseLogger,
+		level:  &sharedLevel,
+	}
+}
+
+// ParseLogLevel parses a log level name (debug, info, warn / warning, error)
+func ParseLogLevel(levelStr string) (logger.Level, error) {
+	switch strings.ToLower(levelStr) {
+	case "debug", "trace":
+		return logger.LevelDebug, nil
+	case "info":
+		return logger.LevelInfo, nil
+	case "warn", "warning":
+		return logger.LevelWarn, nil
+	case "error", "fatal", "panic":
+		return logger.LevelError, nil
+	default:
+		return 0, errors.Errorf("Unknown log level: %s", levelStr)
+	}
+}
+
+// LogLevelName returns the name of a log level, as accepted by ParseLogLevel
+func LogLevelName(level logger.Level) string {
+	switch level {
+	case logger.LevelDebug:
+		return "debug"
+	case logger.LevelInfo:
+		return "info"
+	case logger.LevelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+func (l *LeveledLogger) SetLevel(level logger.Level) {
+	atomic.StoreInt32(l.level, int32(level))
+}
+
+func (l *LeveledLogger) GetLevel() logger.Level {
+	return logger.Level(atomic.LoadInt32(l.level))
+}
+
+func (l *LeveledLogger) enabled(level logger.Level) bool {
+	return level >= l.GetLevel()
+}
+
+func (l *LeveledLogger) Error(format interface{}, vars ...interface{}) {
+	if l.enabled(logger.LevelError) {
+		l.logger.Error(format, vars...)
+	}
+}
+
+func (l *LeveledLogger) Warn(format interface{}, vars ...interface{}) {
+	if l.enabled(logger.LevelWarn) {
+		l.logger.Warn(format, vars...)
+	}
+}
+
+func (l *LeveledLogger) Info(format interface{}, vars ...interface{}) {
+	if l.enabled(logger.LevelInfo) {
+		l.logger.Info(format, vars...)
+	}
+}
+
+func (l *LeveledLogger) Debug(format interface{}, vars ...interface{}) {
+	if l.enabled(logger.LevelDebug) {
+		l.logger.Debug(format, vars...)
+	}
+}
+
+func (l *LeveledLogger) ErrorCtx(ctx context.Context, format interface{}, vars ...interface{}) {
+	if l.enabled(logger.LevelError) {
+		l.logger.ErrorCtx(ctx, format, vars...)
+	}
+}
+
+func (l *LeveledLogger) WarnCtx(ctx context.Context, format interface{}, vars ...interface{}) {
+	if l.enabled(logger.LevelWarn) {
+		l.logger.WarnCtx(ctx, format, vars...)
+	}
+}
+
+func (l *LeveledLogger) InfoCtx(ctx context.Context, format interface{}, vars ...interface{}) {
+	if l.enabled(logger.LevelInfo) {
+		l.logger.InfoCtx(ctx, format, vars...)
+	}
+}
+
+func (l *LeveledLogger) DebugCtx(ctx context.Context, format interface{}, vars ...interface{}) {
+	if l.enabled(logger.LevelDebug) {
+		l.logger.DebugCtx(ctx, format, vars...)
+	}
+}
+
+func (l *LeveledLogger) ErrorWith(format interface{}, vars ...interface{}) {
+	if l.enabled(logger.LevelError) {
+		l.logger.ErrorWith(format, vars...)
+	}
+}
+
+func (l *LeveledLogger) WarnWith(format interface{}, vars ...interface{}) {
+	if l.enabled(logger.LevelWarn) {
+		l.logger.WarnWith(format, vars...)
+	}
+}
+
+func (l *LeveledLogger) InfoWith(format interface{}, vars ...interface{}) {
+	if l.enabled(logger.LevelInfo) {
+		l.logger.InfoWith(format, vars...)
+	}
+}
+
+func (l *LeveledLogger) DebugWith(format interface{}, vars ...interface{}) {
+	if l.enabled(logger.LevelDebug) {
+		l.logger.DebugWith(format, vars...)
+	}
+}
+
+func (l *LeveledLogger) ErrorWithCtx(ctx context.Context, format interface{}, vars ...interface{}) {
+	if l.enabled(logger.LevelError) {
+		l.logger.ErrorWithCtx(ctx, format, vars...)
+	}
+}
+
+func (l *LeveledLogger) WarnWithCtx(ctx context.Context, format interface{}, vars ...interface{}) {
+	if l.enabled(logger.LevelWarn) {
+		l.logger.WarnWithCtx(ctx, format, vars...)
+	}
+}
+
+func (l *LeveledLogger) InfoWithCtx(ctx context.Context, format interface{}, vars ...interface{}) {
+	if l.enabled(logger.LevelInfo) {
+		l.logger.InfoWithCtx(ctx, format, vars...)
+	}
+}
+
+func (l *LeveledLogger) DebugWithCtx(ctx context.Context, format interface{}, vars ...interface{}) {
+	if l.enabled(logger.LevelDebug) {
+		l.logger.DebugWithCtx(ctx, format, vars...)
+	}
+}
+
+func (l *LeveledLogger) Flush() {
+	l.logger.Flush()
+}
+
+// GetChild returns a child logger sharing this logger's level
+func (l *LeveledLogger) GetChild(name string) logger.Logger {
+	return &LeveledLogger{
+		logger: l.logger.GetChild(name),
+		level:  l.level,
+	}
+}
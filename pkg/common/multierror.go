@@ -0,0 +1,104 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package common
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nuclio/errors"
+)
+
+// MultiError collects errors, so that all of a configuration's problems can be reported at once
+type MultiError struct {
+	errs []error
+}
+
+// Add adds an error, nil errors are ignored
+func (m *MultiError) Add(err error) {
+	if err == nil {
+		return
+	}
+
+	// flatten, so adding a validation's errors to another's lists each problem once
+	if multiError, ok := err.(*MultiError); ok {
+		m.errs = append(m.errs, multiError.errs...)
+		return
+	}
+	m.errs = append(m.errs, err)
+}
+
+// Addf adds a new error
+func (m *MultiError) Addf(format string, args ...interface{}) {
+	m.errs = append(m.errs, errors.Errorf(format, args...))
+}
+
+// AddWrap adds an error wrapped with a message, nil errors are ignored. Each of a MultiError's errors is wrapped
+// and added separately
+func (m *MultiError) AddWrap(err error, message string) {
+	if err == nil {
+		return
+	}
+	if multiError, ok := err.(*MultiError); ok {
+		for _, innerErr := range multiError.errs {
+			m.errs = append(m.errs, errors.Wrap(innerErr, message))
+		}
+		return
+	}
+	m.errs = append(m.errs, errors.Wrap(err, message))
+}
+
+func (m *MultiError) Errors() []error {
+	return m.errs
+}
+
+// ErrorOrNil returns nil if no errors were added, so it can be returned as is
+func (m *MultiError) ErrorOrNil() error {
+	if len(m.errs) == 0 {
+		return nil
+	}
+	return m
+}
+
+func (m *MultiError) Error() string {
+	if len(m.errs) == 1 {
+		return describeError(m.errs[0])
+	}
+
+	messages := []string{fmt.Sprintf("%d problems found:", len(m.errs))}
+	for _, err := range m.errs {
+		messages = append(messages, "  - "+describeError(err))
+	}
+	return strings.Join(messages, "\n")
+}
+
+func (m *MultiError) Unwrap() []error {
+	return m.errs
+}
+
+// describeError returns the messages of a wrapped error and its causes, outermost first
+func describeError(err error) string {
+	messages := []string{err.Error()}
+	for {
+		wrappingErr, ok := err.(*errors.Error)
+		if !ok || wrappingErr.Cause() == nil {
+			break
+		}
+		err = wrappingErr.Cause()
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, ": ")
+}
@@ -0,0 +1,145 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package activityfilter
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/v3io/sidecar-proxy/pkg/common"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/forwarded"
+
+	"github.com/nuclio/errors"
+)
+
+// Rule marks requests as non-activity. All conditions set on a rule must match for it to match a request
+type Rule struct {
+	Name             string
+	PathPattern      *regexp.Regexp
+	Methods          []string
+	UserAgentPattern *regexp.Regexp
+	SourceNetworks   []*net.IPNet
+}
+
+// ParseRule parses a rule of the form "key=value;key=value", where keys are name, path (regex), method,
+// user-agent (regex) and cidr. method and cidr accept several values separated by "|"
+func ParseRule(ruleStr string, defaultName string) (Rule, error) {
+	rule := Rule{Name: defaultName}
+	conditionSet := false
+
+	for _, part := range strings.Split(ruleStr, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		key, value, found := strings.Cut(part, "=")
+		if !found || value == "" {
+			return Rule{}, errors.Errorf("Rule condition must be in the form key=value: %s", part)
+		}
+
+		switch strings.TrimSpace(key) {
+		case "name":
+			rule.Name = value
+			continue
+		case "path":
+			pathPattern, err := regexp.Compile(value)
+			if err != nil {
+				return Rule{}, errors.Wrapf(err, "Failed to compile path pattern: %s", value)
+			}
+			rule.PathPattern = pathPattern
+		case "method":
+			for _, method := range strings.Split(value, "|") {
+				rule.Methods = append(rule.Methods, strings.ToUpper(strings.TrimSpace(method)))
+			}
+		case "user-agent":
+			userAgentPattern, err := regexp.Compile(value)
+			if err != nil {
+				return Rule{}, errors.Wrapf(err, "Failed to compile user agent pattern: %s", value)
+			}
+			rule.UserAgentPattern = userAgentPattern
+		case "cidr":
+			for _, cidr := range strings.Split(value, "|") {
+				_, sourceNetwork, err := net.ParseCIDR(strings.TrimSpace(cidr))
+				if err != nil {
+					return Rule{}, errors.Wrapf(err, "Failed to parse CIDR: %s", cidr)
+				}
+				rule.SourceNetworks = append(rule.SourceNetworks, sourceNetwork)
+			}
+		default:
+			return Rule{}, errors.Errorf("Unknown rule condition: %s", key)
+		}
+		conditionSet = true
+	}
+
+	// a rule without conditions would ignore all requests, which is surely a mistake
+	if !conditionSet {
+		return Rule{}, errors.Errorf("Rule has no conditions: %s", ruleStr)
+	}
+
+	return rule, nil
+}
+
+// ParseRules parses the given rules, naming unnamed rules by their position
+func ParseRules(ruleStrs []string) ([]Rule, error) {
+	var rules []Rule
+	for ruleIndex, ruleStr := range ruleStrs {
+		rule, err := ParseRule(ruleStr, fmt.Sprintf("rule-%d", ruleIndex))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse rule: %s", ruleStr)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Match returns the name of the first rule that matches the request
+func Match(rules []Rule, req *http.Request) (string, bool) {
+	for ruleIndex := range rules {
+		if rules[ruleIndex].Matches(req) {
+			return rules[ruleIndex].Name, true
+		}
+	}
+	return "", false
+}
+
+func (r *Rule) Matches(req *http.Request) bool {
+	if r.PathPattern != nil && !r.PathPattern.MatchString(req.URL.Path) {
+		return false
+	}
+
+	if len(r.Methods) > 0 && !common.StringInSlice(req.Method, r.Methods) {
+		return false
+	}
+
+	if r.UserAgentPattern != nil && !r.UserAgentPattern.MatchString(req.UserAgent()) {
+		return false
+	}
+
+	if len(r.SourceNetworks) > 0 && !r.sourceMatches(forwarded.ClientIP(req)) {
+		return false
+	}
+
+	return true
+}
+
+func (r *Rule) sourceMatches(sourceAddress string) bool {
+	sourceIP := net.ParseIP(sourceAddress)
+	return sourceIP != nil && forwarded.Contains(r.SourceNetworks, sourceIP)
+}
@@ -0,0 +1,132 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package activityfilter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	for _, testCase := range []struct {
+		name          string
+		ruleStr       string
+		expectedName  string
+		expectedError string
+	}{
+		{name: "default name", ruleStr: "path=^/api/kernels$", expectedName: "rule-0"},
+		{name: "named", ruleStr: "name=probes; user-agent=^kube-probe/", expectedName: "probes"},
+		{name: "no conditions", ruleStr: "name=all", expectedError: "Rule has no conditions"},
+		{name: "empty value", ruleStr: "path=", expectedError: "must be in the form key=value"},
+		{name: "unknown condition", ruleStr: "host=example.com", expectedError: "Unknown rule condition"},
+		{name: "invalid path pattern", ruleStr: "path=(", expectedError: "Failed to compile path pattern"},
+		{name: "invalid CIDR", ruleStr: "cidr=10.0.0.0/8|nope", expectedError: "Failed to parse CIDR"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			rule, err := ParseRule(testCase.ruleStr, "rule-0")
+			if testCase.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), testCase.expectedError) {
+					t.Fatalf("Expected error containing %q, got %v", testCase.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if rule.Name != testCase.expectedName {
+				t.Fatalf("Expected name %q, got %q", testCase.expectedName, rule.Name)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	rules, err := ParseRules([]string{
+		"name=kernels-poll;path=^/api/kernels$;method=get|head",
+		"name=probes;user-agent=^kube-probe/",
+		"path=^/metrics-ui/;cidr=10.0.0.0/8|192.168.0.0/16",
+	})
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+
+	for _, testCase := range []struct {
+		name             string
+		rules            []Rule
+		method           string
+		path             string
+		userAgent        string
+		remoteAddr       string
+		expectedRuleName string
+	}{
+		{name: "no rules count everything as activity", method: http.MethodGet, path: "/api/kernels"},
+		{
+			name:             "path and method",
+			rules:            rules,
+			method:           http.MethodGet,
+			path:             "/api/kernels",
+			expectedRuleName: "kernels-poll",
+		},
+		{
+			name:             "second method",
+			rules:            rules,
+			method:           http.MethodHead,
+			path:             "/api/kernels",
+			expectedRuleName: "kernels-poll",
+		},
+		{name: "other method", rules: rules, method: http.MethodPost, path: "/api/kernels"},
+		{name: "path matched as a regex", rules: rules, method: http.MethodGet, path: "/api/kernels/1"},
+		{
+			name:             "user agent",
+			rules:            rules,
+			method:           http.MethodPost,
+			path:             "/lab",
+			userAgent:        "kube-probe/1.27",
+			expectedRuleName: "probes",
+		},
+		{name: "other user agent", rules: rules, method: http.MethodGet, path: "/lab", userAgent: "Mozilla/5.0"},
+		{
+			name:             "source network",
+			rules:            rules,
+			method:           http.MethodGet,
+			path:             "/metrics-ui/",
+			remoteAddr:       "192.168.1.1:1234",
+			expectedRuleName: "rule-2",
+		},
+		{
+			name:       "other source network",
+			rules:      rules,
+			method:     http.MethodGet,
+			path:       "/metrics-ui/",
+			remoteAddr: "203.0.113.7:1234",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(testCase.method, testCase.path, nil)
+			req.Header.Set("User-Agent", testCase.userAgent)
+			if testCase.remoteAddr != "" {
+				req.RemoteAddr = testCase.remoteAddr
+			}
+
+			ruleName, matched := Match(testCase.rules, req)
+			if matched != (testCase.expectedRuleName != "") || ruleName != testCase.expectedRuleName {
+				t.Fatalf("Expected rule %q to match, got %q (matched: %v)", testCase.expectedRuleName, ruleName, matched)
+			}
+		})
+	}
+}
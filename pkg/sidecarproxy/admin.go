@@ -0,0 +1,289 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sidecarproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/v3io/sidecar-proxy/pkg/common"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler/factory"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+)
+
+type status struct {
+	Upstream  string                  `json:"upstream"`
+	StartTime time.Time               `json:"startTime"`
+	Handlers  []metricshandler.Status `json:"handlers"`
+}
+
+type pollIntervalRequest struct {
+	Interval string `json:"interval"`
+}
+
+type logLevelBody struct {
+	Level string `json:"level"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// levelSetter is implemented by loggers whose level can be changed at runtime (e.g. common.LeveledLogger)
+type levelSetter interface {
+	SetLevel(level logger.Level)
+	GetLevel() logger.Level
+}
+
+// registerAdminRoutes registers the admin endpoints, which are served only by the admin listener
+func (s *Server) registerAdminRoutes() {
+	s.adminServeMux.HandleFunc("/status", s.onStatus)
+	s.adminServeMux.HandleFunc("/handlers", s.onListHandlers)
+	s.adminServeMux.HandleFunc("/handlers/", s.onHandler)
+	s.adminServeMux.HandleFunc("/log-level", s.onLogLevel)
+
+	if s.debugEndpoints {
+		s.registerDebugRoutes()
+	}
+}
+
+func (s *Server) onStatus(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.metricsHandlersLock.Lock()
+	currentStatus := status{
+		Upstream:  s.forwardAddress,
+		StartTime: s.startTime,
+		Handlers:  s.metricsHandlersStatus(),
+	}
+	s.metricsHandlersLock.Unlock()
+
+	s.writeJSON(res, http.StatusOK, currentStatus)
+}
+
+func (s *Server) onListHandlers(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.metricsHandlersLock.Lock()
+	statuses := s.metricsHandlersStatus()
+	s.metricsHandlersLock.Unlock()
+
+	s.writeJSON(res, http.StatusOK, statuses)
+}
+
+// onHandler serves /handlers/<name>/start, /handlers/<name>/stop and /handlers/<name>/poll-interval
+func (s *Server) onHandler(res http.ResponseWriter, req *http.Request) {
+	pathParts := strings.Split(strings.TrimPrefix(req.URL.Path, "/handlers/"), "/")
+	if len(pathParts) != 2 || pathParts[0] == "" {
+		res.WriteHeader(http.StatusNotFound)
+		return
+	}
+	metricName, action := metricshandler.MetricName(pathParts[0]), pathParts[1]
+
+	var err error
+	switch {
+	case action == "start" && req.Method == http.MethodPost:
+		err = s.startMetricsHandler(metricName)
+	case action == "stop" && req.Method == http.MethodPost:
+		err = s.stopMetricsHandler(metricName)
+	case action == "poll-interval" && req.Method == http.MethodPut:
+		err = s.setMetricsHandlerPollInterval(metricName, req)
+	case action == "start", action == "stop", action == "poll-interval":
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	default:
+		res.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		s.logger.WarnWith("Admin request failed",
+			"metricName", metricName,
+			"action", action,
+			"err", errors.Cause(err).Error())
+		s.writeJSON(res, http.StatusBadRequest, errorResponse{Error: errors.Cause(err).Error()})
+		return
+	}
+
+	s.logger.InfoWith("Admin request succeeded", "metricName", metricName, "action", action)
+
+	metricsHandler, _ := s.getMetricsHandler(metricName)
+	s.writeJSON(res, http.StatusOK, metricsHandler.Status())
+}
+
+func (s *Server) onLogLevel(res http.ResponseWriter, req *http.Request) {
+	leveledLogger, ok := s.rootLogger.(levelSetter)
+	if !ok {
+		s.writeJSON(res, http.StatusNotImplemented, errorResponse{Error: "Logger doesn't support changing its level"})
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var body logLevelBody
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			s.writeJSON(res, http.StatusBadRequest, errorResponse{Error: "Failed to decode request body"})
+			return
+		}
+		level, err := common.ParseLogLevel(body.Level)
+		if err != nil {
+			s.writeJSON(res, http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+		leveledLogger.SetLevel(level)
+
+		// logged as a warning so the change is visible at any level
+		s.logger.WarnWith("Log level changed", "level", common.LogLevelName(level))
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.writeJSON(res, http.StatusOK, logLevelBody{Level: common.LogLevelName(leveledLogger.GetLevel())})
+}
+
+// metricsHandlersStatus must be called with metricsHandlersLock held
+func (s *Server) metricsHandlersStatus() []metricshandler.Status {
+	statuses := []metricshandler.Status{}
+	for _, metricsHandler := range s.metricsHandlers {
+		statuses = append(statuses, metricsHandler.Status())
+	}
+	return statuses
+}
+
+func (s *Server) getMetricsHandler(metricName metricshandler.MetricName) (metricshandler.MetricsHandler, bool) {
+	s.metricsHandlersLock.Lock()
+	defer s.metricsHandlersLock.Unlock()
+
+	return s.findMetricsHandler(metricName)
+}
+
+// findMetricsHandler must be called with metricsHandlersLock held
+func (s *Server) findMetricsHandler(metricName metricshandler.MetricName) (metricshandler.MetricsHandler, bool) {
+	for _, metricsHandler := range s.metricsHandlers {
+		if metricsHandler.Name() == metricName {
+			return metricsHandler, true
+		}
+	}
+	return nil, false
+}
+
+func (s *Server) startMetricsHandler(metricName metricshandler.MetricName) error {
+	s.metricsHandlersLock.Lock()
+	defer s.metricsHandlersLock.Unlock()
+
+	return s.startMetricsHandlerLocked(metricName)
+}
+
+// startMetricsHandlerLocked starts a stopped handler, or creates and starts a handler that wasn't enabled on startup.
+// It must be called with metricsHandlersLock held
+func (s *Server) startMetricsHandlerLocked(metricName metricshandler.MetricName) error {
+	metricsHandler, found := s.findMetricsHandler(metricName)
+	if !found {
+		var err error
+		metricsHandler, err = factory.Create(string(metricName), s.rootLogger, s.metricsHandlerConfiguration)
+		if err != nil {
+			return errors.Wrap(err, "Failed to create metrics handler")
+		}
+	} else if metricsHandler.IsRunning() {
+		return errors.Errorf("Metrics handler %s is already running", metricName)
+	}
+
+	// metrics registered before a later one failed are unregistered as well
+	if err := metricsHandler.RegisterMetrics(s.registry); err != nil {
+		metricsHandler.UnregisterMetrics(s.registry)
+		return errors.Wrap(err, "Failed registering metrics")
+	}
+	if err := metricsHandler.Start(); err != nil {
+		metricsHandler.UnregisterMetrics(s.registry)
+		return errors.Wrap(err, "Failed starting metrics handler")
+	}
+
+	// a created handler is listed only once it runs, so a failed start doesn't leave it behind
+	if !found {
+		s.metricsHandlers = append(s.metricsHandlers, metricsHandler)
+	}
+	return nil
+}
+
+func (s *Server) stopMetricsHandler(metricName metricshandler.MetricName) error {
+	s.metricsHandlersLock.Lock()
+	defer s.metricsHandlersLock.Unlock()
+
+	return s.stopMetricsHandlerLocked(metricName)
+}
+
+// stopMetricsHandlerLocked stops a handler and unregisters its metrics, so they aren't exported with stale values.
+// It must be called with metricsHandlersLock held
+func (s *Server) stopMetricsHandlerLocked(metricName metricshandler.MetricName) error {
+	metricsHandler, found := s.findMetricsHandler(metricName)
+	if !found {
+		return errors.Errorf("Metrics handler %s isn't enabled", metricName)
+	}
+	if !metricsHandler.IsRunning() {
+		return errors.Errorf("Metrics handler %s isn't running", metricName)
+	}
+
+	if err := metricsHandler.Stop(); err != nil {
+		return errors.Wrap(err, "Failed stopping metrics handler")
+	}
+	metricsHandler.UnregisterMetrics(s.registry)
+	return nil
+}
+
+func (s *Server) setMetricsHandlerPollInterval(metricName metricshandler.MetricName, req *http.Request) error {
+	var body pollIntervalRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		return errors.Wrap(err, "Failed to decode request body")
+	}
+	interval, err := time.ParseDuration(body.Interval)
+	if err != nil {
+		return errors.Wrap(err, "Failed to parse poll interval")
+	}
+
+	metricsHandler, found := s.getMetricsHandler(metricName)
+	if !found {
+		return errors.Errorf("Metrics handler %s isn't enabled", metricName)
+	}
+	return metricsHandler.SetPollInterval(interval)
+}
+
+func (s *Server) writeJSON(res http.ResponseWriter, statusCode int, body interface{}) {
+	encodedBody, err := json.MarshalIndent(body, "", "  ")
+	if err != nil {
+		s.logger.WarnWith("Failed to encode response", "err", err.Error())
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(statusCode)
+	if _, err := res.Write(encodedBody); err != nil {
+		s.logger.DebugWith("Failed to write response", "err", err.Error())
+	}
+}
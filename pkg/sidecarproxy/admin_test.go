@@ -0,0 +1,150 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sidecarproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/v3io/sidecar-proxy/pkg/common"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
+
+	"github.com/nuclio/logger"
+	"github.com/nuclio/loggerus"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestStartStopMetricsHandler(t *testing.T) {
+	upstream := newTestUpstream(t)
+	server := newTestServer(t, Configuration{UpstreamMetricsURL: upstream.URL + "/metrics"})
+
+	for _, iteration := range []string{"first start", "restart"} {
+		requireHandlerRequest(t, server, "/handlers/upstream_metrics/start", http.StatusOK)
+		metricsHandler, found := server.getMetricsHandler(metricshandler.UpstreamMetricsMetricName)
+		if !found {
+			t.Fatalf("%s: started handler isn't listed", iteration)
+		}
+		if err := metricsHandler.Probe(); err != nil {
+			t.Fatalf("%s: failed to scrape: %v", iteration, err)
+		}
+		if numOfMetrics := gatherFamily(t, server.registry, "upstream_foo"); numOfMetrics != 1 {
+			t.Fatalf("%s: expected a single upstream_foo metric, got %d", iteration, numOfMetrics)
+		}
+
+		requireHandlerRequest(t, server, "/handlers/upstream_metrics/stop", http.StatusOK)
+		if numOfMetrics := gatherFamily(t, server.registry, "upstream_foo"); numOfMetrics != 0 {
+			t.Fatalf("%s: expected no upstream_foo metrics once stopped, got %d", iteration, numOfMetrics)
+		}
+		if numOfMetrics := gatherFamily(t, server.registry, "upstream_metrics_up"); numOfMetrics != 0 {
+			t.Fatalf("%s: expected no upstream_metrics_up metrics once stopped, got %d", iteration, numOfMetrics)
+		}
+	}
+
+	requireHandlerRequest(t, server, "/handlers/upstream_metrics/stop", http.StatusBadRequest)
+}
+
+func TestFailedStartIsntListed(t *testing.T) {
+	upstream := newTestUpstream(t)
+	server := newTestServer(t, Configuration{UpstreamMetricsURL: upstream.URL + "/metrics"})
+
+	// a metric named like one of the handler's fails registering its metrics
+	server.registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: string(metricshandler.UpstreamMetricsDroppedFamiliesMetricName),
+		Help: "Conflicting",
+	}))
+
+	requireHandlerRequest(t, server, "/handlers/upstream_metrics/start", http.StatusBadRequest)
+	if _, found := server.getMetricsHandler(metricshandler.UpstreamMetricsMetricName); found {
+		t.Fatalf("Handler that failed to start is listed")
+	}
+
+	recorder := httptest.NewRecorder()
+	server.onListHandlers(recorder, httptest.NewRequest(http.MethodGet, "/handlers", nil))
+	var statuses []metricshandler.Status
+	if err := json.Unmarshal(recorder.Body.Bytes(), &statuses); err != nil {
+		t.Fatalf("Failed to decode handlers: %v", err)
+	}
+	for _, status := range statuses {
+		if status.Name == metricshandler.UpstreamMetricsMetricName {
+			t.Fatalf("Handler that failed to start is listed in /handlers")
+		}
+	}
+
+	// the metric registered before the failing one was unregistered
+	if numOfMetrics := gatherFamily(t, server.registry, "upstream_metrics_up"); numOfMetrics != 0 {
+		t.Fatalf("Expected no upstream_metrics_up metrics, got %d", numOfMetrics)
+	}
+}
+
+// newTestServer creates a server forwarding to an unused address, that isn't started. its logger's level can be
+// changed, as reloading requires
+func newTestServer(t *testing.T, configuration Configuration) *Server {
+	loggerInstance, err := loggerus.NewLoggerusForTests("test")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	configuration.ListenAddress = "127.0.0.1:0"
+	configuration.ForwardAddress = "127.0.0.1:1"
+	server, err := NewServer(common.NewLeveledLogger(loggerInstance, logger.LevelInfo), configuration)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	return server
+}
+
+// newTestUpstream serves a single gauge on /metrics
+func newTestUpstream(t *testing.T) *httptest.Server {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write([]byte("# TYPE upstream_foo gauge\nupstream_foo 1\n")) // nolint: errcheck
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+func requireHandlerRequest(t *testing.T, server *Server, path string, expectedStatusCode int) {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	server.onHandler(recorder, httptest.NewRequest(http.MethodPost, path, nil))
+	if recorder.Code != expectedStatusCode {
+		t.Fatalf("Expected %s to respond with %d, got %d: %s",
+			path,
+			expectedStatusCode,
+			recorder.Code,
+			strings.TrimSpace(recorder.Body.String()))
+	}
+}
+
+// gatherFamily gathers the registry, failing if gathering does, and returns the number of metrics in the family
+func gatherFamily(t *testing.T, registry *prometheus.Registry, familyName string) int {
+	t.Helper()
+
+	metricFamilies, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %v", err)
+	}
+	for _, metricFamily := range metricFamilies {
+		if metricFamily.GetName() == familyName {
+			return len(metricFamily.GetMetric())
+		}
+	}
+	return 0
+}
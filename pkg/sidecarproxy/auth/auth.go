@@ -0,0 +1,152 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package auth
+
+import (
+	"net/http"
+
+	"github.com/v3io/sidecar-proxy/pkg/common"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/forwarded"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metriclabels"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const realm = `realm="sidecar-proxy"`
+
+// Create returns the authenticator of the configured mode, or nil if authentication is disabled
+func Create(logger logger.Logger, configuration Configuration) (Authenticator, error) {
+	switch configuration.Mode {
+	case "", NoneMode:
+		return nil, nil
+	case BearerMode:
+		return newBearerAuthenticator(configuration)
+	case BasicMode:
+		return newBasicAuthenticator(configuration)
+	case JWTMode:
+		return newJWTAuthenticator(logger, configuration)
+	default:
+		return nil, errors.Errorf("Unknown auth mode: %s", configuration.Mode)
+	}
+}
+
+// NewFailuresCounter creates the counter gates report rejected requests to. It is shared by all gates, which are
+// told apart by the "endpoint" label
+func NewFailuresCounter(metricNamespace string,
+	metricSubsystem string,
+	metricLabels *metriclabels.LabelSet) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricNamespace,
+		Subsystem: metricSubsystem,
+		Name:      "num_of_auth_failures",
+		Help:      "Total number of requests rejected by authentication.",
+	}, metricLabels.Names("endpoint", "reason"))
+}
+
+// Gate rejects requests that fail authentication before they reach the wrapped handler
+type Gate struct {
+	logger            logger.Logger
+	mode              Mode
+	authenticator     Authenticator
+	passAuthorization bool
+	endpoint          string
+	failuresCounter   *prometheus.CounterVec
+	labels            prometheus.Labels
+}
+
+func NewGate(logger logger.Logger,
+	configuration Configuration,
+	endpoint string,
+	failuresCounter *prometheus.CounterVec,
+	metricLabels *metriclabels.LabelSet) (*Gate, error) {
+
+	authenticator, err := Create(logger, configuration)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to create authenticator for endpoint: %s", endpoint)
+	}
+
+	return &Gate{
+		logger:            logger.GetChild("auth"),
+		mode:              configuration.Mode,
+		authenticator:     authenticator,
+		passAuthorization: configuration.PassAuthorization,
+		endpoint:          endpoint,
+		failuresCounter:   failuresCounter,
+		labels:            metricLabels.Labels(prometheus.Labels{"endpoint": endpoint}),
+	}, nil
+}
+
+// Wrap returns a handler that authenticates requests before passing them to the given handler, without their
+// Authorization header unless configured to pass it. Requests to skipPaths are passed through as is (e.g. endpoints
+// that are protected by a gate of their own)
+func (g *Gate) Wrap(handler http.Handler, skipPaths ...string) http.Handler {
+	if g.authenticator == nil {
+		return handler
+	}
+
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if common.StringInSlice(req.URL.Path, skipPaths) {
+			handler.ServeHTTP(res, req)
+			return
+		}
+
+		if err := g.authenticator.Authenticate(req); err != nil {
+			g.reject(res, req, err)
+			return
+		}
+
+		// the credentials are the proxy's, the upstream mustn't be able to replay them
+		if !g.passAuthorization {
+			req.Header.Del("Authorization")
+		}
+
+		handler.ServeHTTP(res, req)
+	})
+}
+
+func (g *Gate) reject(res http.ResponseWriter, req *http.Request, err error) {
+	reason := InvalidCredentialsFailureReason
+	if failure, ok := err.(*Failure); ok {
+		reason = failure.Reason
+	}
+
+	g.logger.DebugWithCtx(req.Context(), "Rejecting unauthenticated request",
+		"endpoint", g.endpoint,
+		"from", forwarded.ClientIP(req),
+		"uri", req.RequestURI,
+		"reason", reason,
+		"err", err.Error())
+
+	labels := prometheus.Labels{"reason": string(reason)}
+	for labelName, labelValue := range g.labels {
+		labels[labelName] = labelValue
+	}
+	g.failuresCounter.With(labels).Inc()
+
+	if reason == ForbiddenFailureReason {
+		res.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if g.mode == BasicMode {
+		res.Header().Set("WWW-Authenticate", "Basic "+realm)
+	} else {
+		res.Header().Set("WWW-Authenticate", "Bearer "+realm)
+	}
+	res.WriteHeader(http.StatusUnauthorized)
+}
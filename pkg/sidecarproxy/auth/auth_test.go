@@ -0,0 +1,93 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metriclabels"
+
+	"github.com/nuclio/loggerus"
+)
+
+func TestGate(t *testing.T) {
+	logger, err := loggerus.NewLoggerusForTests("test")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	metricLabels, err := metriclabels.NewLabelSet(metriclabels.Configuration{}, "namespace", "service", "instance")
+	if err != nil {
+		t.Fatalf("Failed to create metric labels: %v", err)
+	}
+
+	for _, testCase := range []struct {
+		name                  string
+		authorization         string
+		passAuthorization     bool
+		expectedStatusCode    int
+		expectedAuthorization string
+	}{
+		{
+			name:               "authenticated request without its authorization",
+			authorization:      "Bearer secret",
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:                  "authenticated request with its authorization passed",
+			authorization:         "Bearer secret",
+			passAuthorization:     true,
+			expectedStatusCode:    http.StatusOK,
+			expectedAuthorization: "Bearer secret",
+		},
+		{
+			name:               "rejected request",
+			authorization:      "Bearer wrong",
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			gate, err := NewGate(logger, Configuration{
+				Mode:              BearerMode,
+				Tokens:            []string{"secret"},
+				PassAuthorization: testCase.passAuthorization,
+			}, "upstream", NewFailuresCounter("", "", metricLabels), metricLabels)
+			if err != nil {
+				t.Fatalf("Failed to create gate: %v", err)
+			}
+
+			var forwardedAuthorization string
+			handler := gate.Wrap(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				forwardedAuthorization = req.Header.Get("Authorization")
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", testCase.authorization)
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			if recorder.Code != testCase.expectedStatusCode {
+				t.Fatalf("Expected status %d, got %d", testCase.expectedStatusCode, recorder.Code)
+			}
+			if forwardedAuthorization != testCase.expectedAuthorization {
+				t.Fatalf("Expected forwarded authorization %q, got %q",
+					testCase.expectedAuthorization,
+					forwardedAuthorization)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1" // nolint: gosec
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/nuclio/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const shaHashPrefix = "{SHA}"
+
+type basicAuthenticator struct {
+	hashes map[string]string
+}
+
+func newBasicAuthenticator(configuration Configuration) (*basicAuthenticator, error) {
+	if configuration.HtpasswdFile == "" {
+		return nil, errors.New("Basic auth mode requires an htpasswd file")
+	}
+
+	hashes, err := readHtpasswdFile(configuration.HtpasswdFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read htpasswd file")
+	}
+
+	return &basicAuthenticator{hashes: hashes}, nil
+}
+
+func (b *basicAuthenticator) Authenticate(req *http.Request) error {
+	username, password, found := req.BasicAuth()
+	if !found {
+		return newFailure(MissingCredentialsFailureReason, nil)
+	}
+
+	hash, found := b.hashes[username]
+	if !found {
+		return newFailure(InvalidCredentialsFailureReason, errors.Errorf("Unknown user: %s", username))
+	}
+
+	if !passwordMatches(hash, password) {
+		return newFailure(InvalidCredentialsFailureReason, errors.Errorf("Wrong password for user: %s", username))
+	}
+
+	return nil
+}
+
+func readHtpasswdFile(filePath string) (map[string]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to open file: %s", filePath)
+	}
+	defer file.Close() // nolint: errcheck
+
+	hashes := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		username, hash, found := strings.Cut(line, ":")
+		if !found || username == "" {
+			return nil, errors.Errorf("Malformed line %d in %s", lineNumber, filePath)
+		}
+		if !strings.HasPrefix(hash, "$2") && !strings.HasPrefix(hash, shaHashPrefix) {
+			return nil, errors.Errorf("Unsupported hash for user %s (only bcrypt and {SHA} are supported)", username)
+		}
+		hashes[username] = hash
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "Failed to scan file: %s", filePath)
+	}
+
+	return hashes, nil
+}
+
+func passwordMatches(hash string, password string) bool {
+	if strings.HasPrefix(hash, shaHashPrefix) {
+		passwordHash := sha1.Sum([]byte(password)) // nolint: gosec
+		encodedPasswordHash := base64.StdEncoding.EncodeToString(passwordHash[:])
+		return subtle.ConstantTimeCompare([]byte(encodedPasswordHash), []byte(hash[len(shaHashPrefix):])) == 1
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
@@ -0,0 +1,188 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package auth
+
+import (
+	"crypto/sha1" // nolint: gosec
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBasicAuthenticator(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("bcrypt-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	shaHash := sha1.Sum([]byte("sha-password")) // nolint: gosec
+
+	htpasswdFilePath := writeTestFile(t, "htpasswd", strings.Join([]string{
+		"# users",
+		"",
+		"alice:" + string(bcryptHash),
+		"  bob:{SHA}" + base64.StdEncoding.EncodeToString(shaHash[:]) + "  ",
+	}, "\n"))
+
+	authenticator, err := newBasicAuthenticator(Configuration{Mode: BasicMode, HtpasswdFile: htpasswdFilePath})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+
+	for _, testCase := range []struct {
+		name           string
+		setCredentials bool
+		username       string
+		password       string
+		expectedReason FailureReason
+	}{
+		{name: "bcrypt", setCredentials: true, username: "alice", password: "bcrypt-password"},
+		{name: "SHA", setCredentials: true, username: "bob", password: "sha-password"},
+		{
+			name:           "wrong bcrypt password",
+			setCredentials: true,
+			username:       "alice",
+			password:       "sha-password",
+			expectedReason: InvalidCredentialsFailureReason,
+		},
+		{
+			name:           "wrong SHA password",
+			setCredentials: true,
+			username:       "bob",
+			password:       "bcrypt-password",
+			expectedReason: InvalidCredentialsFailureReason,
+		},
+		{
+			name:           "unknown user",
+			setCredentials: true,
+			username:       "carol",
+			password:       "bcrypt-password",
+			expectedReason: InvalidCredentialsFailureReason,
+		},
+		{
+			name:           "comment isn't a user",
+			setCredentials: true,
+			username:       "# users",
+			expectedReason: InvalidCredentialsFailureReason,
+		},
+		{name: "no credentials", expectedReason: MissingCredentialsFailureReason},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if testCase.setCredentials {
+				req.SetBasicAuth(testCase.username, testCase.password)
+			}
+			requireFailureReason(t, authenticator.Authenticate(req), testCase.expectedReason)
+		})
+	}
+}
+
+func TestReadHtpasswdFile(t *testing.T) {
+	for _, testCase := range []struct {
+		name          string
+		contents      string
+		expectedUsers []string
+		expectedError string
+	}{
+		{
+			name:          "bcrypt variants",
+			contents:      "a:$2y$05$abc\nb:$2a$05$abc\nc:$2b$05$abc\n",
+			expectedUsers: []string{"a", "b", "c"},
+		},
+		{
+			name:          "password with a colon",
+			contents:      "a:{SHA}ab:c\n",
+			expectedUsers: []string{"a"},
+		},
+		{
+			name:          "missing hash",
+			contents:      "# users\na\n",
+			expectedError: "Malformed line 2",
+		},
+		{
+			name:          "missing username",
+			contents:      ":$2y$05$abc\n",
+			expectedError: "Malformed line 1",
+		},
+		{
+			name:          "MD5 hash",
+			contents:      "a:$apr1$abc$def\n",
+			expectedError: "Unsupported hash for user a",
+		},
+		{
+			name:          "plain text password",
+			contents:      "a:password\n",
+			expectedError: "Unsupported hash for user a",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			hashes, err := readHtpasswdFile(writeTestFile(t, "htpasswd", testCase.contents))
+			if testCase.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), testCase.expectedError) {
+					t.Fatalf("Expected error containing %q, got: %v", testCase.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(hashes) != len(testCase.expectedUsers) {
+				t.Fatalf("Expected users %v, got %v", testCase.expectedUsers, hashes)
+			}
+			for _, username := range testCase.expectedUsers {
+				if _, found := hashes[username]; !found {
+					t.Errorf("Expected user %s, got %v", username, hashes)
+				}
+			}
+		})
+	}
+}
+
+func writeTestFile(t *testing.T, name string, contents string) string {
+	t.Helper()
+
+	filePath := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(filePath, []byte(contents), 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return filePath
+}
+
+// requireFailureReason fails the test unless err is a failure of the expected reason, or nil if none is expected
+func requireFailureReason(t *testing.T, err error, expectedReason FailureReason) {
+	t.Helper()
+
+	if expectedReason == "" {
+		if err != nil {
+			t.Fatalf("Expected authentication to succeed, got: %v", err)
+		}
+		return
+	}
+
+	var failure *Failure
+	if !errors.As(err, &failure) {
+		t.Fatalf("Expected a %s failure, got: %v", expectedReason, err)
+	}
+	if failure.Reason != expectedReason {
+		t.Fatalf("Expected a %s failure, got: %v", expectedReason, err)
+	}
+}
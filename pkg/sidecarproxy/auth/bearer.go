@@ -0,0 +1,79 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/nuclio/errors"
+)
+
+type bearerAuthenticator struct {
+	tokens []string
+}
+
+func newBearerAuthenticator(configuration Configuration) (*bearerAuthenticator, error) {
+	tokens := append([]string{}, configuration.Tokens...)
+
+	if configuration.TokensFile != "" {
+		tokensFileContents, err := os.ReadFile(configuration.TokensFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to read tokens file: %s", configuration.TokensFile)
+		}
+		for _, line := range strings.Split(string(tokensFileContents), "\n") {
+			if token := strings.TrimSpace(line); token != "" && !strings.HasPrefix(token, "#") {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+
+	if len(tokens) == 0 {
+		return nil, errors.New("Bearer auth mode requires at least one token")
+	}
+
+	return &bearerAuthenticator{tokens: tokens}, nil
+}
+
+func (b *bearerAuthenticator) Authenticate(req *http.Request) error {
+	token, found := getBearerToken(req)
+	if !found {
+		return newFailure(MissingCredentialsFailureReason, nil)
+	}
+
+	// compare against all tokens in constant time so the response time doesn't reveal which token almost matched
+	matched := 0
+	for _, validToken := range b.tokens {
+		matched |= subtle.ConstantTimeCompare([]byte(token), []byte(validToken))
+	}
+	if matched != 1 {
+		return newFailure(InvalidCredentialsFailureReason, errors.New("Unknown bearer token"))
+	}
+
+	return nil
+}
+
+func getBearerToken(req *http.Request) (string, bool) {
+	const prefix = "bearer "
+
+	authorization := req.Header.Get("Authorization")
+	if len(authorization) <= len(prefix) || !strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(authorization[len(prefix):]), true
+}
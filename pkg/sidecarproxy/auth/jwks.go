@@ -0,0 +1,324 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+)
+
+// minimal interval between two JWKS reloads triggered by an unknown key ID
+const minJWKSReloadInterval = 10 * time.Second
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+	Alg     string `json:"alg"`
+}
+
+// keySet holds the public keys of a JWKS, reloading it periodically and when a token is signed by an unknown key
+type keySet struct {
+	logger          logger.Logger
+	source          string
+	load            func() ([]byte, error)
+	refreshInterval time.Duration
+
+	// serializes reloads, which are done without holding lock so verification isn't blocked on fetching the JWKS
+	reloadLock sync.Mutex
+
+	lock         sync.RWMutex
+	keys         map[string]crypto.PublicKey
+	lastLoadTime time.Time
+}
+
+func newKeySet(logger logger.Logger, configuration Configuration) (*keySet, error) {
+	newKeySet := keySet{
+		logger:          logger,
+		refreshInterval: configuration.JWKSRefreshInterval,
+	}
+
+	switch {
+	case configuration.JWKSFile != "":
+		newKeySet.source = configuration.JWKSFile
+		newKeySet.load = func() ([]byte, error) {
+			return os.ReadFile(configuration.JWKSFile)
+		}
+	case configuration.JWKSURL != "":
+		newKeySet.source = configuration.JWKSURL
+		newKeySet.load = func() ([]byte, error) {
+			return fetchJWKS(configuration.JWKSURL)
+		}
+	default:
+		return nil, errors.New("JWT auth mode requires a JWKS file or URL")
+	}
+
+	if err := newKeySet.reload(); err != nil {
+		return nil, errors.Wrap(err, "Failed to load JWKS")
+	}
+
+	return &newKeySet, nil
+}
+
+func (k *keySet) getKey(keyID string) (crypto.PublicKey, error) {
+	key, found := k.lookupKey(keyID)
+	if found {
+
+		// refresh in the background, the key we have is good until then
+		if k.refreshInterval > 0 && k.sinceLastLoad() > k.refreshInterval {
+			k.reloadInBackground()
+		}
+		return key, nil
+	}
+
+	// the key may have been rotated in, but don't let tokens with made up key IDs hammer the source
+	k.reloadIfStale(minJWKSReloadInterval)
+
+	key, found = k.lookupKey(keyID)
+	if !found {
+		return nil, errors.Errorf("Unknown key ID: %s", keyID)
+	}
+	return key, nil
+}
+
+func (k *keySet) lookupKey(keyID string) (crypto.PublicKey, bool) {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+
+	key, found := k.keys[keyID]
+	return key, found
+}
+
+func (k *keySet) sinceLastLoad() time.Duration {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+
+	return time.Since(k.lastLoadTime)
+}
+
+// reloadInBackground starts a reload unless one is already in progress
+func (k *keySet) reloadInBackground() {
+	if !k.reloadLock.TryLock() {
+		return
+	}
+
+	go func() {
+		defer k.reloadLock.Unlock()
+
+		if k.sinceLastLoad() > k.refreshInterval {
+			k.reloadOrWarn()
+		}
+	}()
+}
+
+// reloadIfStale reloads unless the last (attempted) load is more recent than minInterval, waiting for a reload
+// that's already in progress rather than starting another one
+func (k *keySet) reloadIfStale(minInterval time.Duration) {
+	k.reloadLock.Lock()
+	defer k.reloadLock.Unlock()
+
+	if k.sinceLastLoad() > minInterval {
+		k.reloadOrWarn()
+	}
+}
+
+func (k *keySet) reloadOrWarn() {
+	if err := k.reload(); err != nil {
+
+		// keep serving the keys we have, the source may be temporarily unavailable
+		k.logger.WarnWith("Failed to reload JWKS", "source", k.source, "err", errors.GetErrorStackString(err, 10))
+	}
+}
+
+// reload loads the keys and swaps them in. Must be called with reloadLock held (or before the key set is shared)
+func (k *keySet) reload() error {
+	k.lock.Lock()
+	k.lastLoadTime = time.Now()
+	k.lock.Unlock()
+
+	contents, err := k.load()
+	if err != nil {
+		return errors.Wrapf(err, "Failed to load JWKS from %s", k.source)
+	}
+
+	keys, err := parseJWKS(k.logger, contents)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to parse JWKS from %s", k.source)
+	}
+
+	k.lock.Lock()
+	k.keys = keys
+	k.lock.Unlock()
+
+	k.logger.DebugWith("Loaded JWKS", "source", k.source, "numOfKeys", len(keys))
+	return nil
+}
+
+func fetchJWKS(url string) ([]byte, error) {
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to send request to JWKS URL: %s", url)
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("Unexpected status code from JWKS URL: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read response body")
+	}
+	return body, nil
+}
+
+func parseJWKS(logger logger.Logger, contents []byte) (map[string]crypto.PublicKey, error) {
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(contents, &jwks); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal JWKS")
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, webKey := range jwks.Keys {
+
+		// keys meant for encryption can't verify signatures
+		if webKey.Use != "" && webKey.Use != "sig" {
+			continue
+		}
+
+		// a set may hold keys for algorithms we can't verify, which shouldn't take the others down with them
+		if err := webKey.checkSupported(); err != nil {
+			logger.WarnWith("Skipping unsupported JWKS key", "keyID", webKey.KeyID, "err", err.Error())
+			continue
+		}
+
+		publicKey, err := webKey.publicKey()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse key: %s", webKey.KeyID)
+		}
+		keys[webKey.KeyID] = publicKey
+	}
+
+	return keys, nil
+}
+
+// checkSupported returns an error if the key's type, curve or algorithm can't be used to verify tokens
+func (j *jsonWebKey) checkSupported() error {
+	if j.Alg != "" && !slices.Contains(supportedSigningMethods, j.Alg) {
+		return errors.Errorf("Unsupported algorithm: %s", j.Alg)
+	}
+
+	switch j.KeyType {
+	case "RSA":
+		return nil
+	case "EC":
+		if j.Curve != "P-256" && j.Curve != "P-384" && j.Curve != "P-521" {
+			return errors.Errorf("Unsupported curve: %s", j.Curve)
+		}
+		return nil
+	case "OKP":
+		if j.Curve != "Ed25519" {
+			return errors.Errorf("Unsupported curve: %s", j.Curve)
+		}
+		return nil
+	default:
+		return errors.Errorf("Unsupported key type: %s", j.KeyType)
+	}
+}
+
+func (j *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch j.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(j.N)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to decode modulus")
+		}
+		e, err := decodeBigInt(j.E)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to decode exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch j.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf("Unsupported curve: %s", j.Curve)
+		}
+		x, err := decodeBigInt(j.X)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to decode x coordinate")
+		}
+		y, err := decodeBigInt(j.Y)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to decode y coordinate")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		if j.Curve != "Ed25519" {
+			return nil, errors.Errorf("Unsupported curve: %s", j.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to decode public key")
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.Errorf("Invalid Ed25519 public key size: %d", len(x))
+		}
+		return ed25519.PublicKey(x), nil
+
+	default:
+		return nil, errors.Errorf("Unsupported key type: %s", j.KeyType)
+	}
+}
+
+func decodeBigInt(encoded string) (*big.Int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(decoded), nil
+}
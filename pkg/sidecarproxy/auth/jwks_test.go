@@ -0,0 +1,217 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package auth
+
+import (
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nuclio/loggerus"
+)
+
+func TestParseJWKS(t *testing.T) {
+	keys := newTestKeys(t)
+	validRSAKey := map[string]string{
+		"kty": "RSA",
+		"kid": "rsa",
+		"n":   "AQAB",
+		"e":   "AQAB",
+	}
+	withFields := func(key map[string]string, fields map[string]string) map[string]string {
+		newKey := map[string]string{}
+		for name, value := range key {
+			newKey[name] = value
+		}
+		for name, value := range fields {
+			newKey[name] = value
+		}
+		return newKey
+	}
+
+	for _, testCase := range []struct {
+		name           string
+		jwks           string
+		expectedKeyIDs []string
+		expectedError  string
+	}{
+		{
+			name:           "supported keys",
+			jwks:           keys.jwks(t),
+			expectedKeyIDs: []string{"ec", "ed25519", "rsa"},
+		},
+		{
+			name: "unsupported keys are skipped",
+			jwks: marshalJWKS(t, []map[string]string{
+				validRSAKey,
+				{"kty": "oct", "kid": "symmetric", "k": "c2VjcmV0"},
+				withFields(validRSAKey, map[string]string{"kid": "hmac", "alg": "HS256"}),
+				withFields(validRSAKey, map[string]string{"kid": "rsa1_5", "alg": "RSA1_5"}),
+				{"kty": "EC", "kid": "p192", "crv": "P-192", "x": "AQAB", "y": "AQAB"},
+				{"kty": "OKP", "kid": "x25519", "crv": "X25519", "x": "AQAB"},
+			}),
+			expectedKeyIDs: []string{"rsa"},
+		},
+		{
+			name: "supported algorithm",
+			jwks: marshalJWKS(t, []map[string]string{
+				withFields(validRSAKey, map[string]string{"alg": "RS256"}),
+			}),
+			expectedKeyIDs: []string{"rsa"},
+		},
+		{
+			name: "encryption keys are skipped",
+			jwks: marshalJWKS(t, []map[string]string{
+				withFields(validRSAKey, map[string]string{"kid": "encryption", "use": "enc"}),
+			}),
+		},
+		{
+			name: "malformed supported key",
+			jwks: marshalJWKS(t, []map[string]string{
+				withFields(validRSAKey, map[string]string{"n": "not base64!"}),
+			}),
+			expectedError: "Failed to parse key: rsa",
+		},
+		{
+			name: "Ed25519 key of the wrong size",
+			jwks: marshalJWKS(t, []map[string]string{
+				{"kty": "OKP", "kid": "ed25519", "crv": "Ed25519", "x": "AQAB"},
+			}),
+			expectedError: "Failed to parse key: ed25519",
+		},
+		{
+			name:          "not JSON",
+			jwks:          "keys",
+			expectedError: "Failed to unmarshal JWKS",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			logger, err := loggerus.NewLoggerusForTests("test")
+			if err != nil {
+				t.Fatalf("Failed to create logger: %v", err)
+			}
+
+			parsedKeys, err := parseJWKS(logger, []byte(testCase.jwks))
+			if testCase.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), testCase.expectedError) {
+					t.Fatalf("Expected error containing %q, got: %v", testCase.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			keyIDs := []string{}
+			for keyID := range parsedKeys {
+				keyIDs = append(keyIDs, keyID)
+			}
+			sort.Strings(keyIDs)
+			if strings.Join(keyIDs, ",") != strings.Join(testCase.expectedKeyIDs, ",") {
+				t.Fatalf("Expected keys %v, got %v", testCase.expectedKeyIDs, keyIDs)
+			}
+		})
+	}
+}
+
+func TestKeySetReloadsUnknownKeysAtMostOnceAnInterval(t *testing.T) {
+	keySet, numOfLoads, releaseLoad := newTestKeySet(t, 0)
+	keySet.lastLoadTime = time.Now().Add(-time.Hour)
+	close(releaseLoad)
+
+	for attempt := 0; attempt < 3; attempt++ {
+		if _, err := keySet.getKey("unknown"); err == nil {
+			t.Fatalf("Expected an unknown key ID to fail")
+		}
+	}
+
+	if loads := numOfLoads.Load(); loads != 1 {
+		t.Fatalf("Expected a single reload, got %d", loads)
+	}
+}
+
+func TestKeySetRefreshDoesntBlockVerification(t *testing.T) {
+	keySet, numOfLoads, releaseLoad := newTestKeySet(t, time.Minute)
+	keySet.lastLoadTime = time.Now().Add(-time.Hour)
+
+	// the refresh is due, but the known key is returned while the (blocked) reload runs in the background
+	for attempt := 0; attempt < 3; attempt++ {
+		keyChan := make(chan error, 1)
+		go func() {
+			_, err := keySet.getKey("rsa")
+			keyChan <- err
+		}()
+
+		select {
+		case err := <-keyChan:
+			if err != nil {
+				t.Fatalf("Failed to get key: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Getting a known key blocked on the refresh")
+		}
+	}
+
+	close(releaseLoad)
+	deadline := time.Now().Add(5 * time.Second)
+	for numOfLoads.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// a single refresh ran, however many verifications found it due
+	keySet.reloadLock.Lock()
+	defer keySet.reloadLock.Unlock()
+	if loads := numOfLoads.Load(); loads != 1 {
+		t.Fatalf("Expected a single reload, got %d", loads)
+	}
+}
+
+// newTestKeySet returns a key set holding an "rsa" key, whose reloads (after the first load) are counted and wait
+// for releaseLoad to be closed
+func newTestKeySet(t *testing.T, refreshInterval time.Duration) (*keySet, *atomic.Int32, chan struct{}) {
+	t.Helper()
+
+	logger, err := loggerus.NewLoggerusForTests("test")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	jwks := []byte(newTestKeys(t).jwks(t))
+	numOfLoads := &atomic.Int32{}
+	releaseLoad := make(chan struct{})
+	loaded := false
+
+	newKeySet := &keySet{
+		logger:          logger,
+		source:          "test",
+		refreshInterval: refreshInterval,
+		load: func() ([]byte, error) {
+			if loaded {
+				<-releaseLoad
+				numOfLoads.Add(1)
+			}
+			loaded = true
+			return jwks, nil
+		},
+	}
+	if err := newKeySet.reload(); err != nil {
+		t.Fatalf("Failed to load key set: %v", err)
+	}
+
+	return newKeySet, numOfLoads, releaseLoad
+}
@@ -0,0 +1,147 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+)
+
+// signing methods tokens may be signed with (keys declaring any other algorithm are skipped)
+var supportedSigningMethods = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+type claimRule struct {
+	path  []string
+	value string
+}
+
+type jwtAuthenticator struct {
+	keySet     *keySet
+	parser     *jwt.Parser
+	issuer     string
+	audience   string
+	claimRules []claimRule
+}
+
+func newJWTAuthenticator(logger logger.Logger, configuration Configuration) (*jwtAuthenticator, error) {
+	claimRules, err := parseClaimRules(configuration.ClaimRules)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse claim rules")
+	}
+
+	keySet, err := newKeySet(logger, configuration)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create key set")
+	}
+
+	return &jwtAuthenticator{
+		keySet:     keySet,
+		parser:     jwt.NewParser(jwt.WithValidMethods(supportedSigningMethods)),
+		issuer:     configuration.Issuer,
+		audience:   configuration.Audience,
+		claimRules: claimRules,
+	}, nil
+}
+
+func (j *jwtAuthenticator) Authenticate(req *http.Request) error {
+	tokenString, found := getBearerToken(req)
+	if !found {
+		return newFailure(MissingCredentialsFailureReason, nil)
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := j.parser.ParseWithClaims(tokenString, claims, j.getKey); err != nil {
+		return newFailure(InvalidCredentialsFailureReason, err)
+	}
+
+	// the parser only checks exp if it's set, and a token that never expires can't be revoked
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return newFailure(InvalidCredentialsFailureReason, errors.New("Token has no expiration time"))
+	}
+
+	if j.issuer != "" && !claims.VerifyIssuer(j.issuer, true) {
+		return newFailure(InvalidCredentialsFailureReason, errors.Errorf("Unexpected issuer: %v", claims["iss"]))
+	}
+
+	if j.audience != "" && !claims.VerifyAudience(j.audience, true) {
+		return newFailure(InvalidCredentialsFailureReason, errors.Errorf("Unexpected audience: %v", claims["aud"]))
+	}
+
+	for _, rule := range j.claimRules {
+		if !rule.matches(claims) {
+			return newFailure(ForbiddenFailureReason,
+				errors.Errorf("Claim %s does not match %s", strings.Join(rule.path, "."), rule.value))
+		}
+	}
+
+	return nil
+}
+
+func (j *jwtAuthenticator) getKey(token *jwt.Token) (interface{}, error) {
+	keyID, _ := token.Header["kid"].(string)
+	return j.keySet.getKey(keyID)
+}
+
+func parseClaimRules(claimRuleStrs []string) ([]claimRule, error) {
+	var claimRules []claimRule
+	for _, claimRuleStr := range claimRuleStrs {
+		claim, value, found := strings.Cut(claimRuleStr, "=")
+		if !found || claim == "" {
+			return nil, errors.Errorf("Claim rule must be in the form claim=value: %s", claimRuleStr)
+		}
+		claimRules = append(claimRules, claimRule{
+			path:  strings.Split(claim, "."),
+			value: value,
+		})
+	}
+	return claimRules, nil
+}
+
+func (c *claimRule) matches(claims jwt.MapClaims) bool {
+	var current interface{} = map[string]interface{}(claims)
+	for _, key := range c.path {
+		currentMap, ok := current.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if current, ok = currentMap[key]; !ok {
+			return false
+		}
+	}
+
+	// array claims (e.g. groups) match if any of their values match
+	if values, ok := current.([]interface{}); ok {
+		for _, value := range values {
+			if fmt.Sprint(value) == c.value {
+				return true
+			}
+		}
+		return false
+	}
+
+	return fmt.Sprint(current) == c.value
+}
@@ -0,0 +1,301 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/nuclio/loggerus"
+)
+
+// testKeys are the private keys of the test JWKS
+type testKeys struct {
+	rsaKey     *rsa.PrivateKey
+	ecdsaKey   *ecdsa.PrivateKey
+	ed25519Key ed25519.PrivateKey
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	keys := newTestKeys(t)
+	jwksFilePath := writeTestFile(t, "jwks.json", keys.jwks(t))
+
+	logger, err := loggerus.NewLoggerusForTests("test")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	authenticator, err := newJWTAuthenticator(logger, Configuration{
+		Mode:     JWTMode,
+		JWKSFile: jwksFilePath,
+		Issuer:   "https://issuer.example.com",
+		Audience: "sidecar-proxy",
+		ClaimRules: []string{
+			"groups=admins",
+			"realm_access.role=owner",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":          "https://issuer.example.com",
+			"aud":          []string{"other", "sidecar-proxy"},
+			"exp":          time.Now().Add(time.Hour).Unix(),
+			"groups":       []string{"users", "admins"},
+			"realm_access": map[string]interface{}{"role": "owner"},
+		}
+	}
+	withClaim := func(name string, value interface{}) jwt.MapClaims {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	for _, testCase := range []struct {
+		name           string
+		token          string
+		expectedReason FailureReason
+	}{
+		{name: "RS256", token: keys.sign(t, jwt.SigningMethodRS256, "rsa", validClaims())},
+		{name: "PS384", token: keys.sign(t, jwt.SigningMethodPS384, "rsa", validClaims())},
+		{name: "ES256", token: keys.sign(t, jwt.SigningMethodES256, "ec", validClaims())},
+		{name: "EdDSA", token: keys.sign(t, jwt.SigningMethodEdDSA, "ed25519", validClaims())},
+		{
+			name:           "no token",
+			expectedReason: MissingCredentialsFailureReason,
+		},
+		{
+			name:           "not a JWT",
+			token:          "not-a-jwt",
+			expectedReason: InvalidCredentialsFailureReason,
+		},
+		{
+			name:           "unknown key ID",
+			token:          keys.sign(t, jwt.SigningMethodRS256, "unknown", validClaims()),
+			expectedReason: InvalidCredentialsFailureReason,
+		},
+		{
+			name:           "signed by another key",
+			token:          keys.sign(t, jwt.SigningMethodES256, "rsa", validClaims()),
+			expectedReason: InvalidCredentialsFailureReason,
+		},
+		{
+			name:           "HMAC signed with the public key",
+			token:          hmacToken(t, keys.rsaKey.Public(), validClaims()),
+			expectedReason: InvalidCredentialsFailureReason,
+		},
+		{
+			name:           "tampered",
+			token:          keys.sign(t, jwt.SigningMethodRS256, "rsa", validClaims()) + "x",
+			expectedReason: InvalidCredentialsFailureReason,
+		},
+		{
+			name:           "expired",
+			token:          keys.sign(t, jwt.SigningMethodRS256, "rsa", withClaim("exp", time.Now().Add(-time.Minute).Unix())),
+			expectedReason: InvalidCredentialsFailureReason,
+		},
+		{
+			name:           "no expiration",
+			token:          keys.sign(t, jwt.SigningMethodRS256, "rsa", withClaim("exp", nil)),
+			expectedReason: InvalidCredentialsFailureReason,
+		},
+		{
+			name:           "wrong issuer",
+			token:          keys.sign(t, jwt.SigningMethodRS256, "rsa", withClaim("iss", "https://other.example.com")),
+			expectedReason: InvalidCredentialsFailureReason,
+		},
+		{
+			name:           "missing audience",
+			token:          keys.sign(t, jwt.SigningMethodRS256, "rsa", withClaim("aud", nil)),
+			expectedReason: InvalidCredentialsFailureReason,
+		},
+		{
+			name:           "array claim without the value",
+			token:          keys.sign(t, jwt.SigningMethodRS256, "rsa", withClaim("groups", []string{"users"})),
+			expectedReason: ForbiddenFailureReason,
+		},
+		{
+			name: "nested claim of another value",
+			token: keys.sign(t, jwt.SigningMethodRS256, "rsa",
+				withClaim("realm_access", map[string]string{"role": "viewer"})),
+			expectedReason: ForbiddenFailureReason,
+		},
+		{
+			name:           "nested claim that isn't an object",
+			token:          keys.sign(t, jwt.SigningMethodRS256, "rsa", withClaim("realm_access", "owner")),
+			expectedReason: ForbiddenFailureReason,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if testCase.token != "" {
+				req.Header.Set("Authorization", "Bearer "+testCase.token)
+			}
+			requireFailureReason(t, authenticator.Authenticate(req), testCase.expectedReason)
+		})
+	}
+}
+
+func TestParseClaimRules(t *testing.T) {
+	for _, testCase := range []struct {
+		claimRuleStr  string
+		expectedPath  []string
+		expectedValue string
+		expectedError bool
+	}{
+		{claimRuleStr: "groups=admins", expectedPath: []string{"groups"}, expectedValue: "admins"},
+		{claimRuleStr: "a.b.c=x=y", expectedPath: []string{"a", "b", "c"}, expectedValue: "x=y"},
+		{claimRuleStr: "email_verified=", expectedPath: []string{"email_verified"}, expectedValue: ""},
+		{claimRuleStr: "groups", expectedError: true},
+		{claimRuleStr: "=admins", expectedError: true},
+	} {
+		t.Run(testCase.claimRuleStr, func(t *testing.T) {
+			claimRules, err := parseClaimRules([]string{testCase.claimRuleStr})
+			if testCase.expectedError {
+				if err == nil {
+					t.Fatalf("Expected an error, got: %+v", claimRules)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(claimRules) != 1 ||
+				!slices.Equal(claimRules[0].path, testCase.expectedPath) ||
+				claimRules[0].value != testCase.expectedValue {
+				t.Fatalf("Unexpected claim rules: %+v", claimRules)
+			}
+		})
+	}
+}
+
+func newTestKeys(t *testing.T) *testKeys {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ECDSA key: %v", err)
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v", err)
+	}
+
+	return &testKeys{rsaKey: rsaKey, ecdsaKey: ecdsaKey, ed25519Key: ed25519Key}
+}
+
+// jwks returns the public keys as a JWKS, keyed "rsa", "ec" and "ed25519"
+func (k *testKeys) jwks(t *testing.T) string {
+	t.Helper()
+
+	encode := func(value *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(value.Bytes())
+	}
+	ed25519PublicKey := k.ed25519Key.Public().(ed25519.PublicKey)
+
+	return marshalJWKS(t, []map[string]string{
+		{
+			"kty": "RSA",
+			"kid": "rsa",
+			"use": "sig",
+			"n":   encode(k.rsaKey.N),
+			"e":   encode(big.NewInt(int64(k.rsaKey.E))),
+		},
+		{
+			"kty": "EC",
+			"kid": "ec",
+			"crv": "P-256",
+			"x":   encode(k.ecdsaKey.X),
+			"y":   encode(k.ecdsaKey.Y),
+		},
+		{
+			"kty": "OKP",
+			"kid": "ed25519",
+			"crv": "Ed25519",
+			"x":   base64.RawURLEncoding.EncodeToString(ed25519PublicKey),
+		},
+	})
+}
+
+// sign signs the claims with the key the signing method is of, setting the given key ID
+func (k *testKeys) sign(t *testing.T, signingMethod jwt.SigningMethod, keyID string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	var signingKey crypto.Signer
+	switch signingMethod.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		signingKey = k.rsaKey
+	case *jwt.SigningMethodECDSA:
+		signingKey = k.ecdsaKey
+	default:
+		signingKey = k.ed25519Key
+	}
+
+	token := jwt.NewWithClaims(signingMethod, claims)
+	token.Header["kid"] = keyID
+	signedToken, err := token.SignedString(signingKey)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signedToken
+}
+
+// hmacToken signs the claims with HS256, using the encoded public key as the secret
+func hmacToken(t *testing.T, publicKey crypto.PublicKey, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = "rsa"
+	signedToken, err := token.SignedString([]byte(publicKey.(*rsa.PublicKey).N.String()))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signedToken
+}
+
+func marshalJWKS(t *testing.T, keys []map[string]string) string {
+	t.Helper()
+
+	encodedJWKS, err := json.Marshal(map[string]interface{}{"keys": keys})
+	if err != nil {
+		t.Fatalf("Failed to marshal JWKS: %v", err)
+	}
+	return string(encodedJWKS)
+}
@@ -0,0 +1,159 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package auth
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/v3io/sidecar-proxy/pkg/common"
+
+	"github.com/nuclio/errors"
+)
+
+// Authenticator validates the credentials of an incoming request
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+type Mode string
+
+const (
+	NoneMode   Mode = "none"
+	BearerMode Mode = "bearer"
+	BasicMode  Mode = "basic"
+	JWTMode    Mode = "jwt"
+)
+
+func ParseMode(modeStr string) (Mode, error) {
+	switch modeStr {
+	case "", string(NoneMode):
+		return NoneMode, nil
+	case string(BearerMode):
+		return BearerMode, nil
+	case string(BasicMode):
+		return BasicMode, nil
+	case string(JWTMode):
+		return JWTMode, nil
+	default:
+		return "", errors.Errorf("Unknown auth mode: %s", modeStr)
+	}
+}
+
+type Configuration struct {
+	Mode Mode
+
+	// bearer mode - tokens given explicitly and/or read from a file (one per line)
+	Tokens     []string
+	TokensFile string
+
+	// basic mode - htpasswd file (bcrypt or {SHA} hashes)
+	HtpasswdFile string
+
+	// jwt mode - keys are read from a JWKS file or fetched from a JWKS URL
+	JWKSFile            string
+	JWKSURL             string
+	JWKSRefreshInterval time.Duration
+	Issuer              string
+	Audience            string
+
+	// jwt mode - "claim=value" rules that must all match. nested claims are addressed with dots (e.g. realm.role)
+	// and array claims match if they contain the value
+	ClaimRules []string
+
+	// pass the Authorization header of authenticated requests on, rather than removing it
+	PassAuthorization bool
+}
+
+// Validate checks the settings the mode requires are given, returning all problems found
+func (c *Configuration) Validate() error {
+	var validationErrors common.MultiError
+
+	switch c.Mode {
+	case "", NoneMode:
+	case BearerMode:
+		if len(c.Tokens) == 0 && c.TokensFile == "" {
+			validationErrors.Addf("Bearer auth mode requires tokens or a tokens file")
+		}
+		validationErrors.Add(validateFileExists(c.TokensFile, "tokens"))
+	case BasicMode:
+		if c.HtpasswdFile == "" {
+			validationErrors.Addf("Basic auth mode requires an htpasswd file")
+		}
+		validationErrors.Add(validateFileExists(c.HtpasswdFile, "htpasswd"))
+	case JWTMode:
+		if (c.JWKSFile == "") == (c.JWKSURL == "") {
+			validationErrors.Addf("JWT auth mode requires either a JWKS file or a JWKS URL")
+		}
+		validationErrors.Add(validateFileExists(c.JWKSFile, "JWKS"))
+		if c.JWKSURL != "" {
+			if parsedURL, err := url.Parse(c.JWKSURL); err != nil || parsedURL.Host == "" {
+				validationErrors.Addf("Invalid JWKS URL: %q", c.JWKSURL)
+			}
+		}
+		if _, err := parseClaimRules(c.ClaimRules); err != nil {
+			validationErrors.AddWrap(err, "Invalid claim rules")
+		}
+	default:
+		validationErrors.Addf("Unknown auth mode: %s", c.Mode)
+	}
+
+	return validationErrors.ErrorOrNil()
+}
+
+func validateFileExists(filePath string, description string) error {
+	if filePath == "" {
+		return nil
+	}
+	exists, err := common.FileExists(filePath)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to check %s file %s", description, filePath)
+	}
+	if !exists {
+		return errors.Errorf("%s file doesn't exist: %s", description, filePath)
+	}
+	return nil
+}
+
+type FailureReason string
+
+const (
+	MissingCredentialsFailureReason FailureReason = "missing_credentials"
+	InvalidCredentialsFailureReason FailureReason = "invalid_credentials"
+	ForbiddenFailureReason          FailureReason = "forbidden"
+)
+
+// Failure is returned by authenticators when a request is rejected
+type Failure struct {
+	Reason FailureReason
+	cause  error
+}
+
+func newFailure(reason FailureReason, cause error) *Failure {
+	return &Failure{Reason: reason, cause: cause}
+}
+
+func (f *Failure) Error() string {
+	if f.cause == nil {
+		return string(f.Reason)
+	}
+	return string(f.Reason) + ": " + f.cause.Error()
+}
+
+func (f *Failure) Unwrap() error {
+	return f.cause
+}
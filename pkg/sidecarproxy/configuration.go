@@ -0,0 +1,224 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sidecarproxy
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/v3io/sidecar-proxy/pkg/common"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/activityfilter"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/auth"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/errorpage"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/headerrule"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metriclabels"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler/factory"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/pusher"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/tcproute"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// Configuration holds everything a server is created with
+type Configuration struct {
+	ListenAddress string
+
+	// admin endpoints are served only if set
+	AdminListenAddress string
+
+	// serve the admin endpoints without authentication
+	AdminInsecure bool
+
+	// serve pprof, goroutine dump and GC stats endpoints on the admin listener
+	DebugEndpoints bool
+
+	// host:port of the upstream
+	ForwardAddress string
+
+	// accept HTTP/2 without TLS (h2c) on the listener, and forward all requests (rather than just gRPC ones) over h2c
+	H2C         bool
+	UpstreamH2C bool
+
+	// load balancers in front of the listener send a PROXY protocol header with the client's address
+	ProxyProtocol bool
+
+	// peers whose X-Forwarded-For / Forwarded (and PROXY protocol) headers are trusted. if empty, forwarding headers
+	// are passed through as is
+	TrustedProxies []*net.IPNet
+
+	Namespace    string
+	ServiceName  string
+	InstanceName string
+
+	// metrics handlers to run (num_of_requests is always added) and poll intervals overriding their defaults
+	MetricNames   []string
+	PollIntervals map[metricshandler.MetricName]time.Duration
+
+	MetricLabels    metriclabels.Configuration
+	MetricNamespace string
+	MetricSubsystem string
+
+	SSHConnectionFilePath       string
+	CodeServerHeartbeatFilePath string
+	RStudioSessionsDirPath      string
+	RayDashboardAddress         string
+	DaskDashboardAddress        string
+	UpstreamMetricsURL          string
+	UpstreamMetricsFilter       string
+	IgnoreRules                 []activityfilter.Rule
+	HeaderRules                 []headerrule.Rule
+	TCPRoutes                   []tcproute.Route
+
+	// requests to the upstream, to /metrics and to the admin endpoints are authenticated independently
+	UpstreamAuth auth.Configuration
+	MetricsAuth  auth.Configuration
+	AdminAuth    auth.Configuration
+
+	// HTML / JSON responses returned to clients when the upstream fails
+	ErrorPages errorpage.Configuration
+
+	// whether /metrics includes Go runtime and process metrics
+	IncludeRuntimeMetrics bool
+
+	Pusher pusher.Configuration
+}
+
+// Validate checks the configuration up front, returning all problems found rather than just the first
+func (c *Configuration) Validate() error {
+	var validationErrors common.MultiError
+
+	if c.ListenAddress == "" {
+		validationErrors.Addf("Listen address must be set")
+	} else {
+		validationErrors.AddWrap(common.ValidateAddress(c.ListenAddress, false), "Invalid listen address")
+	}
+	if c.AdminListenAddress != "" {
+		validationErrors.AddWrap(common.ValidateAddress(c.AdminListenAddress, false), "Invalid admin listen address")
+		if c.AdminListenAddress == c.ListenAddress {
+			validationErrors.Addf("Admin listen address must differ from the listen address")
+		}
+	} else if c.DebugEndpoints {
+		validationErrors.Addf("Debug endpoints are enabled but the admin listener isn't")
+	}
+	if c.ForwardAddress == "" {
+		validationErrors.Addf("Forward address must be set")
+	} else {
+		validationErrors.AddWrap(common.ValidateAddress(c.ForwardAddress, true), "Invalid forward address")
+	}
+
+	if c.RayDashboardAddress != "" {
+		validationErrors.AddWrap(common.ValidateAddress(c.RayDashboardAddress, true), "Invalid Ray dashboard address")
+	}
+	if c.DaskDashboardAddress != "" {
+		validationErrors.AddWrap(common.ValidateAddress(c.DaskDashboardAddress, true), "Invalid Dask dashboard address")
+	}
+
+	if c.UpstreamMetricsURL != "" {
+		if parsedURL, err := url.Parse(c.UpstreamMetricsURL); err != nil {
+			validationErrors.AddWrap(err, "Invalid upstream metrics URL")
+		} else if (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+			validationErrors.Addf("Upstream metrics URL must be an http(s) URL, got: %q", c.UpstreamMetricsURL)
+		}
+	}
+	if _, err := regexp.Compile(c.UpstreamMetricsFilter); err != nil {
+		validationErrors.AddWrap(err, "Invalid upstream metrics filter")
+	}
+
+	for _, metricName := range c.MetricNames {
+		if !factory.IsSupported(metricName) {
+			validationErrors.Addf("Unknown metric name: %s", metricName)
+		}
+	}
+	if c.SSHConnectionFilePath == "" &&
+		common.StringInSlice(string(metricshandler.SSHConnectionActiveMetricName), c.MetricNames) {
+		validationErrors.Addf("%s is enabled but the SSH connection file path is empty",
+			metricshandler.SSHConnectionActiveMetricName)
+	}
+	for metricName, interval := range c.PollIntervals {
+		if !factory.IsSupported(string(metricName)) {
+			validationErrors.Addf("Poll interval given for unknown metric name: %s", metricName)
+		}
+		if interval <= 0 {
+			validationErrors.Addf("Poll interval of %s must be positive", metricName)
+		}
+	}
+
+	// a PROXY protocol header names the client, so it may only be taken from the load balancers
+	if c.ProxyProtocol && len(c.TrustedProxies) == 0 {
+		validationErrors.Addf("PROXY protocol is enabled but no trusted proxies are given")
+	}
+
+	validationErrors.AddWrap(c.validateTCPRoutes(), "Invalid TCP routes")
+
+	if _, err := metriclabels.NewLabelSet(c.MetricLabels, c.Namespace, c.ServiceName, c.InstanceName); err != nil {
+		validationErrors.AddWrap(err, "Invalid metric labels")
+	}
+	if c.MetricNamespace != "" || c.MetricSubsystem != "" {
+		metricNamePrefix := prometheus.BuildFQName(c.MetricNamespace, c.MetricSubsystem, "")
+		if !model.IsValidMetricName(model.LabelValue(metricNamePrefix + "_x")) {
+			validationErrors.Addf("Invalid metric namespace / subsystem: %q", metricNamePrefix)
+		}
+	}
+
+	validationErrors.AddWrap(c.UpstreamAuth.Validate(), "Invalid upstream auth configuration")
+	validationErrors.AddWrap(c.MetricsAuth.Validate(), "Invalid metrics auth configuration")
+	validationErrors.AddWrap(c.AdminAuth.Validate(), "Invalid admin auth configuration")
+	adminAuthEnabled := c.AdminAuth.Mode != "" && c.AdminAuth.Mode != auth.NoneMode
+	if adminAuthEnabled && c.AdminListenAddress == "" {
+		validationErrors.Addf("Admin auth is configured but the admin listener isn't")
+	}
+
+	// the admin endpoints start and stop handlers and change settings, so they're only served unauthenticated on
+	// explicit request
+	if c.AdminListenAddress != "" && !adminAuthEnabled && !c.AdminInsecure {
+		validationErrors.Addf("Admin listener is enabled without admin auth, which must be configured or explicitly opted out of")
+	}
+
+	validationErrors.AddWrap(c.ErrorPages.Validate(), "Invalid error pages configuration")
+	validationErrors.AddWrap(c.Pusher.Validate(), "Invalid push configuration")
+
+	return validationErrors.ErrorOrNil()
+}
+
+func (c *Configuration) validateTCPRoutes() error {
+	var validationErrors common.MultiError
+
+	tcpProxyEnabled := common.StringInSlice(string(metricshandler.NumOfTCPConnectionsMetricName), c.MetricNames)
+	if tcpProxyEnabled && len(c.TCPRoutes) == 0 {
+		validationErrors.Addf("%s is enabled but no TCP routes are given", metricshandler.NumOfTCPConnectionsMetricName)
+	} else if !tcpProxyEnabled && len(c.TCPRoutes) > 0 {
+		validationErrors.Addf("TCP routes are given but %s isn't enabled", metricshandler.NumOfTCPConnectionsMetricName)
+	}
+
+	routeNames := map[string]bool{}
+	listenAddresses := map[string]bool{c.ListenAddress: true, c.AdminListenAddress: true}
+	for _, route := range c.TCPRoutes {
+		if routeNames[route.Name] {
+			validationErrors.Addf("Duplicate TCP route name: %s", route.Name)
+		}
+		routeNames[route.Name] = true
+		if listenAddresses[route.ListenAddress] {
+			validationErrors.Addf("Listen address of TCP route %s is already in use: %s", route.Name, route.ListenAddress)
+		}
+		listenAddresses[route.ListenAddress] = true
+	}
+
+	return validationErrors.ErrorOrNil()
+}
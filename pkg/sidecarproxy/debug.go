@@ -0,0 +1,140 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sidecarproxy
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+type gcStats struct {
+	NumOfGoroutines int         `json:"numOfGoroutines"`
+	NumOfGC         int64       `json:"numOfGC"`
+	LastGC          *time.Time  `json:"lastGC,omitempty"`
+	PauseTotal      string      `json:"pauseTotal"`
+	RecentPauses    []string    `json:"recentPauses"`
+	Memory          memoryStats `json:"memory"`
+	MemoryLimit     int64       `json:"memoryLimit"`
+	CollectedAt     time.Time   `json:"collectedAt"`
+}
+
+type memoryStats struct {
+	HeapAlloc    uint64 `json:"heapAlloc"`
+	HeapInuse    uint64 `json:"heapInuse"`
+	HeapIdle     uint64 `json:"heapIdle"`
+	HeapReleased uint64 `json:"heapReleased"`
+	HeapObjects  uint64 `json:"heapObjects"`
+	StackInuse   uint64 `json:"stackInuse"`
+	Sys          uint64 `json:"sys"`
+	TotalAlloc   uint64 `json:"totalAlloc"`
+	Mallocs      uint64 `json:"mallocs"`
+	Frees        uint64 `json:"frees"`
+	NextGC       uint64 `json:"nextGC"`
+}
+
+// registerDebugRoutes registers profiling and runtime endpoints. they expose internals and some are expensive, so
+// they're only served by the admin listener, and only when enabled
+func (s *Server) registerDebugRoutes() {
+	s.adminServeMux.HandleFunc("/debug/pprof/", pprof.Index)
+	s.adminServeMux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	s.adminServeMux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	s.adminServeMux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	s.adminServeMux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	s.adminServeMux.HandleFunc("/debug/goroutines", s.onGoroutines)
+	s.adminServeMux.HandleFunc("/debug/gc", s.onGCStats)
+}
+
+// onGoroutines dumps the stacks of all goroutines, in the same format as an unrecovered panic
+func (s *Server) onGoroutines(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	res.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	buffer := make([]byte, 1024*1024)
+	for {
+		dumpLength := runtime.Stack(buffer, true)
+		if dumpLength < len(buffer) {
+			buffer = buffer[:dumpLength]
+			break
+		}
+		buffer = make([]byte, 2*len(buffer))
+	}
+
+	if _, err := res.Write(buffer); err != nil {
+		s.logger.DebugWith("Failed to write goroutine dump", "err", err.Error())
+	}
+}
+
+// onGCStats returns memory and garbage collection statistics. POST runs a garbage collection first
+func (s *Server) onGCStats(res http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		s.logger.Info("Running garbage collection on request")
+		runtime.GC()
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	var garbageCollectionStats debug.GCStats
+	debug.ReadGCStats(&garbageCollectionStats)
+
+	stats := gcStats{
+		NumOfGoroutines: runtime.NumGoroutine(),
+		NumOfGC:         garbageCollectionStats.NumGC,
+		PauseTotal:      garbageCollectionStats.PauseTotal.String(),
+		RecentPauses:    []string{},
+		Memory: memoryStats{
+			HeapAlloc:    memStats.HeapAlloc,
+			HeapInuse:    memStats.HeapInuse,
+			HeapIdle:     memStats.HeapIdle,
+			HeapReleased: memStats.HeapReleased,
+			HeapObjects:  memStats.HeapObjects,
+			StackInuse:   memStats.StackInuse,
+			Sys:          memStats.Sys,
+			TotalAlloc:   memStats.TotalAlloc,
+			Mallocs:      memStats.Mallocs,
+			Frees:        memStats.Frees,
+			NextGC:       memStats.NextGC,
+		},
+
+		// a negative limit only reads the current one
+		MemoryLimit: debug.SetMemoryLimit(-1),
+		CollectedAt: time.Now(),
+	}
+	if !garbageCollectionStats.LastGC.IsZero() {
+		stats.LastGC = &garbageCollectionStats.LastGC
+	}
+
+	// most recent first, up to 10
+	for pauseIndex, pause := range garbageCollectionStats.Pause {
+		if pauseIndex == 10 {
+			break
+		}
+		stats.RecentPauses = append(stats.RecentPauses, pause.String())
+	}
+
+	s.writeJSON(res, http.StatusOK, stats)
+}
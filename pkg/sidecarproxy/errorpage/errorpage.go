@@ -0,0 +1,194 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package errorpage
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/requestid"
+
+	"github.com/nuclio/errors"
+)
+
+// Pages renders the error responses returned to clients when the upstream fails, as HTML or JSON according to the
+// request's Accept header
+type Pages struct {
+	configuration Configuration
+	serviceName   string
+	templates     map[templateKey]executor
+}
+
+// NewPages loads the error page templates, returning nil if error pages are disabled
+func NewPages(configuration Configuration, serviceName string) (*Pages, error) {
+	if !configuration.Enabled {
+		return nil, nil
+	}
+
+	if err := configuration.Validate(); err != nil {
+		return nil, errors.Wrap(err, "Invalid error pages configuration")
+	}
+
+	templates, err := loadTemplates(configuration.DirPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to load error page templates")
+	}
+
+	return &Pages{
+		configuration: configuration,
+		serviceName:   serviceName,
+		templates:     templates,
+	}, nil
+}
+
+// Handles returns whether there's an error page for the status
+func (p *Pages) Handles(statusCode int) bool {
+	_, found := p.templates[templateKey{statusCode: statusCode, format: htmlFormat}]
+	return found
+}
+
+// Write writes the error page of the status as the response
+func (p *Pages) Write(res http.ResponseWriter, req *http.Request, statusCode int) {
+	body, contentType, retryAfterSeconds := p.render(req, statusCode, "")
+
+	p.setHeaders(res.Header(), contentType, len(body), retryAfterSeconds)
+	res.WriteHeader(statusCode)
+	_, _ = res.Write(body)
+}
+
+// Replace replaces the body of an error response from the upstream with the status' error page. The upstream's
+// retry hint, if it gave one, is kept
+func (p *Pages) Replace(resp *http.Response) {
+	body, contentType, retryAfterSeconds := p.render(resp.Request, resp.StatusCode, resp.Header.Get("Retry-After"))
+
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Del("Content-Encoding")
+	p.setHeaders(resp.Header, contentType, len(body), retryAfterSeconds)
+}
+
+func (p *Pages) render(req *http.Request, statusCode int, upstreamRetryAfter string) ([]byte, string, int) {
+	retryAfterSeconds := parseRetryAfter(upstreamRetryAfter)
+	if retryAfterSeconds < 0 {
+		retryAfterSeconds = int(p.configuration.RetryAfter.Seconds())
+	}
+
+	templateData := TemplateData{
+		StatusCode:        statusCode,
+		StatusText:        http.StatusText(statusCode),
+		ServiceName:       p.serviceName,
+		RequestID:         requestid.FromContext(req.Context()),
+		RetryAfterSeconds: retryAfterSeconds,
+		AutoRefresh:       retryAfterSeconds > 0,
+	}
+
+	templateFormat := negotiateFormat(req.Header.Get("Accept"))
+	contentType := "application/json"
+	if templateFormat == htmlFormat {
+		contentType = "text/html; charset=utf-8"
+	}
+
+	// templates were executed when loaded, so this shouldn't fail. if it does, the status alone is returned
+	var body bytes.Buffer
+	if err := p.templates[templateKey{statusCode: statusCode, format: templateFormat}].Execute(&body,
+		templateData); err != nil {
+		return nil, "text/plain; charset=utf-8", retryAfterSeconds
+	}
+
+	return body.Bytes(), contentType, retryAfterSeconds
+}
+
+func (p *Pages) setHeaders(header http.Header, contentType string, contentLength int, retryAfterSeconds int) {
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Length", strconv.Itoa(contentLength))
+	header.Set("Cache-Control", "no-store")
+	if retryAfterSeconds > 0 {
+		header.Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+	}
+}
+
+// parseRetryAfter returns the seconds a Retry-After header (delay or date) asks to wait, or -1 if there's none
+func parseRetryAfter(retryAfter string) int {
+	if retryAfter == "" {
+		return -1
+	}
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		return seconds
+	}
+	if retryTime, err := http.ParseTime(retryAfter); err == nil {
+		if seconds := int(time.Until(retryTime).Seconds()); seconds > 0 {
+			return seconds
+		}
+		return 0
+	}
+	return -1
+}
+
+// negotiateFormat picks HTML or JSON by the Accept header's quality values, preferring the more specific match on a
+// tie. Browsers ask for text/html explicitly, so other clients (e.g. ones accepting */*) get JSON
+func negotiateFormat(accept string) format {
+	htmlQuality, htmlSpecificity := acceptQuality(accept, "text", "html")
+	jsonQuality, jsonSpecificity := acceptQuality(accept, "application", "json")
+
+	if htmlQuality > jsonQuality || (htmlQuality == jsonQuality && htmlSpecificity > jsonSpecificity) {
+		return htmlFormat
+	}
+	return jsonFormat
+}
+
+// acceptQuality returns the quality the Accept header gives the media type, and how specific the range giving it
+// was (2 for an exact match, 1 for type/*, 0 for */*)
+func acceptQuality(accept string, mediaType string, mediaSubtype string) (float64, int) {
+	quality, specificity := 0.0, -1
+
+	for _, mediaRange := range strings.Split(accept, ",") {
+		parameters := strings.Split(mediaRange, ";")
+		rangeType, rangeSubtype, _ := strings.Cut(strings.ToLower(strings.TrimSpace(parameters[0])), "/")
+
+		var rangeSpecificity int
+		switch {
+		case rangeType == mediaType && rangeSubtype == mediaSubtype:
+			rangeSpecificity = 2
+		case rangeType == mediaType && rangeSubtype == "*":
+			rangeSpecificity = 1
+		case rangeType == "*" && rangeSubtype == "*":
+			rangeSpecificity = 0
+		default:
+			continue
+		}
+
+		// the most specific range matching the media type determines its quality
+		if rangeSpecificity <= specificity {
+			continue
+		}
+		specificity = rangeSpecificity
+		quality = 1
+		for _, parameter := range parameters[1:] {
+			if value, found := strings.CutPrefix(strings.TrimSpace(parameter), "q="); found {
+				if parsedQuality, err := strconv.ParseFloat(value, 64); err == nil {
+					quality = parsedQuality
+				}
+			}
+		}
+	}
+
+	return quality, specificity
+}
@@ -0,0 +1,136 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package errorpage
+
+import (
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	texttemplate "text/template"
+
+	"github.com/v3io/sidecar-proxy/pkg/common"
+
+	"github.com/nuclio/errors"
+)
+
+const defaultHTMLTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.StatusCode}} {{.StatusText}}</title>
+{{- if .AutoRefresh}}
+<meta http-equiv="refresh" content="{{.RetryAfterSeconds}}">
+{{- end}}
+<style>body { font-family: sans-serif; margin: 4em auto; max-width: 40em; color: #333; }</style>
+</head>
+<body>
+<h1>{{.StatusText}}</h1>
+<p>{{if .ServiceName}}{{.ServiceName}}{{else}}The service{{end}} {{if eq .StatusCode 429}}is receiving too many requests{{else}}isn't available right now - it may be starting or restarting{{end}}.</p>
+{{- if .AutoRefresh}}
+<p>This page will reload in {{.RetryAfterSeconds}} seconds.</p>
+{{- else if .RetryAfterSeconds}}
+<p>Please retry in {{.RetryAfterSeconds}} seconds.</p>
+{{- end}}
+{{- if .RequestID}}
+<p><small>Request ID: {{.RequestID}}</small></p>
+{{- end}}
+</body>
+</html>
+`
+
+const defaultJSONTemplate = `{"status": {{.StatusCode}}, "error": {{json .StatusText}}, "service": {{json .ServiceName}}, ` +
+	`"retryAfterSeconds": {{.RetryAfterSeconds}}, "requestID": {{json .RequestID}}}
+`
+
+type format string
+
+const (
+	htmlFormat format = "html"
+	jsonFormat format = "json"
+)
+
+// executor is implemented by both HTML and text templates
+type executor interface {
+	Execute(writer io.Writer, data interface{}) error
+}
+
+type templateKey struct {
+	statusCode int
+	format     format
+}
+
+// loadTemplates parses the templates of each status and format, from the directory if it holds one and the
+// built-in templates otherwise. each template is executed once, so that errors surface now rather than on failure
+func loadTemplates(dirPath string) (map[templateKey]executor, error) {
+	var loadErrors common.MultiError
+	templates := map[templateKey]executor{}
+
+	for _, statusCode := range StatusCodes {
+		for _, templateFormat := range []format{htmlFormat, jsonFormat} {
+			fileName := strconv.Itoa(statusCode) + "." + string(templateFormat)
+			templateStr, err := readTemplate(dirPath, fileName, templateFormat)
+			if err != nil {
+				loadErrors.Add(err)
+				continue
+			}
+
+			var parsedTemplate executor
+			if templateFormat == htmlFormat {
+				parsedTemplate, err = htmltemplate.New(fileName).Parse(templateStr)
+			} else {
+				parsedTemplate, err = texttemplate.New(fileName).Funcs(texttemplate.FuncMap{"json": toJSON}).Parse(templateStr)
+			}
+			if err == nil {
+				err = parsedTemplate.Execute(io.Discard, TemplateData{StatusCode: statusCode})
+			}
+			if err != nil {
+				loadErrors.AddWrap(err, fmt.Sprintf("Invalid template %s", fileName))
+				continue
+			}
+
+			templates[templateKey{statusCode: statusCode, format: templateFormat}] = parsedTemplate
+		}
+	}
+
+	return templates, loadErrors.ErrorOrNil()
+}
+
+func readTemplate(dirPath string, fileName string, templateFormat format) (string, error) {
+	if dirPath != "" {
+		templateBytes, err := os.ReadFile(filepath.Join(dirPath, fileName))
+		if err == nil {
+			return string(templateBytes), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", errors.Wrapf(err, "Failed to read template %s", fileName)
+		}
+	}
+
+	if templateFormat == htmlFormat {
+		return defaultHTMLTemplate, nil
+	}
+	return defaultJSONTemplate, nil
+}
+
+// toJSON lets JSON templates embed strings safely, e.g. {{json .ServiceName}}
+func toJSON(value interface{}) (string, error) {
+	encodedValue, err := json.Marshal(value)
+	return string(encodedValue), err
+}
@@ -0,0 +1,82 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package errorpage
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/v3io/sidecar-proxy/pkg/common"
+)
+
+// StatusCodes are the statuses error pages are rendered for
+var StatusCodes = []int{
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+	http.StatusTooManyRequests,
+}
+
+// DefaultRetryAfter is the retry hint given when the upstream doesn't give one
+const DefaultRetryAfter = 5 * time.Second
+
+type Configuration struct {
+	Enabled bool
+
+	// directory of templates overriding the built-in ones, named by status and format (e.g. 502.html, 503.json)
+	DirPath string
+
+	// retry hint (and HTML auto-refresh interval) given when the upstream doesn't give one. 0 disables both
+	RetryAfter time.Duration
+}
+
+// TemplateData is what error pages are templated from, e.g. "{{.ServiceName}}"
+type TemplateData struct {
+	StatusCode        int
+	StatusText        string
+	ServiceName       string
+	RequestID         string
+	RetryAfterSeconds int
+
+	// whether the HTML page should reload itself after RetryAfterSeconds
+	AutoRefresh bool
+}
+
+// Validate checks the templates can be loaded, returning all problems found
+func (c *Configuration) Validate() error {
+	var validationErrors common.MultiError
+
+	if !c.Enabled {
+		return nil
+	}
+
+	if c.RetryAfter < 0 {
+		validationErrors.Addf("Error page retry after must not be negative")
+	}
+	if c.DirPath != "" {
+		if dirInfo, err := os.Stat(c.DirPath); err != nil {
+			validationErrors.AddWrap(err, "Failed to stat error pages directory")
+		} else if !dirInfo.IsDir() {
+			validationErrors.Addf("Error pages path isn't a directory: %s", c.DirPath)
+		}
+	}
+	if _, err := loadTemplates(c.DirPath); err != nil {
+		validationErrors.AddWrap(err, "Failed to load error page templates")
+	}
+
+	return validationErrors.ErrorOrNil()
+}
@@ -0,0 +1,215 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package forwarded
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nuclio/errors"
+)
+
+// headers through which proxies pass on the client's address, host and protocol. they're only honored when set by a
+// trusted proxy
+var forwardingHeaderNames = []string{
+	"Forwarded",
+	"X-Forwarded-For",
+	"X-Forwarded-Host",
+	"X-Forwarded-Proto",
+	"X-Real-Ip",
+}
+
+type contextKey struct{}
+
+// Resolver determines the client address of requests that reached the server through trusted proxies, and rewrites
+// the forwarding headers so that the upstream only sees the hops that can be trusted
+type Resolver struct {
+	trustedNetworks []*net.IPNet
+}
+
+func NewResolver(trustedNetworks []*net.IPNet) *Resolver {
+	return &Resolver{trustedNetworks: trustedNetworks}
+}
+
+// ParseNetworks parses a comma separated list of CIDRs. A bare IP is taken as a network of its own
+func ParseNetworks(networksStr string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, networkStr := range strings.Split(networksStr, ",") {
+		networkStr = strings.TrimSpace(networkStr)
+		if networkStr == "" {
+			continue
+		}
+
+		if ip := net.ParseIP(networkStr); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(networkStr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse CIDR: %s", networkStr)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// Contains returns whether the IP is in one of the networks
+func Contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Wrap resolves the client address of each request before handing it to the handler. Without trusted proxies the
+// forwarding headers are passed through as is
+func (r *Resolver) Wrap(handler http.Handler) http.Handler {
+	if len(r.trustedNetworks) == 0 {
+		return handler
+	}
+
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		clientIP := r.resolve(req)
+		handler.ServeHTTP(res, req.WithContext(context.WithValue(req.Context(), contextKey{}, clientIP)))
+	})
+}
+
+// ClientIP returns the address of the client that sent the request - the one resolved from the forwarding headers
+// if the request came through trusted proxies, or the peer's otherwise
+func ClientIP(req *http.Request) string {
+	if clientIP, ok := req.Context().Value(contextKey{}).(string); ok {
+		return clientIP
+	}
+	return hostOf(req.RemoteAddr)
+}
+
+// resolve returns the client address and rewrites the request's forwarding headers. the chain of addresses the
+// request passed through is walked from the peer back, and the first address that isn't a trusted proxy is the
+// client's. hops before it could have been made up by the client, so they're dropped from the headers. the peer
+// itself is appended to X-Forwarded-For by the reverse proxy, and to Forwarded here
+func (r *Resolver) resolve(req *http.Request) string {
+	peerIP := hostOf(req.RemoteAddr)
+	if !r.isTrusted(peerIP) {
+		for _, headerName := range forwardingHeaderNames {
+			req.Header.Del(headerName)
+		}
+		req.Header.Set("Forwarded", forwardedElement(peerIP, req))
+		return peerIP
+	}
+
+	// Forwarded is preferred when both are given, as it's the standard one
+	var elements, hops []string
+	if forwardedHeader := req.Header.Values("Forwarded"); len(forwardedHeader) > 0 {
+		elements = splitList(forwardedHeader)
+		for _, element := range elements {
+			hops = append(hops, forParameter(element))
+		}
+	} else {
+		hops = splitList(req.Header.Values("X-Forwarded-For"))
+		for _, hop := range hops {
+			elements = append(elements, "for="+quoteNode(hop))
+		}
+	}
+
+	clientIndex := 0
+	clientIP := peerIP
+	for hopIndex := len(hops) - 1; hopIndex >= 0; hopIndex-- {
+		clientIndex, clientIP = hopIndex, hostOf(hops[hopIndex])
+		if !r.isTrusted(clientIP) {
+			break
+		}
+	}
+
+	// the rest of the forwarding headers were set by the trusted peer, and are kept
+	req.Header.Del("X-Forwarded-For")
+	if len(hops) > 0 {
+		for _, hop := range hops[clientIndex:] {
+			req.Header.Add("X-Forwarded-For", hostOf(hop))
+		}
+	}
+	elements = append(elements[clientIndex:], forwardedElement(peerIP, req))
+	req.Header.Set("Forwarded", strings.Join(elements, ", "))
+
+	return clientIP
+}
+
+func (r *Resolver) isTrusted(address string) bool {
+	ip := net.ParseIP(address)
+	return ip != nil && Contains(r.trustedNetworks, ip)
+}
+
+// forwardedElement describes the hop from the peer to this proxy, in Forwarded header syntax (RFC 7239)
+func forwardedElement(peerIP string, req *http.Request) string {
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+	return "for=" + quoteNode(peerIP) + ";host=\"" + req.Host + "\";proto=" + proto
+}
+
+// forParameter returns the node of a Forwarded element's "for" parameter, "unknown" if it has none
+func forParameter(element string) string {
+	for _, pair := range strings.Split(element, ";") {
+		key, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if found && strings.EqualFold(key, "for") {
+			return strings.Trim(value, "\"")
+		}
+	}
+	return "unknown"
+}
+
+// quoteNode formats an address as a Forwarded node. IPv6 addresses are bracketed, and anything that isn't a token
+// is quoted
+func quoteNode(node string) string {
+	if ip := net.ParseIP(node); ip != nil && ip.To4() == nil {
+		return "\"[" + node + "]\""
+	}
+	if strings.ContainsAny(node, ":[]") {
+		return strconv.Quote(node)
+	}
+	return node
+}
+
+// hostOf strips the port (and brackets) off a host:port address or a Forwarded node
+func hostOf(address string) string {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return strings.Trim(address, "[]")
+}
+
+// splitList splits comma separated header values into their trimmed, non empty items
+func splitList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
@@ -0,0 +1,240 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package forwarded
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResolver(t *testing.T) {
+	for _, testCase := range []struct {
+		name                   string
+		trustedProxies         string
+		remoteAddress          string
+		header                 http.Header
+		expectedClientIP       string
+		expectedForwardedFor   string
+		expectedForwarded      string
+		expectedForwardedProto string
+	}{
+		{
+			name:                 "no trusted proxies",
+			remoteAddress:        "10.0.0.1:1234",
+			header:               http.Header{"X-Forwarded-For": {"1.1.1.1"}},
+			expectedClientIP:     "10.0.0.1",
+			expectedForwardedFor: "1.1.1.1",
+		},
+		{
+			name:           "untrusted peer",
+			trustedProxies: "10.0.0.0/8",
+			remoteAddress:  "203.0.113.5:1234",
+			header: http.Header{
+				"X-Forwarded-For":   {"1.1.1.1"},
+				"X-Forwarded-Proto": {"https"},
+				"X-Real-Ip":         {"1.1.1.1"},
+				"Forwarded":         {"for=1.1.1.1"},
+			},
+			expectedClientIP:  "203.0.113.5",
+			expectedForwarded: `for=203.0.113.5;host="example.com";proto=http`,
+		},
+		{
+			name:              "untrusted IPv6 peer",
+			trustedProxies:    "10.0.0.0/8",
+			remoteAddress:     "[2001:db9::1]:1234",
+			expectedClientIP:  "2001:db9::1",
+			expectedForwarded: `for="[2001:db9::1]";host="example.com";proto=http`,
+		},
+		{
+			name:              "trusted peer without forwarding headers",
+			trustedProxies:    "10.0.0.0/8",
+			remoteAddress:     "10.0.0.1:1234",
+			expectedClientIP:  "10.0.0.1",
+			expectedForwarded: `for=10.0.0.1;host="example.com";proto=http`,
+		},
+		{
+			name:           "trusted peer and hop",
+			trustedProxies: "10.0.0.0/8",
+			remoteAddress:  "10.0.0.1:1234",
+			header: http.Header{
+				"X-Forwarded-For":   {"203.0.113.7, 10.0.0.5"},
+				"X-Forwarded-Proto": {"https"},
+			},
+			expectedClientIP:       "203.0.113.7",
+			expectedForwardedFor:   "203.0.113.7, 10.0.0.5",
+			expectedForwarded:      `for=203.0.113.7, for=10.0.0.5, for=10.0.0.1;host="example.com";proto=http`,
+			expectedForwardedProto: "https",
+		},
+		{
+			name:                 "hops spoofed by the client are dropped",
+			trustedProxies:       "10.0.0.0/8",
+			remoteAddress:        "10.0.0.1:1234",
+			header:               http.Header{"X-Forwarded-For": {"1.1.1.1, 2.2.2.2", "203.0.113.7", "10.0.0.5"}},
+			expectedClientIP:     "203.0.113.7",
+			expectedForwardedFor: "203.0.113.7, 10.0.0.5",
+			expectedForwarded:    `for=203.0.113.7, for=10.0.0.5, for=10.0.0.1;host="example.com";proto=http`,
+		},
+		{
+			name:                 "all hops trusted",
+			trustedProxies:       "10.0.0.0/8",
+			remoteAddress:        "10.0.0.1:1234",
+			header:               http.Header{"X-Forwarded-For": {"10.0.0.9, 10.0.0.5"}},
+			expectedClientIP:     "10.0.0.9",
+			expectedForwardedFor: "10.0.0.9, 10.0.0.5",
+			expectedForwarded:    `for=10.0.0.9, for=10.0.0.5, for=10.0.0.1;host="example.com";proto=http`,
+		},
+		{
+			name:           "Forwarded is preferred over X-Forwarded-For",
+			trustedProxies: "10.0.0.0/8, 2001:db8::/32",
+			remoteAddress:  "10.0.0.1:1234",
+			header: http.Header{
+				"Forwarded":       {`for=1.1.1.1, for=198.51.100.1;proto=https, for="[2001:db8::5]:8080"`},
+				"X-Forwarded-For": {"9.9.9.9"},
+			},
+			expectedClientIP:     "198.51.100.1",
+			expectedForwardedFor: "198.51.100.1, 2001:db8::5",
+			expectedForwarded: `for=198.51.100.1;proto=https, for="[2001:db8::5]:8080", ` +
+				`for=10.0.0.1;host="example.com";proto=http`,
+		},
+		{
+			name:                 "Forwarded element without a for parameter",
+			trustedProxies:       "10.0.0.0/8",
+			remoteAddress:        "10.0.0.1:1234",
+			header:               http.Header{"Forwarded": {"proto=https"}},
+			expectedClientIP:     "unknown",
+			expectedForwardedFor: "unknown",
+			expectedForwarded:    `proto=https, for=10.0.0.1;host="example.com";proto=http`,
+		},
+		{
+			name:                 "bare IP trusted",
+			trustedProxies:       "192.168.1.10",
+			remoteAddress:        "192.168.1.10:1234",
+			header:               http.Header{"X-Forwarded-For": {"203.0.113.7"}},
+			expectedClientIP:     "203.0.113.7",
+			expectedForwardedFor: "203.0.113.7",
+			expectedForwarded:    `for=203.0.113.7, for=192.168.1.10;host="example.com";proto=http`,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			trustedNetworks, err := ParseNetworks(testCase.trustedProxies)
+			if err != nil {
+				t.Fatalf("Failed to parse trusted proxies: %v", err)
+			}
+
+			var clientIP string
+			var header http.Header
+			handler := NewResolver(trustedNetworks).Wrap(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				clientIP = ClientIP(req)
+				header = req.Header
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			req.RemoteAddr = testCase.remoteAddress
+			for headerName, values := range testCase.header {
+				req.Header[headerName] = append([]string{}, values...)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if clientIP != testCase.expectedClientIP {
+				t.Errorf("Expected client IP %q, got %q", testCase.expectedClientIP, clientIP)
+			}
+			for headerName, expectedValue := range map[string]string{
+				"X-Forwarded-For":   testCase.expectedForwardedFor,
+				"Forwarded":         testCase.expectedForwarded,
+				"X-Forwarded-Proto": testCase.expectedForwardedProto,
+
+				// only set by an untrusted peer in these cases
+				"X-Real-Ip": "",
+			} {
+				if value := strings.Join(header.Values(headerName), ", "); value != expectedValue {
+					t.Errorf("Expected %s to be %q, got %q", headerName, expectedValue, value)
+				}
+			}
+		})
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	for _, testCase := range []struct {
+		name          string
+		networksStr   string
+		expected      []string
+		expectedError bool
+	}{
+		{name: "empty"},
+		{
+			name:        "CIDRs and bare IPs",
+			networksStr: " 10.0.0.0/8,192.168.1.10 ,, 2001:db8::1,fd00::/8",
+			expected:    []string{"10.0.0.0/8", "192.168.1.10/32", "2001:db8::1/128", "fd00::/8"},
+		},
+		{
+			name:          "invalid CIDR",
+			networksStr:   "10.0.0.0/33",
+			expectedError: true,
+		},
+		{
+			name:          "hostname",
+			networksStr:   "proxy.local",
+			expectedError: true,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			networks, err := ParseNetworks(testCase.networksStr)
+			if testCase.expectedError {
+				if err == nil {
+					t.Fatalf("Expected an error, got networks: %v", networks)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var networkStrs []string
+			for _, network := range networks {
+				networkStrs = append(networkStrs, network.String())
+			}
+			if strings.Join(networkStrs, ",") != strings.Join(testCase.expected, ",") {
+				t.Fatalf("Expected networks %v, got %v", testCase.expected, networkStrs)
+			}
+		})
+	}
+}
+
+func TestContains(t *testing.T) {
+	networks, err := ParseNetworks("10.0.0.0/8,2001:db8::/32")
+	if err != nil {
+		t.Fatalf("Failed to parse networks: %v", err)
+	}
+
+	for ipStr, expected := range map[string]bool{
+		"10.1.2.3":         true,
+		"::ffff:10.1.2.3":  true,
+		"11.0.0.1":         false,
+		"2001:db8::1":      true,
+		"2001:db9::1":      false,
+		"::1":              false,
+		"192.168.1.1":      false,
+		"2001:db8:ffff::1": true,
+	} {
+		if contained := Contains(networks, net.ParseIP(ipStr)); contained != expected {
+			t.Errorf("Expected Contains(%s) to be %t", ipStr, expected)
+		}
+	}
+}
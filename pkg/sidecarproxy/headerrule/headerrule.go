@@ -0,0 +1,249 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package headerrule
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/v3io/sidecar-proxy/pkg/common"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/forwarded"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/requestid"
+
+	"github.com/nuclio/errors"
+)
+
+type Phase string
+
+const (
+	RequestPhase  Phase = "request"
+	ResponsePhase Phase = "response"
+)
+
+type Action string
+
+const (
+	SetAction    Action = "set"
+	AddAction    Action = "add"
+	RemoveAction Action = "remove"
+)
+
+// Rule changes a header of the requests forwarded to the upstream, or of the responses returned from it. It applies to
+// requests matching its path and methods (all requests, if neither is set)
+type Rule struct {
+	Name          string
+	Phase         Phase
+	Action        Action
+	HeaderName    string
+	ValueTemplate *template.Template
+	PathPattern   *regexp.Regexp
+	Methods       []string
+}
+
+// TemplateData is what header values are templated from, e.g. "{{.ClientIP}}"
+type TemplateData struct {
+	Path      string
+	Method    string
+	Host      string
+	ClientIP  string
+	RequestID string
+}
+
+// ParseRule parses a rule of the form "key=value;key=value", where keys are name, on (request or response, defaults
+// to request), path (regex), method (several values separated by "|"), exactly one of set, add and remove (the header
+// name) and value (a template). value must come last, as everything after it is taken as the value - so it may hold
+// ";" (e.g. a Content-Security-Policy). A removed header name ending with "*" removes all headers with that prefix
+func ParseRule(ruleStr string, defaultName string) (Rule, error) {
+	rule := Rule{Name: defaultName, Phase: RequestPhase}
+	var valueStr *string
+
+	for remaining := ruleStr; remaining != ""; {
+
+		// the value is the rest of the rule
+		if value, found := strings.CutPrefix(strings.TrimLeft(remaining, " "), "value="); found {
+			valueStr = &value
+			break
+		}
+
+		var part string
+		part, remaining, _ = strings.Cut(remaining, ";")
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		key, value, found := strings.Cut(part, "=")
+		if !found || value == "" {
+			return Rule{}, errors.Errorf("Rule field must be in the form key=value: %s", part)
+		}
+
+		switch strings.TrimSpace(key) {
+		case "name":
+			rule.Name = value
+		case "on":
+			rule.Phase = Phase(value)
+			if rule.Phase != RequestPhase && rule.Phase != ResponsePhase {
+				return Rule{}, errors.Errorf("Rule must be on %s or %s, got: %s", RequestPhase, ResponsePhase, value)
+			}
+		case "path":
+			pathPattern, err := regexp.Compile(value)
+			if err != nil {
+				return Rule{}, errors.Wrapf(err, "Failed to compile path pattern: %s", value)
+			}
+			rule.PathPattern = pathPattern
+		case "method":
+			for _, method := range strings.Split(value, "|") {
+				rule.Methods = append(rule.Methods, strings.ToUpper(strings.TrimSpace(method)))
+			}
+		case string(SetAction), string(AddAction), string(RemoveAction):
+			if rule.Action != "" {
+				return Rule{}, errors.Errorf("Rule has more than one action: %s and %s", rule.Action, key)
+			}
+			rule.Action = Action(strings.TrimSpace(key))
+			rule.HeaderName = http.CanonicalHeaderKey(value)
+		default:
+			return Rule{}, errors.Errorf("Unknown rule field: %s", key)
+		}
+	}
+
+	if rule.Action == "" {
+		return Rule{}, errors.Errorf("Rule has no action (%s, %s or %s): %s", SetAction, AddAction, RemoveAction, ruleStr)
+	}
+	if rule.Action == RemoveAction {
+		if valueStr != nil {
+			return Rule{}, errors.Errorf("Rule removing %s can't have a value", rule.HeaderName)
+		}
+		return rule, nil
+	}
+
+	if valueStr == nil {
+		return Rule{}, errors.Errorf("Rule setting %s has no value", rule.HeaderName)
+	}
+	if strings.Contains(rule.HeaderName, "*") {
+		return Rule{}, errors.Errorf("Only removed header names may have a wildcard: %s", rule.HeaderName)
+	}
+
+	valueTemplate, err := template.New(rule.Name).Parse(*valueStr)
+	if err != nil {
+		return Rule{}, errors.Wrapf(err, "Failed to parse value template: %s", *valueStr)
+	}
+
+	// fail on unknown fields now, rather than on the first matching request
+	if err := valueTemplate.Execute(io.Discard, TemplateData{}); err != nil {
+		return Rule{}, errors.Wrapf(err, "Invalid value template: %s", *valueStr)
+	}
+	rule.ValueTemplate = valueTemplate
+
+	return rule, nil
+}
+
+// ParseRules parses the given rules, naming unnamed rules by their position
+func ParseRules(ruleStrs []string) ([]Rule, error) {
+	var rules []Rule
+	for ruleIndex, ruleStr := range ruleStrs {
+		rule, err := ParseRule(ruleStr, fmt.Sprintf("header-rule-%d", ruleIndex))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse header rule: %s", ruleStr)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Apply applies the rules of the given phase that match the request to the header - the request's own, or its
+// response's. Rules are applied in order, and a failing rule doesn't stop the ones after it
+func Apply(rules []Rule, phase Phase, req *http.Request, header http.Header) error {
+	var applyErrors common.MultiError
+	var templateData *TemplateData
+
+	for ruleIndex := range rules {
+		rule := &rules[ruleIndex]
+		if rule.Phase != phase || !rule.Matches(req) {
+			continue
+		}
+
+		if rule.Action == RemoveAction {
+			rule.remove(header)
+			continue
+		}
+
+		if templateData == nil {
+			templateData = newTemplateData(req)
+		}
+		value, err := rule.value(templateData)
+		if err != nil {
+			applyErrors.AddWrap(err, fmt.Sprintf("Failed to apply header rule %s", rule.Name))
+			continue
+		}
+
+		if rule.Action == SetAction {
+			header.Set(rule.HeaderName, value)
+		} else {
+			header.Add(rule.HeaderName, value)
+		}
+	}
+
+	return applyErrors.ErrorOrNil()
+}
+
+func (r *Rule) Matches(req *http.Request) bool {
+	if r.PathPattern != nil && !r.PathPattern.MatchString(req.URL.Path) {
+		return false
+	}
+
+	if len(r.Methods) > 0 && !common.StringInSlice(req.Method, r.Methods) {
+		return false
+	}
+
+	return true
+}
+
+func (r *Rule) remove(header http.Header) {
+	prefix, isWildcard := strings.CutSuffix(r.HeaderName, "*")
+	if !isWildcard {
+		header.Del(r.HeaderName)
+		return
+	}
+
+	for headerName := range header {
+		if strings.HasPrefix(headerName, prefix) {
+			delete(header, headerName)
+		}
+	}
+}
+
+// value executes the rule's template. line breaks are dropped, so a templated value can't inject headers
+func (r *Rule) value(templateData *TemplateData) (string, error) {
+	var value strings.Builder
+	if err := r.ValueTemplate.Execute(&value, templateData); err != nil {
+		return "", errors.Wrap(err, "Failed to execute value template")
+	}
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value.String()), nil
+}
+
+func newTemplateData(req *http.Request) *TemplateData {
+	return &TemplateData{
+		Path:      req.URL.Path,
+		Method:    req.Method,
+		Host:      req.Host,
+		ClientIP:  forwarded.ClientIP(req),
+		RequestID: requestid.FromContext(req.Context()),
+	}
+}
@@ -0,0 +1,307 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package headerrule
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/requestid"
+)
+
+func TestParseRule(t *testing.T) {
+	templateData := &TemplateData{
+		Path:      "/api",
+		Method:    http.MethodGet,
+		Host:      "example.com",
+		ClientIP:  "203.0.113.7",
+		RequestID: "abc",
+	}
+
+	for _, testCase := range []struct {
+		name            string
+		ruleStr         string
+		expectedRule    Rule
+		expectedValue   string
+		expectedPattern string
+		expectedError   string
+	}{
+		{
+			name:    "value takes the rest of the rule",
+			ruleStr: "on=response;set=content-security-policy;value=default-src 'self'; img-src *; frame-ancestors x=y",
+			expectedRule: Rule{
+				Name:       "default",
+				Phase:      ResponsePhase,
+				Action:     SetAction,
+				HeaderName: "Content-Security-Policy",
+			},
+			expectedValue: "default-src 'self'; img-src *; frame-ancestors x=y",
+		},
+		{
+			name:          "fields after the value are part of it",
+			ruleStr:       "value=a;set=X-A",
+			expectedError: "Rule has no action",
+		},
+		{
+			name:    "value after a space",
+			ruleStr: "set=X-A; value= b ",
+			expectedRule: Rule{
+				Name:       "default",
+				Phase:      RequestPhase,
+				Action:     SetAction,
+				HeaderName: "X-A",
+			},
+			expectedValue: " b ",
+		},
+		{
+			name:    "empty value",
+			ruleStr: "add=X-A;value=",
+			expectedRule: Rule{
+				Name:       "default",
+				Phase:      RequestPhase,
+				Action:     AddAction,
+				HeaderName: "X-A",
+			},
+		},
+		{
+			name:    "templated value",
+			ruleStr: "name=client;set=X-Client;value={{.ClientIP}} {{.Method}} {{.Host}}{{.Path}} {{.RequestID}}",
+			expectedRule: Rule{
+				Name:       "client",
+				Phase:      RequestPhase,
+				Action:     SetAction,
+				HeaderName: "X-Client",
+			},
+			expectedValue: "203.0.113.7 GET example.com/api abc",
+		},
+		{
+			name:    "path and methods",
+			ruleStr: " path=^/api/(v1|v2)/ ; method=get| Post ;remove=x-debug-*",
+			expectedRule: Rule{
+				Name:       "default",
+				Phase:      RequestPhase,
+				Action:     RemoveAction,
+				HeaderName: "X-Debug-*",
+				Methods:    []string{http.MethodGet, http.MethodPost},
+			},
+			expectedPattern: "^/api/(v1|v2)/",
+		},
+		{
+			name:          "unknown template field",
+			ruleStr:       "set=X-A;value={{.Nope}}",
+			expectedError: "Invalid value template",
+		},
+		{
+			name:          "malformed template",
+			ruleStr:       "set=X-A;value={{.Path",
+			expectedError: "Failed to parse value template",
+		},
+		{
+			name:          "remove with a value",
+			ruleStr:       "remove=X-A;value=b",
+			expectedError: "Rule removing X-A can't have a value",
+		},
+		{
+			name:          "set without a value",
+			ruleStr:       "set=X-A",
+			expectedError: "Rule setting X-A has no value",
+		},
+		{
+			name:          "set with a wildcard",
+			ruleStr:       "set=X-*;value=b",
+			expectedError: "Only removed header names may have a wildcard",
+		},
+		{
+			name:          "two actions",
+			ruleStr:       "set=X-A;remove=X-B",
+			expectedError: "Rule has more than one action",
+		},
+		{
+			name:          "unknown field",
+			ruleStr:       "header=X-A;value=b",
+			expectedError: "Unknown rule field: header",
+		},
+		{
+			name:          "field without a value",
+			ruleStr:       "set;value=b",
+			expectedError: "Rule field must be in the form key=value: set",
+		},
+		{
+			name:          "unknown phase",
+			ruleStr:       "on=both;set=X-A;value=b",
+			expectedError: "Rule must be on request or response",
+		},
+		{
+			name:          "invalid path pattern",
+			ruleStr:       "path=[;remove=X-A",
+			expectedError: "Failed to compile path pattern",
+		},
+		{
+			name:          "empty",
+			ruleStr:       "",
+			expectedError: "Rule has no action",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			rule, err := ParseRule(testCase.ruleStr, "default")
+			if testCase.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), testCase.expectedError) {
+					t.Fatalf("Expected error containing %q, got: %v", testCase.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var value, pattern string
+			if rule.ValueTemplate != nil {
+				if value, err = rule.value(templateData); err != nil {
+					t.Fatalf("Failed to execute value template: %v", err)
+				}
+			}
+			if rule.PathPattern != nil {
+				pattern = rule.PathPattern.String()
+			}
+			if value != testCase.expectedValue {
+				t.Errorf("Expected value %q, got %q", testCase.expectedValue, value)
+			}
+			if pattern != testCase.expectedPattern {
+				t.Errorf("Expected path pattern %q, got %q", testCase.expectedPattern, pattern)
+			}
+
+			rule.ValueTemplate, rule.PathPattern = nil, nil
+			if !reflect.DeepEqual(rule, testCase.expectedRule) {
+				t.Errorf("Expected rule %+v, got %+v", testCase.expectedRule, rule)
+			}
+		})
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules([]string{"remove=X-A", "name=named;remove=X-B", "remove=X-C"})
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+
+	var names []string
+	for _, rule := range rules {
+		names = append(names, rule.Name)
+	}
+	if expectedNames := []string{"header-rule-0", "named", "header-rule-2"}; !reflect.DeepEqual(names, expectedNames) {
+		t.Fatalf("Expected names %v, got %v", expectedNames, names)
+	}
+
+	if _, err := ParseRules([]string{"remove=X-A", "set=X-B"}); err == nil {
+		t.Fatalf("Expected an invalid rule to fail parsing")
+	}
+}
+
+func TestApply(t *testing.T) {
+	for _, testCase := range []struct {
+		name           string
+		ruleStrs       []string
+		phase          Phase
+		method         string
+		path           string
+		header         http.Header
+		expectedHeader http.Header
+	}{
+		{
+			name:           "set replaces and add appends",
+			ruleStrs:       []string{"set=X-A;value=1", "add=X-B;value=2"},
+			header:         http.Header{"X-A": {"0"}, "X-B": {"0"}},
+			expectedHeader: http.Header{"X-A": {"1"}, "X-B": {"0", "2"}},
+		},
+		{
+			name:           "rules are applied in order",
+			ruleStrs:       []string{"set=X-A;value=1", "remove=X-A", "add=X-A;value=2"},
+			expectedHeader: http.Header{"X-A": {"2"}},
+		},
+		{
+			name:     "remove by prefix",
+			ruleStrs: []string{"remove=X-Debug-*"},
+			header: http.Header{
+				"X-Debug-Token": {"a"},
+				"X-Debug-User":  {"b"},
+				"X-Debugger":    {"c"},
+			},
+			expectedHeader: http.Header{"X-Debugger": {"c"}},
+		},
+		{
+			name:           "rules of the other phase are skipped",
+			ruleStrs:       []string{"on=response;set=X-A;value=1", "set=X-B;value=2"},
+			phase:          ResponsePhase,
+			expectedHeader: http.Header{"X-A": {"1"}},
+		},
+		{
+			name: "rules not matching the path or method are skipped",
+			ruleStrs: []string{
+				"path=^/api/;set=X-A;value=1",
+				"method=POST;set=X-B;value=2",
+				"method=GET;path=^/ui/;set=X-C;value=3",
+			},
+			path:           "/ui/index.html",
+			expectedHeader: http.Header{"X-C": {"3"}},
+		},
+		{
+			name:           "line breaks are dropped from values",
+			ruleStrs:       []string{"set=X-Path;value={{.Path}}"},
+			path:           "/a%0D%0AX-Injected:%20b",
+			expectedHeader: http.Header{"X-Path": {"/aX-Injected: b"}},
+		},
+		{
+			name:           "template data",
+			ruleStrs:       []string{"set=X-Client;value={{.ClientIP}}/{{.RequestID}}"},
+			expectedHeader: http.Header{"X-Client": {"192.0.2.1/request-id"}},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			rules, err := ParseRules(testCase.ruleStrs)
+			if err != nil {
+				t.Fatalf("Failed to parse rules: %v", err)
+			}
+
+			method, path, phase := testCase.method, testCase.path, testCase.phase
+			if method == "" {
+				method = http.MethodGet
+			}
+			if path == "" {
+				path = "/"
+			}
+			if phase == "" {
+				phase = RequestPhase
+			}
+
+			req := httptest.NewRequest(method, "http://example.com"+path, nil)
+			req = req.WithContext(requestid.WithContext(req.Context(), "request-id"))
+			header := http.Header{}
+			for headerName, values := range testCase.header {
+				header[headerName] = append([]string{}, values...)
+			}
+
+			if err := Apply(rules, phase, req, header); err != nil {
+				t.Fatalf("Failed to apply rules: %v", err)
+			}
+			if !reflect.DeepEqual(header, testCase.expectedHeader) {
+				t.Fatalf("Expected header %v, got %v", testCase.expectedHeader, header)
+			}
+		})
+	}
+}
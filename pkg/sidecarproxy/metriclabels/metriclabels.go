@@ -0,0 +1,205 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package metriclabels
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/v3io/sidecar-proxy/pkg/common"
+
+	"github.com/nuclio/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	NamespaceLabelName    = "namespace"
+	ServiceNameLabelName  = "service_name"
+	InstanceNameLabelName = "instance_name"
+)
+
+// label names some metrics are labeled by (e.g. num_of_requests' method), which configured labels mustn't collide with
+var reservedLabelNames = []string{"code", "endpoint", "method", "protocol", "reason", "route", "rule", "state"}
+
+type Configuration struct {
+
+	// extra labels with fixed values, by label name
+	StaticLabels map[string]string
+
+	// extra labels whose values are read from the pod's labels / annotations, as exposed by the downward API.
+	// maps label name to the pod label / annotation key
+	PodLabels              map[string]string
+	PodAnnotations         map[string]string
+	PodLabelsFilePath      string
+	PodAnnotationsFilePath string
+
+	// built-in labels (namespace, service_name, instance_name) to rename (by built-in name) or drop
+	RenamedLabels map[string]string
+	DroppedLabels []string
+}
+
+// LabelSet holds the labels (names and values) every metric is labeled with
+type LabelSet struct {
+	names  []string
+	labels prometheus.Labels
+}
+
+func NewLabelSet(configuration Configuration,
+	namespace string,
+	serviceName string,
+	instanceName string) (*LabelSet, error) {
+	labelSet := LabelSet{labels: prometheus.Labels{}}
+
+	builtinLabels := []struct {
+		name  string
+		value string
+	}{
+		{NamespaceLabelName, namespace},
+		{ServiceNameLabelName, serviceName},
+		{InstanceNameLabelName, instanceName},
+	}
+	builtinLabelNames := []string{NamespaceLabelName, ServiceNameLabelName, InstanceNameLabelName}
+
+	for renamedLabelName := range configuration.RenamedLabels {
+		if !common.StringInSlice(renamedLabelName, builtinLabelNames) {
+			return nil, errors.Errorf("Only built-in labels can be renamed: %s", renamedLabelName)
+		}
+	}
+	for _, droppedLabelName := range configuration.DroppedLabels {
+		if !common.StringInSlice(droppedLabelName, builtinLabelNames) {
+			return nil, errors.Errorf("Only built-in labels can be dropped: %s", droppedLabelName)
+		}
+	}
+
+	for _, builtinLabel := range builtinLabels {
+		if common.StringInSlice(builtinLabel.name, configuration.DroppedLabels) {
+			continue
+		}
+		labelName := builtinLabel.name
+		if renamedLabelName, renamed := configuration.RenamedLabels[builtinLabel.name]; renamed {
+			labelName = renamedLabelName
+		}
+		if err := labelSet.add(labelName, builtinLabel.value); err != nil {
+			return nil, errors.Wrap(err, "Failed to add built-in label")
+		}
+	}
+
+	for _, labelName := range sortedKeys(configuration.StaticLabels) {
+		if err := labelSet.add(labelName, configuration.StaticLabels[labelName]); err != nil {
+			return nil, errors.Wrap(err, "Failed to add static label")
+		}
+	}
+
+	if err := labelSet.addFromDownwardAPIFile(configuration.PodLabels, configuration.PodLabelsFilePath); err != nil {
+		return nil, errors.Wrap(err, "Failed to add labels from pod labels")
+	}
+	if err := labelSet.addFromDownwardAPIFile(configuration.PodAnnotations, configuration.PodAnnotationsFilePath); err != nil {
+		return nil, errors.Wrap(err, "Failed to add labels from pod annotations")
+	}
+
+	return &labelSet, nil
+}
+
+// Names returns the label names metrics should be created with, followed by the given metric specific label names
+func (l *LabelSet) Names(extraLabelNames ...string) []string {
+	return append(append([]string{}, l.names...), extraLabelNames...)
+}
+
+// Labels returns the labels of a metric's series, merged with the given metric specific labels
+func (l *LabelSet) Labels(extraLabels prometheus.Labels) prometheus.Labels {
+	labels := prometheus.Labels{}
+	for labelName, labelValue := range l.labels {
+		labels[labelName] = labelValue
+	}
+	for labelName, labelValue := range extraLabels {
+		labels[labelName] = labelValue
+	}
+	return labels
+}
+
+func (l *LabelSet) add(labelName string, labelValue string) error {
+	if !model.LabelName(labelName).IsValidLegacy() {
+		return errors.Errorf("Invalid label name: %s", labelName)
+	}
+	if strings.HasPrefix(labelName, model.ReservedLabelPrefix) || common.StringInSlice(labelName, reservedLabelNames) {
+		return errors.Errorf("Reserved label name: %s", labelName)
+	}
+	if _, exists := l.labels[labelName]; exists {
+		return errors.Errorf("Duplicate label name: %s", labelName)
+	}
+
+	l.names = append(l.names, labelName)
+	l.labels[labelName] = labelValue
+	return nil
+}
+
+func (l *LabelSet) addFromDownwardAPIFile(keysByLabelName map[string]string, filePath string) error {
+	if len(keysByLabelName) == 0 {
+		return nil
+	}
+
+	values, err := readDownwardAPIFile(filePath)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read downward API file: %s", filePath)
+	}
+
+	// a missing key yields an empty value rather than an error, pods may be created without it
+	for _, labelName := range sortedKeys(keysByLabelName) {
+		if err := l.add(labelName, values[keysByLabelName[labelName]]); err != nil {
+			return errors.Wrap(err, "Failed to add label")
+		}
+	}
+	return nil
+}
+
+// readDownwardAPIFile reads a file of key="value" lines, as written by the downward API for labels and annotations
+func readDownwardAPIFile(filePath string) (map[string]string, error) {
+
+	// read the whole file rather than scanning it, annotations (e.g. kubectl's last applied configuration) can be
+	// longer than a scanner's maximal line
+	fileContents, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read file: %s", filePath)
+	}
+
+	values := map[string]string{}
+	for _, line := range strings.Split(string(fileContents), "\n") {
+		key, quotedValue, found := strings.Cut(strings.TrimSuffix(line, "\r"), "=")
+		if !found {
+			continue
+		}
+
+		value, err := strconv.Unquote(quotedValue)
+		if err != nil {
+			value = quotedValue
+		}
+		values[key] = value
+	}
+
+	return values, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,177 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package metriclabels
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nuclio/errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestNewLabelSet(t *testing.T) {
+	podLabelsFilePath := filepath.Join(t.TempDir(), "labels")
+	if err := os.WriteFile(podLabelsFilePath,
+		[]byte("app=\"jupyter\"\r\nowner=\"a \\\"quoted\\\" name\"\nunquoted=value"),
+		0600); err != nil {
+		t.Fatalf("Failed to write pod labels file: %v", err)
+	}
+
+	for _, testCase := range []struct {
+		name           string
+		configuration  Configuration
+		expectedNames  []string
+		expectedLabels prometheus.Labels
+		expectedError  string
+	}{
+		{
+			name:          "built-in labels",
+			expectedNames: []string{"namespace", "service_name", "instance_name"},
+			expectedLabels: prometheus.Labels{
+				"namespace":     "default-tenant",
+				"service_name":  "jupyter",
+				"instance_name": "jupyter-0",
+			},
+		},
+		{
+			name: "renamed, dropped, static and pod labels",
+			configuration: Configuration{
+				RenamedLabels:     map[string]string{"namespace": "kube_namespace"},
+				DroppedLabels:     []string{"instance_name"},
+				StaticLabels:      map[string]string{"tier": "gold", "env": "dev"},
+				PodLabels:         map[string]string{"app": "app", "owner": "owner", "other": "unquoted", "missing": "nope"},
+				PodLabelsFilePath: podLabelsFilePath,
+			},
+			expectedNames: []string{"kube_namespace", "service_name", "env", "tier", "app", "missing", "other", "owner"},
+			expectedLabels: prometheus.Labels{
+				"kube_namespace": "default-tenant",
+				"service_name":   "jupyter",
+				"env":            "dev",
+				"tier":           "gold",
+				"app":            "jupyter",
+				"missing":        "",
+				"other":          "value",
+				"owner":          `a "quoted" name`,
+			},
+		},
+		{
+			name:          "invalid label name",
+			configuration: Configuration{StaticLabels: map[string]string{"team-name": "a"}},
+			expectedError: "Invalid label name: team-name",
+		},
+		{
+			name:          "label name starting with a digit",
+			configuration: Configuration{StaticLabels: map[string]string{"1st": "a"}},
+			expectedError: "Invalid label name: 1st",
+		},
+		{
+			name:          "reserved prefix",
+			configuration: Configuration{StaticLabels: map[string]string{"__name__": "a"}},
+			expectedError: "Reserved label name: __name__",
+		},
+		{
+			name:          "reserved by a metric",
+			configuration: Configuration{StaticLabels: map[string]string{"state": "a"}},
+			expectedError: "Reserved label name: state",
+		},
+		{
+			name:          "renamed to a reserved name",
+			configuration: Configuration{RenamedLabels: map[string]string{"service_name": "method"}},
+			expectedError: "Reserved label name: method",
+		},
+		{
+			name:          "static label named like a built-in one",
+			configuration: Configuration{StaticLabels: map[string]string{"namespace": "a"}},
+			expectedError: "Duplicate label name: namespace",
+		},
+		{
+			name: "pod label named like a static one",
+			configuration: Configuration{
+				StaticLabels:      map[string]string{"app": "a"},
+				PodLabels:         map[string]string{"app": "app"},
+				PodLabelsFilePath: podLabelsFilePath,
+			},
+			expectedError: "Duplicate label name: app",
+		},
+		{
+			name:          "renamed label that isn't built-in",
+			configuration: Configuration{RenamedLabels: map[string]string{"tier": "level"}},
+			expectedError: "Only built-in labels can be renamed",
+		},
+		{
+			name:          "dropped label that isn't built-in",
+			configuration: Configuration{DroppedLabels: []string{"tier"}},
+			expectedError: "Only built-in labels can be dropped",
+		},
+		{
+			name: "missing pod labels file",
+			configuration: Configuration{
+				PodLabels:         map[string]string{"app": "app"},
+				PodLabelsFilePath: filepath.Join(t.TempDir(), "missing"),
+			},
+			expectedError: "Failed to add labels from pod labels",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			labelSet, err := NewLabelSet(testCase.configuration, "default-tenant", "jupyter", "jupyter-0")
+			if testCase.expectedError != "" {
+				if err == nil || !strings.Contains(errors.GetErrorStackString(err, 10), testCase.expectedError) {
+					t.Fatalf("Expected error containing %q, got %v", testCase.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if names := labelSet.Names(); !reflect.DeepEqual(names, testCase.expectedNames) {
+				t.Fatalf("Expected names %v, got %v", testCase.expectedNames, names)
+			}
+			if labels := labelSet.Labels(nil); !reflect.DeepEqual(labels, testCase.expectedLabels) {
+				t.Fatalf("Expected labels %v, got %v", testCase.expectedLabels, labels)
+			}
+		})
+	}
+}
+
+func TestLabelSetExtraLabels(t *testing.T) {
+	labelSet, err := NewLabelSet(Configuration{DroppedLabels: []string{"namespace", "instance_name"}},
+		"default-tenant",
+		"jupyter",
+		"jupyter-0")
+	if err != nil {
+		t.Fatalf("Failed to create label set: %v", err)
+	}
+
+	if names := labelSet.Names("state"); !reflect.DeepEqual(names, []string{"service_name", "state"}) {
+		t.Fatalf("Unexpected names: %v", names)
+	}
+
+	// the label set's own names aren't changed by extra names
+	if names := labelSet.Names(); !reflect.DeepEqual(names, []string{"service_name"}) {
+		t.Fatalf("Unexpected names: %v", names)
+	}
+
+	labels := labelSet.Labels(prometheus.Labels{"state": "busy"})
+	if !reflect.DeepEqual(labels, prometheus.Labels{"service_name": "jupyter", "state": "busy"}) {
+		t.Fatalf("Unexpected labels: %v", labels)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abstract
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/nuclio/errors"
+)
+
+// GetJSON gets the endpoint (a URL), unmarshalling its response into out
+func (m *MetricsHandler) GetJSON(ctx context.Context, endpoint string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to create request to endpoint: %s", endpoint)
+	}
+	return m.doJSON(req, out)
+}
+
+// PostJSON posts in, marshalled, to the endpoint (a URL), unmarshalling its response into out
+func (m *MetricsHandler) PostJSON(ctx context.Context, endpoint string, in interface{}, out interface{}) error {
+	requestBody, err := json.Marshal(in)
+	if err != nil {
+		return errors.Wrap(err, "Failed to marshal request body")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(requestBody))
+	if err != nil {
+		return errors.Wrapf(err, "Failed to create request to endpoint: %s", endpoint)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return m.doJSON(req, out)
+}
+
+func (m *MetricsHandler) doJSON(req *http.Request, out interface{}) error {
+	endpoint := req.URL.String()
+	resp, err := m.HTTPClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to send request to endpoint: %s", endpoint)
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "Failed to read response body")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("Endpoint %s responded with status %d: %s", endpoint, resp.StatusCode, body)
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return errors.Wrapf(err, "Failed to unmarshal response body: %s", body)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abstract
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
+
+	"github.com/nuclio/loggerus"
+)
+
+type testBody struct {
+	Value string `json:"value"`
+}
+
+func TestJSON(t *testing.T) {
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.URL.Path == "/get" && req.Method == http.MethodGet:
+			w.Write([]byte(`{"value": "got"}`)) // nolint: errcheck
+		case req.URL.Path == "/post" && req.Method == http.MethodPost &&
+			req.Header.Get("Content-Type") == "application/json":
+
+			// echo the posted body back
+			var body testBody
+			json.NewDecoder(req.Body).Decode(&body) // nolint: errcheck
+			json.NewEncoder(w).Encode(body)         // nolint: errcheck
+		case req.URL.Path == "/invalid":
+			w.Write([]byte(`not json`)) // nolint: errcheck
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer service.Close()
+
+	logger, err := loggerus.NewLoggerusForTests("test")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	metricsHandler, err := NewMetricsHandler(logger, metricshandler.Configuration{}, "test")
+	if err != nil {
+		t.Fatalf("Failed to create metrics handler: %v", err)
+	}
+
+	for _, testCase := range []struct {
+		name          string
+		path          string
+		requestBody   *testBody
+		expectedValue string
+		expectedError string
+	}{
+		{name: "get", path: "/get", expectedValue: "got"},
+		{name: "post", path: "/post", requestBody: &testBody{Value: "posted"}, expectedValue: "posted"},
+		{name: "error status", path: "/missing", expectedError: "responded with status 404"},
+		{name: "invalid body", path: "/invalid", expectedError: "Failed to unmarshal response body"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			var responseBody testBody
+			if testCase.requestBody != nil {
+				err = metricsHandler.PostJSON(context.Background(),
+					service.URL+testCase.path,
+					testCase.requestBody,
+					&responseBody)
+			} else {
+				err = metricsHandler.GetJSON(context.Background(), service.URL+testCase.path, &responseBody)
+			}
+
+			if testCase.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), testCase.expectedError) {
+					t.Fatalf("Expected error containing %q, got %v", testCase.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if responseBody.Value != testCase.expectedValue {
+				t.Fatalf("Expected value %q, got %q", testCase.expectedValue, responseBody.Value)
+			}
+		})
+	}
+}
@@ -16,35 +16,346 @@
 package abstract
 
 import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/tracing"
 
+	"github.com/nuclio/errors"
 	"github.com/nuclio/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 type MetricsHandler struct {
-	Logger         logger.Logger
-	ForwardAddress string
-	ListenAddress  string
-	Namespace      string
-	ServiceName    string
-	InstanceName   string
-	MetricName     metricshandler.MetricName
+	metricshandler.Configuration
+	Logger     logger.Logger
+	MetricName metricshandler.MetricName
+
+	// used by GetJSON and PostJSON to query the services handlers poll
+	HTTPClient *http.Client
+
+	statusLock     sync.Mutex
+	collectors     []prometheus.Collector
+	running        bool
+	startTime      time.Time
+	lastUpdateTime time.Time
+	lastError      error
+	lastErrorTime  time.Time
+
+	// the forward address can change at runtime, so it's read with GetForwardAddress rather than ForwardAddress
+	forwardAddressLock sync.RWMutex
+	forwardAddress     string
+
+	pollLock        sync.Mutex
+	update          func() error
+	pollInterval    time.Duration
+	pollTicker      *time.Ticker
+	stopPollingChan chan struct{}
 }
 
 func NewMetricsHandler(logger logger.Logger,
-	forwardAddress string,
-	listenAddress string,
-	namespace string,
-	serviceName string,
-	instanceName string,
+	configuration metricshandler.Configuration,
 	metricName metricshandler.MetricName) (*MetricsHandler, error) {
 	return &MetricsHandler{
+		Configuration:  configuration,
 		Logger:         logger,
-		ForwardAddress: forwardAddress,
-		ListenAddress:  listenAddress,
-		Namespace:      namespace,
-		ServiceName:    serviceName,
-		InstanceName:   instanceName,
 		MetricName:     metricName,
+		HTTPClient:     &http.Client{Transport: tracing.NewTransport(http.DefaultTransport), Timeout: 10 * time.Second},
+		forwardAddress: configuration.ForwardAddress,
 	}, nil
 }
+
+func (m *MetricsHandler) GetForwardAddress() string {
+	m.forwardAddressLock.RLock()
+	defer m.forwardAddressLock.RUnlock()
+	return m.forwardAddress
+}
+
+// SetForwardAddress changes the address of the upstream, handlers that hold state derived from it should override it
+func (m *MetricsHandler) SetForwardAddress(forwardAddress string) error {
+	m.forwardAddressLock.Lock()
+	defer m.forwardAddressLock.Unlock()
+	m.forwardAddress = forwardAddress
+	return nil
+}
+
+// RegisterMetric registers the collector and keeps it, so its values are included in the handler's status
+func (m *MetricsHandler) RegisterMetric(registerer prometheus.Registerer, collector prometheus.Collector) error {
+	if err := registerer.Register(collector); err != nil {
+		return err
+	}
+
+	m.statusLock.Lock()
+	defer m.statusLock.Unlock()
+	m.collectors = append(m.collectors, collector)
+	return nil
+}
+
+// RegisterGauge creates a gauge labeled by the metric labels followed by the given label names, and registers it with
+// RegisterMetric
+func (m *MetricsHandler) RegisterGauge(registerer prometheus.Registerer,
+	metricName metricshandler.MetricName,
+	help string,
+	extraLabelNames ...string) (*prometheus.GaugeVec, error) {
+	gaugeVec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: m.MetricNamespace,
+		Subsystem: m.MetricSubsystem,
+		Name:      string(metricName),
+		Help:      help,
+	}, m.MetricLabels.Names(extraLabelNames...))
+
+	if err := m.RegisterMetric(registerer, gaugeVec); err != nil {
+		return nil, errors.Wrapf(err, "Failed to register metric: %s", string(metricName))
+	}
+
+	m.Logger.InfoWith("Metric registered successfully", "metricName", string(metricName))
+	return gaugeVec, nil
+}
+
+// UnregisterMetrics unregisters the collectors registered with RegisterMetric, so a stopped handler's metrics
+// aren't exported with stale values
+func (m *MetricsHandler) UnregisterMetrics(registerer prometheus.Registerer) {
+	m.statusLock.Lock()
+	defer m.statusLock.Unlock()
+
+	for _, collector := range m.collectors {
+		registerer.Unregister(collector)
+	}
+	m.collectors = nil
+}
+
+// Stop stops polling, handlers that need to release other resources should override it
+func (m *MetricsHandler) Stop() error {
+	m.StopPolling()
+	m.MarkStopped()
+	return nil
+}
+
+// Probe updates the handler's metrics once, without starting it. Handlers that only count events (rather than
+// collect values) have nothing to probe
+func (m *MetricsHandler) Probe() error {
+	m.pollLock.Lock()
+	update := m.update
+	m.pollLock.Unlock()
+
+	if update == nil {
+		return nil
+	}
+	return update()
+}
+
+// ConfigurePolling marks the handler as one that polls, calling update every defaultInterval unless configured or
+// changed
+func (m *MetricsHandler) ConfigurePolling(defaultInterval time.Duration, update func() error) {
+	m.pollLock.Lock()
+	defer m.pollLock.Unlock()
+
+	m.update = update
+	m.pollInterval = defaultInterval
+	if configuredInterval := m.PollIntervals[m.MetricName]; configuredInterval > 0 {
+		m.pollInterval = configuredInterval
+	}
+}
+
+// StartPolling polls every poll interval, until StopPolling is called
+func (m *MetricsHandler) StartPolling() error {
+	m.pollLock.Lock()
+	defer m.pollLock.Unlock()
+
+	if m.pollInterval <= 0 {
+		return errors.New("Polling isn't configured")
+	}
+	if m.pollTicker != nil {
+		return errors.New("Already polling")
+	}
+
+	ticker := time.NewTicker(m.pollInterval)
+	stopPollingChan := make(chan struct{})
+	m.pollTicker = ticker
+	m.stopPollingChan = stopPollingChan
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				m.Poll()
+			case <-stopPollingChan:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Poll updates the handler's metrics once, recording the outcome in its status
+func (m *MetricsHandler) Poll() {
+	m.pollLock.Lock()
+	update := m.update
+	m.pollLock.Unlock()
+
+	if err := update(); err != nil {
+		m.Logger.WarnWith("Failed updating metric", "err", errors.GetErrorStackString(err, 10))
+		m.MarkFailed(err)
+		return
+	}
+	m.MarkUpdated()
+}
+
+func (m *MetricsHandler) StopPolling() {
+	m.pollLock.Lock()
+	defer m.pollLock.Unlock()
+
+	if m.pollTicker == nil {
+		return
+	}
+	m.pollTicker.Stop()
+	close(m.stopPollingChan)
+	m.pollTicker = nil
+	m.stopPollingChan = nil
+}
+
+// SetPollInterval changes the poll interval, taking effect immediately if the handler is polling
+func (m *MetricsHandler) SetPollInterval(interval time.Duration) error {
+	m.pollLock.Lock()
+	defer m.pollLock.Unlock()
+
+	if m.pollInterval <= 0 {
+		return errors.Errorf("Metrics handler %s doesn't poll", m.MetricName)
+	}
+	if interval <= 0 {
+		return errors.New("Poll interval must be positive")
+	}
+
+	m.pollInterval = interval
+	if m.pollTicker != nil {
+		m.pollTicker.Reset(interval)
+	}
+	return nil
+}
+
+func (m *MetricsHandler) Name() metricshandler.MetricName {
+	return m.MetricName
+}
+
+func (m *MetricsHandler) IsRunning() bool {
+	m.statusLock.Lock()
+	defer m.statusLock.Unlock()
+	return m.running
+}
+
+// GetPollInterval returns the current poll interval, 0 if the handler doesn't poll
+func (m *MetricsHandler) GetPollInterval() time.Duration {
+	m.pollLock.Lock()
+	defer m.pollLock.Unlock()
+	return m.pollInterval
+}
+
+func (m *MetricsHandler) MarkStarted() {
+	m.statusLock.Lock()
+	defer m.statusLock.Unlock()
+	m.running = true
+	m.startTime = time.Now()
+}
+
+func (m *MetricsHandler) MarkStopped() {
+	m.statusLock.Lock()
+	defer m.statusLock.Unlock()
+	m.running = false
+}
+
+// MarkUpdated records that the handler's metrics were successfully updated
+func (m *MetricsHandler) MarkUpdated() {
+	m.statusLock.Lock()
+	defer m.statusLock.Unlock()
+	m.lastUpdateTime = time.Now()
+}
+
+// MarkFailed records an error the handler encountered while collecting or serving
+func (m *MetricsHandler) MarkFailed(err error) {
+	m.statusLock.Lock()
+	defer m.statusLock.Unlock()
+	m.lastError = err
+	m.lastErrorTime = time.Now()
+}
+
+func (m *MetricsHandler) Status() metricshandler.Status {
+	pollInterval := m.GetPollInterval()
+
+	m.statusLock.Lock()
+	status := metricshandler.Status{
+		Name:           m.MetricName,
+		Running:        m.running,
+		StartTime:      timeOrNil(m.startTime),
+		LastUpdateTime: timeOrNil(m.lastUpdateTime),
+		LastErrorTime:  timeOrNil(m.lastErrorTime),
+		Metrics:        []metricshandler.MetricStatus{},
+	}
+	if m.lastError != nil {
+		status.LastError = m.lastError.Error()
+	}
+	if pollInterval > 0 {
+		status.PollInterval = pollInterval.String()
+	}
+	collectors := append([]prometheus.Collector{}, m.collectors...)
+	m.statusLock.Unlock()
+
+	// gather through a registry of our own, holding only this handler's collectors
+	registry := prometheus.NewRegistry()
+	for _, collector := range collectors {
+		if err := registry.Register(collector); err != nil {
+			m.Logger.WarnWith("Failed to register collector for status", "err", err.Error())
+		}
+	}
+
+	metricFamilies, err := registry.Gather()
+	if err != nil {
+		m.Logger.WarnWith("Failed to gather metrics for status", "err", err.Error())
+	}
+
+	for _, metricFamily := range metricFamilies {
+		metricStatus := metricshandler.MetricStatus{
+			Name:    metricFamily.GetName(),
+			Type:    strings.ToLower(metricFamily.GetType().String()),
+			Samples: []metricshandler.SampleStatus{},
+		}
+		for _, metric := range metricFamily.GetMetric() {
+			sampleStatus := metricshandler.SampleStatus{
+				Labels: map[string]string{},
+				Value:  getValue(metric),
+			}
+			for _, labelPair := range metric.GetLabel() {
+				sampleStatus.Labels[labelPair.GetName()] = labelPair.GetValue()
+			}
+			metricStatus.Samples = append(metricStatus.Samples, sampleStatus)
+		}
+		status.Metrics = append(status.Metrics, metricStatus)
+	}
+
+	return status
+}
+
+func getValue(metric *dto.Metric) float64 {
+	switch {
+	case metric.Counter != nil:
+		return metric.GetCounter().GetValue()
+	case metric.Gauge != nil:
+		return metric.GetGauge().GetValue()
+	case metric.Summary != nil:
+		return float64(metric.GetSummary().GetSampleCount())
+	case metric.Histogram != nil:
+		return float64(metric.GetHistogram().GetSampleCount())
+	default:
+		return metric.GetUntyped().GetValue()
+	}
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
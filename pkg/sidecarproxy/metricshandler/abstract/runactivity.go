@@ -0,0 +1,50 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package abstract
+
+import (
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RunActivityMetrics are the metrics of services whose activity is their runs and their UI (e.g. TensorBoard, MLflow)
+type RunActivityMetrics struct {
+	Metric           *prometheus.GaugeVec
+	ActiveRunsMetric *prometheus.GaugeVec
+	UIInUseMetric    *prometheus.GaugeVec
+}
+
+// SetRunActivityMetrics sets a service's run activity metrics, the service being active while a run is active, its
+// UI is in use or there's connection activity (e.g. an open SSH connection)
+func (m *MetricsHandler) SetRunActivityMetrics(metrics *RunActivityMetrics, activeRuns int, uiInUse bool) {
+	labels := m.MetricLabels.Labels(nil)
+
+	uiInUseValue := 0
+	if uiInUse {
+		uiInUseValue = 1
+	}
+	connectionActive := m.ConnectionTracker != nil &&
+		m.ConnectionTracker.ActiveWithin(metricshandler.ConnectionActivityWindow)
+	metricValue := 0
+	if activeRuns > 0 || uiInUse || connectionActive {
+		metricValue = 1
+	}
+	m.Logger.DebugWith("Setting metric", "metricValue", metricValue, "labels", labels)
+	metrics.Metric.With(labels).Set(float64(metricValue))
+	metrics.ActiveRunsMetric.With(labels).Set(float64(activeRuns))
+	metrics.UIInUseMetric.With(labels).Set(float64(uiInUseValue))
+}
@@ -0,0 +1,51 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package metricshandler
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ActivityTracker records when activity (e.g. a forwarded request) was last seen, so that handlers can tell whether
+// a service is in use without collecting it themselves
+type ActivityTracker struct {
+	lastActivityTime atomic.Int64
+}
+
+func NewActivityTracker() *ActivityTracker {
+	return &ActivityTracker{}
+}
+
+// Track records activity seen now
+func (t *ActivityTracker) Track() {
+	t.lastActivityTime.Store(time.Now().UnixNano())
+}
+
+// LastActivityTime returns when activity was last seen, or the zero time if none was
+func (t *ActivityTracker) LastActivityTime() time.Time {
+	lastActivityTime := t.lastActivityTime.Load()
+	if lastActivityTime == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, lastActivityTime)
+}
+
+// ActiveWithin returns true if activity was seen within the given duration
+func (t *ActivityTracker) ActiveWithin(duration time.Duration) bool {
+	lastActivityTime := t.LastActivityTime()
+	return !lastActivityTime.IsZero() && time.Since(lastActivityTime) < duration
+}
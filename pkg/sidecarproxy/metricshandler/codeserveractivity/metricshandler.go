@@ -0,0 +1,212 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package codeserveractivity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler/abstract"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/tracing"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+type metricsHandler struct {
+	*abstract.MetricsHandler
+	metric                      *prometheus.GaugeVec
+	secondsSinceHeartbeatMetric *prometheus.GaugeVec
+	httpClient                  *http.Client
+}
+
+func NewMetricsHandler(logger logger.Logger,
+	configuration metricshandler.Configuration) (metricshandler.MetricsHandler, error) {
+
+	codeServerActivityMetricsHandler := metricsHandler{}
+	abstractMetricsHandler, err := abstract.NewMetricsHandler(
+		logger.GetChild(string(metricshandler.CodeServerActivityMetricName)),
+		configuration,
+		metricshandler.CodeServerActivityMetricName)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create abstract metric handler")
+	}
+
+	codeServerActivityMetricsHandler.MetricsHandler = abstractMetricsHandler
+	codeServerActivityMetricsHandler.ConfigurePolling(5*time.Second, codeServerActivityMetricsHandler.updateMetric)
+	codeServerActivityMetricsHandler.httpClient = &http.Client{
+		Transport: tracing.NewTransport(http.DefaultTransport),
+		Timeout:   10 * time.Second,
+	}
+
+	return &codeServerActivityMetricsHandler, nil
+}
+
+func (n *metricsHandler) RegisterMetrics(registerer prometheus.Registerer) error {
+	gaugeVec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: n.MetricNamespace,
+		Subsystem: n.MetricSubsystem,
+		Name:      string(n.MetricName),
+		Help:      "code-server activity, 1 while code-server reports a recent heartbeat",
+	}, n.MetricLabels.Names())
+
+	if err := n.RegisterMetric(registerer, gaugeVec); err != nil {
+		return errors.Wrapf(err, "Failed to register metric: %s", string(n.MetricName))
+	}
+
+	n.Logger.InfoWith("Metric registered successfully", "metricName", string(n.MetricName))
+	n.metric = gaugeVec
+
+	secondsSinceHeartbeatGaugeVec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: n.MetricNamespace,
+		Subsystem: n.MetricSubsystem,
+		Name:      string(metricshandler.CodeServerSecondsSinceHeartbeatMetricName),
+		Help:      "Seconds since code-server's last heartbeat, absent until there is one",
+	}, n.MetricLabels.Names())
+
+	if err := n.RegisterMetric(registerer, secondsSinceHeartbeatGaugeVec); err != nil {
+		return errors.Wrapf(err, "Failed to register metric: %s",
+			string(metricshandler.CodeServerSecondsSinceHeartbeatMetricName))
+	}
+
+	n.Logger.InfoWith("Metric registered successfully",
+		"metricName", string(metricshandler.CodeServerSecondsSinceHeartbeatMetricName))
+	n.secondsSinceHeartbeatMetric = secondsSinceHeartbeatGaugeVec
+
+	return nil
+}
+
+func (n *metricsHandler) Start() error {
+	n.Logger.InfoWith("Starting code-server activity metrics handler",
+		"heartbeatFilePath", n.CodeServerHeartbeatFilePath)
+	if err := n.StartPolling(); err != nil {
+		return errors.Wrap(err, "Failed to start polling")
+	}
+	n.MarkStarted()
+	return nil
+}
+
+func (n *metricsHandler) updateMetric() error {
+	ctx, span := tracing.Tracer().Start(context.Background(), "code-server read heartbeat")
+	defer span.End()
+
+	var currentHeartbeat heartbeat
+	var err error
+	if n.CodeServerHeartbeatFilePath != "" {
+		currentHeartbeat, err = n.readHeartbeatFile()
+	} else {
+		currentHeartbeat, err = n.getHealthz(ctx)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return errors.Wrap(err, "Failed to read heartbeat")
+	}
+
+	span.SetAttributes(attribute.Bool("code_server.alive", currentHeartbeat.alive))
+	n.setMetrics(currentHeartbeat)
+
+	return nil
+}
+
+// getHealthz reads the heartbeat from code-server's /healthz endpoint
+func (n *metricsHandler) getHealthz(ctx context.Context) (heartbeat, error) {
+	healthzEndpoint := fmt.Sprintf("http://%s/healthz", n.GetForwardAddress())
+	n.Logger.DebugWith("Getting code-server health")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, healthzEndpoint, nil)
+	if err != nil {
+		return heartbeat{}, errors.Wrapf(err, "Failed to create request to healthz endpoint: %s", healthzEndpoint)
+	}
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return heartbeat{}, errors.Wrapf(err, "Failed to send request to healthz endpoint: %s", healthzEndpoint)
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return heartbeat{}, errors.Wrap(err, "Failed to read response body")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return heartbeat{}, errors.Errorf("Healthz endpoint responded with status %d: %s", resp.StatusCode, body)
+	}
+
+	var healthz healthzResponse
+	if err := json.Unmarshal(body, &healthz); err != nil {
+		return heartbeat{}, errors.Wrapf(err, "Failed to unmarshal response body: %s", body)
+	}
+
+	currentHeartbeat := heartbeat{}
+	switch healthz.Status {
+	case AliveHeartbeatStatus:
+		currentHeartbeat.alive = true
+	case ExpiredHeartbeatStatus:
+		currentHeartbeat.alive = false
+	default:
+		return heartbeat{}, errors.Errorf("Unknown heartbeat status: %s", healthz.Status)
+	}
+	if healthz.LastHeartbeat > 0 {
+		currentHeartbeat.lastHeartbeatTime = time.UnixMilli(healthz.LastHeartbeat)
+	}
+
+	n.Logger.DebugWith("Successfully got code-server health",
+		"status", healthz.Status,
+		"lastHeartbeat", healthz.LastHeartbeat)
+	return currentHeartbeat, nil
+}
+
+// readHeartbeatFile reads the heartbeat from the modification time of code-server's heartbeat file, which
+// code-server touches while there is activity
+func (n *metricsHandler) readHeartbeatFile() (heartbeat, error) {
+	fileInfo, err := os.Stat(n.CodeServerHeartbeatFilePath)
+	if err != nil {
+
+		// code-server creates the file on the first heartbeat
+		if os.IsNotExist(err) {
+			return heartbeat{}, nil
+		}
+		return heartbeat{}, errors.Wrapf(err, "Failed to stat heartbeat file: %s", n.CodeServerHeartbeatFilePath)
+	}
+
+	return heartbeat{
+		alive:             time.Since(fileInfo.ModTime()) < heartbeatExpiry,
+		lastHeartbeatTime: fileInfo.ModTime(),
+	}, nil
+}
+
+func (n *metricsHandler) setMetrics(currentHeartbeat heartbeat) {
+	labels := n.MetricLabels.Labels(nil)
+
+	metricValue := 0
+	if currentHeartbeat.alive {
+		metricValue = 1
+	}
+	n.Logger.DebugWith("Setting metric", "metricValue", metricValue, "labels", labels)
+	n.metric.With(labels).Set(float64(metricValue))
+
+	if !currentHeartbeat.lastHeartbeatTime.IsZero() {
+		n.secondsSinceHeartbeatMetric.With(labels).Set(time.Since(currentHeartbeat.lastHeartbeatTime).Seconds())
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package codeserveractivity
+
+import (
+	"time"
+)
+
+// code-server considers itself idle once no heartbeat was recorded for a minute
+const heartbeatExpiry = 60 * time.Second
+
+// healthzResponse is code-server's /healthz response
+type healthzResponse struct {
+	Status HeartbeatStatus `json:"status"`
+
+	// unix time (ms) of the last heartbeat, 0 if there wasn't one yet
+	LastHeartbeat int64 `json:"lastHeartbeat"`
+}
+
+type HeartbeatStatus string
+
+const (
+	AliveHeartbeatStatus   HeartbeatStatus = "alive"
+	ExpiredHeartbeatStatus HeartbeatStatus = "expired"
+)
+
+// heartbeat is the activity state, read either from /healthz or from the heartbeat file
+type heartbeat struct {
+	alive bool
+
+	// zero if there wasn't a heartbeat yet
+	lastHeartbeatTime time.Time
+}
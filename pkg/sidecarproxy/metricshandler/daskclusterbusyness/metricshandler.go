@@ -0,0 +1,140 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package daskclusterbusyness
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler/abstract"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/tracing"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+type metricsHandler struct {
+	*abstract.MetricsHandler
+	metric        *prometheus.GaugeVec
+	tasksMetric   *prometheus.GaugeVec
+	workersMetric *prometheus.GaugeVec
+}
+
+func NewMetricsHandler(logger logger.Logger,
+	configuration metricshandler.Configuration) (metricshandler.MetricsHandler, error) {
+
+	if configuration.DaskDashboardAddress == "" {
+		configuration.DaskDashboardAddress = metricshandler.DefaultDaskDashboardAddress
+	}
+
+	daskClusterBusynessMetricsHandler := metricsHandler{}
+	abstractMetricsHandler, err := abstract.NewMetricsHandler(
+		logger.GetChild(string(metricshandler.DaskClusterBusynessMetricName)),
+		configuration,
+		metricshandler.DaskClusterBusynessMetricName)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create abstract metric handler")
+	}
+
+	daskClusterBusynessMetricsHandler.MetricsHandler = abstractMetricsHandler
+	daskClusterBusynessMetricsHandler.ConfigurePolling(10*time.Second, daskClusterBusynessMetricsHandler.updateMetric)
+
+	return &daskClusterBusynessMetricsHandler, nil
+}
+
+func (n *metricsHandler) RegisterMetrics(registerer prometheus.Registerer) error {
+	var err error
+	if n.metric, err = n.RegisterGauge(registerer,
+		n.MetricName,
+		"Dask cluster busyness, 1 while the scheduler has running or pending tasks"); err != nil {
+		return err
+	}
+	if n.tasksMetric, err = n.RegisterGauge(registerer,
+		metricshandler.DaskTasksMetricName,
+		"Number of Dask tasks, by state (running, pending)",
+		"state"); err != nil {
+		return err
+	}
+	if n.workersMetric, err = n.RegisterGauge(registerer,
+		metricshandler.DaskWorkersMetricName,
+		"Number of Dask workers"); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (n *metricsHandler) Start() error {
+	n.Logger.InfoWith("Starting Dask cluster busyness metrics handler", "dashboardAddress", n.DaskDashboardAddress)
+	if err := n.StartPolling(); err != nil {
+		return errors.Wrap(err, "Failed to start polling")
+	}
+	n.MarkStarted()
+	return nil
+}
+
+func (n *metricsHandler) updateMetric() error {
+	ctx, span := tracing.Tracer().Start(context.Background(), "dask poll scheduler")
+	defer span.End()
+
+	counts, err := n.getCounts(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return errors.Wrap(err, "Failed to get scheduler counts")
+	}
+
+	runningTasks := counts.Processing
+	pendingTasks := counts.Waiting + counts.Unrunnable
+	span.SetAttributes(attribute.Int("dask.tasks.running", runningTasks),
+		attribute.Int("dask.tasks.pending", pendingTasks),
+		attribute.Int("dask.workers", counts.Workers))
+	n.setMetrics(runningTasks, pendingTasks, counts.Workers)
+
+	return nil
+}
+
+func (n *metricsHandler) getCounts(ctx context.Context) (countsResponse, error) {
+	n.Logger.DebugWith("Getting Dask scheduler counts")
+
+	var counts countsResponse
+	if err := n.GetJSON(ctx, fmt.Sprintf("http://%s%s", n.DaskDashboardAddress, countsPath), &counts); err != nil {
+		return countsResponse{}, errors.Wrap(err, "Failed to get counts")
+	}
+
+	n.Logger.DebugWith("Successfully got Dask scheduler counts", "counts", counts)
+	return counts, nil
+}
+
+func (n *metricsHandler) setMetrics(runningTasks int, pendingTasks int, workers int) {
+	labels := n.MetricLabels.Labels(nil)
+
+	metricValue := 0
+	if runningTasks > 0 || pendingTasks > 0 {
+		metricValue = 1
+	}
+	n.Logger.DebugWith("Setting metric", "metricValue", metricValue, "labels", labels)
+	n.metric.With(labels).Set(float64(metricValue))
+	n.tasksMetric.With(n.MetricLabels.Labels(prometheus.Labels{"state": string(RunningTaskState)})).
+		Set(float64(runningTasks))
+	n.tasksMetric.With(n.MetricLabels.Labels(prometheus.Labels{"state": string(PendingTaskState)})).
+		Set(float64(pendingTasks))
+	n.workersMetric.With(labels).Set(float64(workers))
+}
@@ -0,0 +1,38 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package daskclusterbusyness
+
+const countsPath = "/json/counts.json"
+
+// countsResponse is (part of) the Dask scheduler's /json/counts.json response
+type countsResponse struct {
+
+	// tasks being processed by workers
+	Processing int `json:"processing"`
+
+	// tasks waiting on other tasks, and tasks that can't run on any of the current workers
+	Waiting    int `json:"waiting"`
+	Unrunnable int `json:"unrunnable"`
+
+	Workers int `json:"workers"`
+}
+
+type TaskState string
+
+const (
+	RunningTaskState TaskState = "running"
+	PendingTaskState TaskState = "pending"
+)
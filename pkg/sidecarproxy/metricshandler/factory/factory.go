@@ -17,27 +17,75 @@ package factory
 
 import (
 	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler/codeserveractivity"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler/daskclusterbusyness"
 	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler/jupyterkernelbusyness"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler/mlflowactivity"
 	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler/numofrequests"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler/numoftcpconnections"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler/rayclusterbusyness"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler/rstudiosessionactivity"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler/sshconnectionactive"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler/tensorboardactivity"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler/upstreammetrics"
 
 	"github.com/nuclio/errors"
 	"github.com/nuclio/logger"
 )
 
+// MetricNames lists the metric names handlers can be created for
+var MetricNames = []metricshandler.MetricName{
+	metricshandler.NumOfRequestsMetricName,
+	metricshandler.NumOfTCPConnectionsMetricName,
+	metricshandler.JupyterKernelBusynessMetricName,
+	metricshandler.SSHConnectionActiveMetricName,
+	metricshandler.CodeServerActivityMetricName,
+	metricshandler.RStudioSessionActivityMetricName,
+	metricshandler.TensorBoardActivityMetricName,
+	metricshandler.MLflowActivityMetricName,
+	metricshandler.RayClusterBusynessMetricName,
+	metricshandler.DaskClusterBusynessMetricName,
+	metricshandler.UpstreamMetricsMetricName,
+}
+
+// IsSupported returns true if a handler can be created for the metric name
+func IsSupported(metricName string) bool {
+	for _, supportedMetricName := range MetricNames {
+		if metricName == string(supportedMetricName) {
+			return true
+		}
+	}
+	return false
+}
+
 func Create(metricName string,
 	logger logger.Logger,
-	forwardAddress string,
-	listenAddress string,
-	namespace string,
-	serviceName string,
-	instanceName string) (metricshandler.MetricsHandler, error) {
+	configuration metricshandler.Configuration) (metricshandler.MetricsHandler, error) {
 	switch metricName {
 	case string(metricshandler.NumOfRequestsMetricName):
-		return numofrequests.NewMetricsHandler(logger, forwardAddress, listenAddress, namespace, serviceName, instanceName)
+		return numofrequests.NewMetricsHandler(logger, configuration)
+	case string(metricshandler.NumOfTCPConnectionsMetricName):
+		return numoftcpconnections.NewMetricsHandler(logger, configuration)
 	case string(metricshandler.JupyterKernelBusynessMetricName):
-		return jupyterkernelbusyness.NewMetricsHandler(logger, forwardAddress, listenAddress, namespace, serviceName, instanceName)
+		return jupyterkernelbusyness.NewMetricsHandler(logger, configuration)
+	case string(metricshandler.SSHConnectionActiveMetricName):
+		return sshconnectionactive.NewMetricsHandler(logger, configuration)
+	case string(metricshandler.CodeServerActivityMetricName):
+		return codeserveractivity.NewMetricsHandler(logger, configuration)
+	case string(metricshandler.RStudioSessionActivityMetricName):
+		return rstudiosessionactivity.NewMetricsHandler(logger, configuration)
+	case string(metricshandler.TensorBoardActivityMetricName):
+		return tensorboardactivity.NewMetricsHandler(logger, configuration)
+	case string(metricshandler.MLflowActivityMetricName):
+		return mlflowactivity.NewMetricsHandler(logger, configuration)
+	case string(metricshandler.RayClusterBusynessMetricName):
+		return rayclusterbusyness.NewMetricsHandler(logger, configuration)
+	case string(metricshandler.DaskClusterBusynessMetricName):
+		return daskclusterbusyness.NewMetricsHandler(logger, configuration)
+	case string(metricshandler.UpstreamMetricsMetricName):
+		return upstreammetrics.NewMetricsHandler(logger, configuration)
 	default:
 		var metricsHandler metricshandler.MetricsHandler
-		return metricsHandler, errors.New("metric handler for this metric name does not exist")
+		return metricsHandler, errors.Errorf("metric handler for this metric name does not exist: %s", metricName)
 	}
 }
@@ -16,6 +16,7 @@
 package jupyterkernelbusyness
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -24,49 +25,51 @@ import (
 
 	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
 	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler/abstract"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/tracing"
 
 	"github.com/nuclio/errors"
 	"github.com/nuclio/logger"
 	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 type metricsHandler struct {
 	*abstract.MetricsHandler
-	metric *prometheus.GaugeVec
+	metric     *prometheus.GaugeVec
+	httpClient *http.Client
 }
 
 func NewMetricsHandler(logger logger.Logger,
-	forwardAddress string,
-	listenAddress string,
-	namespace string,
-	serviceName string,
-	instanceName string) (metricshandler.MetricsHandler, error) {
+	configuration metricshandler.Configuration) (metricshandler.MetricsHandler, error) {
 
 	jupyterKernelBusynessMetricsHandler := metricsHandler{}
 	abstractMetricsHandler, err := abstract.NewMetricsHandler(
 		logger.GetChild(string(metricshandler.JupyterKernelBusynessMetricName)),
-		forwardAddress,
-		listenAddress,
-		namespace,
-		serviceName,
-		instanceName,
+		configuration,
 		metricshandler.JupyterKernelBusynessMetricName)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to create abstract metric handler")
 	}
 
 	jupyterKernelBusynessMetricsHandler.MetricsHandler = abstractMetricsHandler
+	jupyterKernelBusynessMetricsHandler.ConfigurePolling(5*time.Second, jupyterKernelBusynessMetricsHandler.updateMetric)
+	jupyterKernelBusynessMetricsHandler.httpClient = &http.Client{
+		Transport: tracing.NewTransport(http.DefaultTransport),
+	}
 
 	return &jupyterKernelBusynessMetricsHandler, nil
 }
 
-func (n *metricsHandler) RegisterMetrics() error {
+func (n *metricsHandler) RegisterMetrics(registerer prometheus.Registerer) error {
 	gaugeVec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: string(n.MetricName),
-		Help: "Jupyter kernel busyness",
-	}, []string{"namespace", "service_name", "instance_name"})
+		Namespace: n.MetricNamespace,
+		Subsystem: n.MetricSubsystem,
+		Name:      string(n.MetricName),
+		Help:      "Jupyter kernel busyness",
+	}, n.MetricLabels.Names())
 
-	if err := prometheus.Register(gaugeVec); err != nil {
+	if err := n.RegisterMetric(registerer, gaugeVec); err != nil {
 		return errors.Wrapf(err, "Failed to register metric: %s", string(n.MetricName))
 	}
 
@@ -78,24 +81,27 @@ func (n *metricsHandler) RegisterMetrics() error {
 
 func (n *metricsHandler) Start() error {
 	n.Logger.Info("Starting jupyter kernel busyness metrics handler")
-	ticker := time.NewTicker(5 * time.Second)
-	go func() {
-		for range ticker.C {
-			if err := n.updateMetric(); err != nil {
-				n.Logger.WarnWith("Failed updating metric", "err", errors.GetErrorStackString(err, 10))
-			}
-		}
-	}()
+	if err := n.StartPolling(); err != nil {
+		return errors.Wrap(err, "Failed to start polling")
+	}
+	n.MarkStarted()
 	return nil
 }
 
 func (n *metricsHandler) updateMetric() error {
-	kernels, err := n.getKernels()
+	ctx, span := tracing.Tracer().Start(context.Background(), "jupyter poll kernels")
+	defer span.End()
+
+	kernels, err := n.getKernels(ctx)
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return errors.Wrap(err, "Failed to get kernels")
 	}
 
 	busyKernelExists := n.searchBusyKernels(kernels)
+	span.SetAttributes(attribute.Int("jupyter.kernels", len(kernels)),
+		attribute.Bool("jupyter.busy", busyKernelExists))
 	var metricValue int
 	if busyKernelExists {
 		metricValue = 1
@@ -109,12 +115,16 @@ func (n *metricsHandler) updateMetric() error {
 	return nil
 }
 
-func (n *metricsHandler) getKernels() ([]kernel, error) {
+func (n *metricsHandler) getKernels(ctx context.Context) ([]kernel, error) {
 	var parsedKernelsList []kernel
 	var kernelsList []interface{}
-	kernelsEndpoint := fmt.Sprintf("http://%s/api/kernels", n.ForwardAddress)
+	kernelsEndpoint := fmt.Sprintf("http://%s/api/kernels", n.GetForwardAddress())
 	n.Logger.DebugWith("Getting Jupyter kernels")
-	resp, err := http.Get(kernelsEndpoint)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, kernelsEndpoint, nil)
+	if err != nil {
+		return []kernel{}, errors.Wrapf(err, "Failed to create request to kernels endpoint: %s", kernelsEndpoint)
+	}
+	resp, err := n.httpClient.Do(req)
 	if err != nil {
 		return []kernel{}, errors.Wrapf(err, "Failed to send request to kernels endpoint: %s", kernelsEndpoint)
 	}
@@ -162,11 +172,7 @@ func (n *metricsHandler) searchBusyKernels(kernels []kernel) bool {
 }
 
 func (n *metricsHandler) setMetric(metricValue int) {
-	labels := prometheus.Labels{
-		"namespace":     n.Namespace,
-		"service_name":  n.ServiceName,
-		"instance_name": n.InstanceName,
-	}
+	labels := n.MetricLabels.Labels(nil)
 	n.Logger.DebugWith("Setting metric", "metricValue", metricValue, "labels", labels)
 	n.metric.With(labels).Set(float64(metricValue))
 }
@@ -0,0 +1,155 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mlflowactivity
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler/abstract"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/tracing"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+type metricsHandler struct {
+	*abstract.MetricsHandler
+	runActivityMetrics abstract.RunActivityMetrics
+}
+
+func NewMetricsHandler(logger logger.Logger,
+	configuration metricshandler.Configuration) (metricshandler.MetricsHandler, error) {
+
+	mlflowActivityMetricsHandler := metricsHandler{}
+	abstractMetricsHandler, err := abstract.NewMetricsHandler(
+		logger.GetChild(string(metricshandler.MLflowActivityMetricName)),
+		configuration,
+		metricshandler.MLflowActivityMetricName)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create abstract metric handler")
+	}
+
+	mlflowActivityMetricsHandler.MetricsHandler = abstractMetricsHandler
+	mlflowActivityMetricsHandler.ConfigurePolling(30*time.Second, mlflowActivityMetricsHandler.updateMetric)
+
+	return &mlflowActivityMetricsHandler, nil
+}
+
+func (n *metricsHandler) RegisterMetrics(registerer prometheus.Registerer) error {
+	var err error
+	if n.runActivityMetrics.Metric, err = n.RegisterGauge(registerer,
+		n.MetricName,
+		"MLflow activity, 1 while a run is active or the UI is in use"); err != nil {
+		return err
+	}
+	if n.runActivityMetrics.ActiveRunsMetric, err = n.RegisterGauge(registerer,
+		metricshandler.MLflowActiveRunsMetricName,
+		"Number of MLflow runs in the RUNNING status"); err != nil {
+		return err
+	}
+	if n.runActivityMetrics.UIInUseMetric, err = n.RegisterGauge(registerer,
+		metricshandler.MLflowUIInUseMetricName,
+		"MLflow UI usage, 1 while requests were forwarded to MLflow in the last 5 minutes"); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (n *metricsHandler) Start() error {
+	n.Logger.Info("Starting MLflow activity metrics handler")
+	if err := n.StartPolling(); err != nil {
+		return errors.Wrap(err, "Failed to start polling")
+	}
+	n.MarkStarted()
+	return nil
+}
+
+func (n *metricsHandler) updateMetric() error {
+	ctx, span := tracing.Tracer().Start(context.Background(), "mlflow search runs")
+	defer span.End()
+
+	activeRuns, err := n.countActiveRuns(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return errors.Wrap(err, "Failed to count active runs")
+	}
+
+	uiInUse := n.RequestTracker != nil && n.RequestTracker.ActiveWithin(metricshandler.UIInUseWindow)
+	span.SetAttributes(attribute.Int("mlflow.active_runs", activeRuns),
+		attribute.Bool("mlflow.ui_in_use", uiInUse))
+	n.SetRunActivityMetrics(&n.runActivityMetrics, activeRuns, uiInUse)
+
+	return nil
+}
+
+// countActiveRuns counts the runs of all (non deleted) experiments that are in the RUNNING status
+func (n *metricsHandler) countActiveRuns(ctx context.Context) (int, error) {
+	var experimentIDs []string
+	experimentsRequest := searchExperimentsRequest{MaxResults: searchMaxResults}
+	for {
+		var experimentsResponse searchExperimentsResponse
+		if err := n.PostJSON(ctx, n.getURL(searchExperimentsPath), &experimentsRequest, &experimentsResponse); err != nil {
+			return 0, errors.Wrap(err, "Failed to search experiments")
+		}
+		for _, experiment := range experimentsResponse.Experiments {
+			experimentIDs = append(experimentIDs, experiment.ExperimentID)
+		}
+		if experimentsResponse.NextPageToken == "" {
+			break
+		}
+		experimentsRequest.PageToken = experimentsResponse.NextPageToken
+	}
+
+	if len(experimentIDs) == 0 {
+		return 0, nil
+	}
+
+	activeRuns := 0
+	runsRequest := searchRunsRequest{
+		ExperimentIDs: experimentIDs,
+		Filter:        runningRunsFilter,
+		RunViewType:   "ACTIVE_ONLY",
+		MaxResults:    searchMaxResults,
+	}
+	for {
+		var runsResponse searchRunsResponse
+		if err := n.PostJSON(ctx, n.getURL(searchRunsPath), &runsRequest, &runsResponse); err != nil {
+			return 0, errors.Wrap(err, "Failed to search runs")
+		}
+		activeRuns += len(runsResponse.Runs)
+		if runsResponse.NextPageToken == "" {
+			break
+		}
+		runsRequest.PageToken = runsResponse.NextPageToken
+	}
+
+	n.Logger.DebugWith("Successfully counted MLflow active runs",
+		"experiments", len(experimentIDs),
+		"activeRuns", activeRuns)
+	return activeRuns, nil
+}
+
+// getURL returns the URL of a path of MLflow's
+func (n *metricsHandler) getURL(path string) string {
+	return fmt.Sprintf("http://%s%s", n.GetForwardAddress(), path)
+}
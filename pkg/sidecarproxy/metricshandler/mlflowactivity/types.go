@@ -0,0 +1,55 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package mlflowactivity
+
+const (
+	searchExperimentsPath = "/api/2.0/mlflow/experiments/search"
+	searchRunsPath        = "/api/2.0/mlflow/runs/search"
+
+	// maximal page size of the search APIs
+	searchMaxResults = 1000
+
+	runningRunsFilter = "attributes.status = 'RUNNING'"
+)
+
+type searchExperimentsRequest struct {
+	MaxResults int    `json:"max_results"`
+	PageToken  string `json:"page_token,omitempty"`
+}
+
+type searchExperimentsResponse struct {
+	Experiments []struct {
+		ExperimentID string `json:"experiment_id"`
+	} `json:"experiments"`
+	NextPageToken string `json:"next_page_token"`
+}
+
+type searchRunsRequest struct {
+	ExperimentIDs []string `json:"experiment_ids"`
+	Filter        string   `json:"filter"`
+	RunViewType   string   `json:"run_view_type"`
+	MaxResults    int      `json:"max_results"`
+	PageToken     string   `json:"page_token,omitempty"`
+}
+
+type searchRunsResponse struct {
+	Runs []struct {
+		Info struct {
+			RunID string `json:"run_id"`
+		} `json:"info"`
+	} `json:"runs"`
+	NextPageToken string `json:"next_page_token"`
+}
@@ -0,0 +1,135 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package numofrequests
+
+import (
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	httpProtocol = "http"
+	grpcProtocol = "grpc"
+
+	// the method label of requests whose method isn't a standard one, so clients can't blow up its cardinality
+	otherMethod = "other"
+)
+
+// grpcMethodRegexp matches gRPC request paths - /<package>.<service>/<method>
+var grpcMethodRegexp = regexp.MustCompile(`^/[A-Za-z_][A-Za-z0-9_.]*/[A-Za-z_][A-Za-z0-9_]*$`)
+
+// httpMethods are the standard HTTP methods
+var httpMethods = map[string]struct{}{
+	http.MethodGet:     {},
+	http.MethodHead:    {},
+	http.MethodPost:    {},
+	http.MethodPut:     {},
+	http.MethodPatch:   {},
+	http.MethodDelete:  {},
+	http.MethodConnect: {},
+	http.MethodOptions: {},
+	http.MethodTrace:   {},
+}
+
+// grpcCodeNames are the names of gRPC's status codes, by code
+var grpcCodeNames = []string{
+	"OK",
+	"CANCELLED",
+	"UNKNOWN",
+	"INVALID_ARGUMENT",
+	"DEADLINE_EXCEEDED",
+	"NOT_FOUND",
+	"ALREADY_EXISTS",
+	"PERMISSION_DENIED",
+	"RESOURCE_EXHAUSTED",
+	"FAILED_PRECONDITION",
+	"ABORTED",
+	"OUT_OF_RANGE",
+	"UNIMPLEMENTED",
+	"INTERNAL",
+	"UNAVAILABLE",
+	"DATA_LOSS",
+	"UNAUTHENTICATED",
+}
+
+// httpMethodLabel returns the method label of an HTTP request - its method if standard, "other" otherwise
+func httpMethodLabel(req *http.Request) string {
+	if _, found := httpMethods[req.Method]; found {
+		return req.Method
+	}
+	return otherMethod
+}
+
+// grpcMethodLabel returns the method label of a gRPC request - its path if it names a gRPC method, "other" otherwise
+func grpcMethodLabel(req *http.Request) string {
+	if grpcMethodRegexp.MatchString(req.URL.Path) {
+		return req.URL.Path
+	}
+	return otherMethod
+}
+
+// isGRPCRequest returns true for gRPC requests (application/grpc, application/grpc+proto etc.), but not for gRPC-Web
+// ones, which work over HTTP/1
+func isGRPCRequest(req *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/grpc" || strings.HasPrefix(mediaType, "application/grpc+")
+}
+
+// grpcCodeName returns the name of a gRPC response's status, which is a trailer - or a header, if the response has
+// no messages. the reverse proxy copies trailers to the response writer's header (prefixed with
+// http.TrailerPrefix, unless they were announced), so it's looked up there once the response was forwarded
+func grpcCodeName(responseHeader http.Header, statusCode int) string {
+	grpcStatus := responseHeader.Get("Grpc-Status")
+	if grpcStatus == "" {
+		grpcStatus = responseHeader.Get(http.TrailerPrefix + "Grpc-Status")
+	}
+	if grpcStatus == "" {
+		return grpcCodeNameFromHTTPStatus(statusCode)
+	}
+
+	code, err := strconv.Atoi(grpcStatus)
+	if err != nil || code < 0 || code >= len(grpcCodeNames) {
+		return grpcCodeNames[2]
+	}
+	return grpcCodeNames[code]
+}
+
+// grpcCodeNameFromHTTPStatus maps the HTTP status of a response without a gRPC status, as gRPC clients do
+func grpcCodeNameFromHTTPStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return "INTERNAL"
+	case http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "UNIMPLEMENTED"
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return "UNAVAILABLE"
+	default:
+		return "UNKNOWN"
+	}
+}
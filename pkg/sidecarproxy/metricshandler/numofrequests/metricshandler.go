@@ -16,44 +16,45 @@
 package numofrequests
 
 import (
+	"context"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"os"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/v3io/sidecar-proxy/pkg/common"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/activityfilter"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/forwarded"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/headerrule"
 	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
 	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler/abstract"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/requestid"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/tracing"
 
 	"github.com/nuclio/errors"
 	"github.com/nuclio/logger"
 	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type metricsHandler struct {
 	*abstract.MetricsHandler
 	metric             *prometheus.CounterVec
-	proxy              *httputil.ReverseProxy
+	ignoredMetric      *prometheus.CounterVec
+	responsesMetric    *prometheus.CounterVec
+	proxy              atomic.Value // *httputil.ReverseProxy, replaced when the forward address changes
 	lastProxyErrorTime time.Time
 }
 
 func NewMetricsHandler(logger logger.Logger,
-	forwardAddress string,
-	listenAddress string,
-	namespace string,
-	serviceName string,
-	instanceName string) (metricshandler.MetricsHandler, error) {
+	configuration metricshandler.Configuration) (metricshandler.MetricsHandler, error) {
 
 	handler := metricsHandler{}
 	abstractMetricsHandler, err := abstract.NewMetricsHandler(
 		logger.GetChild(string(metricshandler.NumOfRequestsMetricName)),
-		forwardAddress,
-		listenAddress,
-		namespace,
-		serviceName,
-		instanceName,
+		configuration,
 		metricshandler.NumOfRequestsMetricName)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to create abstract metric handler")
@@ -65,45 +66,126 @@ func NewMetricsHandler(logger logger.Logger,
 	return &handler, nil
 }
 
-func (n *metricsHandler) RegisterMetrics() error {
+func (n *metricsHandler) RegisterMetrics(registerer prometheus.Registerer) error {
 	requestsCounter := prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name: string(n.MetricName),
-		Help: "Total number of requests forwarded.",
-	}, []string{"namespace", "service_name", "instance_name"})
+		Namespace: n.MetricNamespace,
+		Subsystem: n.MetricSubsystem,
+		Name:      string(n.MetricName),
+		Help:      "Total number of requests forwarded.",
+	}, n.MetricLabels.Names())
 
-	if err := prometheus.Register(requestsCounter); err != nil {
+	if err := n.RegisterMetric(registerer, requestsCounter); err != nil {
 		return errors.Wrap(err, "Failed to register metric")
 	}
 
 	n.Logger.InfoWith("Metric registered successfully", "metricName", string(n.MetricName))
 	n.metric = requestsCounter
 
+	// requests matching the ignore rules are counted separately, so they don't count as activity
+	ignoredRequestsCounter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: n.MetricNamespace,
+		Subsystem: n.MetricSubsystem,
+		Name:      string(metricshandler.NumOfIgnoredRequestsMetricName),
+		Help:      "Total number of requests forwarded that matched an ignore rule.",
+	}, n.MetricLabels.Names("rule"))
+
+	if err := n.RegisterMetric(registerer, ignoredRequestsCounter); err != nil {
+		return errors.Wrap(err, "Failed to register ignored requests metric")
+	}
+
+	n.Logger.InfoWith("Metric registered successfully",
+		"metricName", string(metricshandler.NumOfIgnoredRequestsMetricName),
+		"numOfRules", len(n.IgnoreRules))
+	n.ignoredMetric = ignoredRequestsCounter
+
+	// responses are labeled by gRPC method and status for gRPC requests, and by HTTP method and status otherwise
+	responsesCounter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: n.MetricNamespace,
+		Subsystem: n.MetricSubsystem,
+		Name:      string(metricshandler.NumOfResponsesMetricName),
+		Help:      "Total number of responses forwarded, by protocol, method and status code.",
+	}, n.MetricLabels.Names("protocol", "method", "code"))
+
+	if err := n.RegisterMetric(registerer, responsesCounter); err != nil {
+		return errors.Wrap(err, "Failed to register responses metric")
+	}
+
+	n.Logger.InfoWith("Metric registered successfully",
+		"metricName", string(metricshandler.NumOfResponsesMetricName))
+	n.responsesMetric = responsesCounter
+
 	return nil
 }
 
 func (n *metricsHandler) Start() error {
-	http.HandleFunc("/", n.onRequest)
-	if err := n.createProxy(); err != nil {
+	proxy, err := n.createProxy(n.GetForwardAddress())
+	if err != nil {
 		return errors.Wrap(err, "Failed to initiate proxy")
 	}
-
-	go n.monitorSSHConnection()
+	n.proxy.Store(proxy)
+	n.ServeMux.HandleFunc("/", n.onRequest)
 
 	// adds one data point on service initialization so metric will be initialized and queryable
 	n.incrementMetric()
+	n.MarkStarted()
 	return nil
 }
 
-func (n *metricsHandler) createProxy() error {
-	httpTargetURL, err := url.Parse("http://" + n.ForwardAddress)
+// Stop always fails - this handler is the proxy itself, so it must run as long as the server does
+func (n *metricsHandler) Stop() error {
+	return errors.Errorf("Metrics handler %s can't be stopped", n.MetricName)
+}
+
+// SetForwardAddress replaces the proxy, requests already being forwarded complete against the previous address
+func (n *metricsHandler) SetForwardAddress(forwardAddress string) error {
+	if n.proxy.Load() != nil {
+		proxy, err := n.createProxy(forwardAddress)
+		if err != nil {
+			return errors.Wrap(err, "Failed to create proxy")
+		}
+		n.proxy.Store(proxy)
+	}
+	return n.MetricsHandler.SetForwardAddress(forwardAddress)
+}
+
+func (n *metricsHandler) createProxy(forwardAddress string) (*httputil.ReverseProxy, error) {
+	httpTargetURL, err := url.Parse("http://" + forwardAddress)
 	if err != nil {
-		return errors.Wrap(err, "Failed to parse http forward address")
+		return nil, errors.Wrap(err, "Failed to parse http forward address")
+	}
+	proxy := httputil.NewSingleHostReverseProxy(httpTargetURL)
+	proxy.Transport = tracing.NewTransport(newUpstreamTransport(n.UpstreamH2C))
+
+	// header rules are applied to the request once it's directed at the upstream, so they see (and may override)
+	// everything else set on it
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		if err := headerrule.Apply(n.HeaderRules, headerrule.RequestPhase, req, req.Header); err != nil {
+			n.Logger.WarnWithCtx(req.Context(), "Failed to apply request header rules", "err", err.Error())
+		}
+	}
+
+	// return the request ID to the client. set (rather than added to the response writer before proxying) so
+	// that it replaces any request ID the upstream might echo back
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		if requestID := requestid.FromContext(resp.Request.Context()); requestID != "" {
+			resp.Header.Set(requestid.HeaderName, requestID)
+		}
+		if err := headerrule.Apply(n.HeaderRules, headerrule.ResponsePhase, resp.Request, resp.Header); err != nil {
+			n.Logger.WarnWithCtx(resp.Request.Context(), "Failed to apply response header rules", "err", err.Error())
+		}
+
+		// error responses the upstream didn't describe (e.g. from a server that's shutting down) get an error page
+		if n.ErrorPages != nil && resp.ContentLength == 0 && n.ErrorPages.Handles(resp.StatusCode) {
+			n.ErrorPages.Replace(resp)
+		}
+		return nil
 	}
-	n.proxy = httputil.NewSingleHostReverseProxy(httpTargetURL)
 
 	// override the proxy's error handler in order to make the "context canceled" log appear once every hour at most,
 	// because it occurs frequently and spams the logs file, but we didn't want to remove it entirely.
-	n.proxy.ErrorHandler = func(rw http.ResponseWriter, req *http.Request, err error) {
+	proxy.ErrorHandler = func(rw http.ResponseWriter, req *http.Request, err error) {
 		if err == nil {
 			return
 		}
@@ -114,76 +196,100 @@ func (n *metricsHandler) createProxy() error {
 		if !strings.Contains(err.Error(), "context canceled") || timeSinceLastCtxErr {
 			n.Logger.DebugWithCtx(req.Context(), "http: proxy error", "error", err)
 		}
-		rw.WriteHeader(http.StatusBadGateway)
+		if !strings.Contains(err.Error(), "context canceled") {
+			n.MarkFailed(err)
+		}
+		if requestID := requestid.FromContext(req.Context()); requestID != "" {
+			rw.Header().Set(requestid.HeaderName, requestID)
+		}
+		statusCode := upstreamErrorStatusCode(err)
+		if n.ErrorPages != nil {
+			n.ErrorPages.Write(rw, req, statusCode)
+			return
+		}
+		rw.WriteHeader(statusCode)
 	}
 
-	return nil
+	return proxy, nil
+}
+
+// upstreamErrorStatusCode returns 504 if the upstream timed out, and 502 if it failed otherwise
+func upstreamErrorStatusCode(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	if timeoutErr, ok := err.(interface{ Timeout() bool }); ok && timeoutErr.Timeout() {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
 }
 
 func (n *metricsHandler) incrementMetric() {
-	n.metric.With(prometheus.Labels{
-		"namespace":     n.Namespace,
-		"service_name":  n.ServiceName,
-		"instance_name": n.InstanceName,
-	}).Inc()
+	n.metric.With(n.MetricLabels.Labels(nil)).Inc()
+	n.MarkUpdated()
+}
+
+func (n *metricsHandler) incrementIgnoredMetric(ruleName string) {
+	n.ignoredMetric.With(n.MetricLabels.Labels(prometheus.Labels{"rule": ruleName})).Inc()
+}
+
+func (n *metricsHandler) incrementResponsesMetric(req *http.Request, responseHeader http.Header, statusCode int) {
+	labels := prometheus.Labels{
+		"protocol": httpProtocol,
+		"method":   httpMethodLabel(req),
+		"code":     strconv.Itoa(statusCode),
+	}
+	if isGRPCRequest(req) {
+		labels = prometheus.Labels{
+			"protocol": grpcProtocol,
+			"method":   grpcMethodLabel(req),
+			"code":     grpcCodeName(responseHeader, statusCode),
+		}
+	}
+	n.responsesMetric.With(n.MetricLabels.Labels(labels)).Inc()
 }
 
 func (n *metricsHandler) onRequest(res http.ResponseWriter, req *http.Request) {
-	n.Logger.DebugWith("Received new request, handling",
-		"from", req.RemoteAddr,
+
+	// correlate the client's request, our logs and the upstream's logs
+	requestID := requestid.Ensure(req)
+	req = req.WithContext(requestid.WithContext(req.Context(), requestID))
+
+	req, span := tracing.StartServerSpan(req, "proxy "+req.Method)
+	span.SetAttributes(attribute.String("request.id", requestID))
+	defer span.End()
+
+	n.Logger.DebugWithCtx(req.Context(), "Received new request, handling",
+		"from", forwarded.ClientIP(req),
 		"uri", req.RequestURI,
 		"method", req.Method)
 
 	// update counter metric
-	n.incrementMetric()
+	if ruleName, ignored := activityfilter.Match(n.IgnoreRules, req); ignored {
+		n.Logger.DebugWithCtx(req.Context(), "Request matched ignore rule, not counting as activity", "rule", ruleName)
+		n.incrementIgnoredMetric(ruleName)
+	} else {
+		n.incrementMetric()
+		if n.RequestTracker != nil {
+			n.RequestTracker.Track()
+		}
+	}
 
-	if err := n.forwardRequest(res, req); err != nil {
-		res.WriteHeader(http.StatusInternalServerError)
+	recorder := &responseRecorder{ResponseWriter: res}
+	err := n.forwardRequest(recorder, req)
+	if err != nil {
+		res.Header().Set(requestid.HeaderName, requestID)
+		recorder.WriteHeader(http.StatusInternalServerError)
+	}
+	n.incrementResponsesMetric(req, res.Header(), recorder.StatusCode())
+	if err != nil {
 		return
 	}
 
-	n.Logger.Debug("Forwarded request")
+	n.Logger.DebugCtx(req.Context(), "Forwarded request")
 }
 
 func (n *metricsHandler) forwardRequest(res http.ResponseWriter, req *http.Request) error {
-	n.proxy.ServeHTTP(res, req)
+	n.proxy.Load().(*httputil.ReverseProxy).ServeHTTP(res, req)
 	return nil
 }
-
-// monitorSSHConnection runs in a goroutine and checks if the ssh connection is still alive, by reading a file shared
-// between the sidecar and main container.
-func (n *metricsHandler) monitorSSHConnection() {
-	filePath := metricshandler.OpenSSHConnectionFilePath
-
-	n.Logger.Info("Starting SSH connection monitor", "filePath", filePath)
-
-	// create a ticker that will check the file every 10 seconds
-	ticker := time.NewTicker(10 * time.Second)
-	for range ticker.C {
-
-		// if the file doesn't exist, do nothing
-		if exists, err := common.FileExists(filePath); !exists {
-			if err != nil {
-				n.Logger.WarnWith("Failed to check if file exists", "err", err)
-			}
-			continue
-		}
-
-		// file exists, read it
-		contentBytes, err := os.ReadFile(filePath)
-		if err != nil {
-			n.Logger.WarnWith("Failed to read file", "err", err)
-			continue
-		}
-
-		// convert content to a 'string'
-		content := strings.TrimSpace(string(contentBytes))
-
-		// if it contains "1", the connection is alive - increment the metric
-		// otherwise, do nothing
-		if content == metricshandler.SSHConnectionIsAlive {
-			n.Logger.Debug("SSH connection is alive, incrementing metric")
-			n.incrementMetric()
-		}
-	}
-}
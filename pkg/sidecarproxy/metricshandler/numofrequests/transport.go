@@ -0,0 +1,54 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package numofrequests
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"golang.org/x/net/http2"
+)
+
+// upstreamTransport forwards gRPC requests (and all requests, if the upstream is configured to speak h2c) over
+// HTTP/2 without TLS, which gRPC requires, and other requests over HTTP/1
+type upstreamTransport struct {
+	http1Transport http.RoundTripper
+	h2cTransport   http.RoundTripper
+	upstreamH2C    bool
+}
+
+func newUpstreamTransport(upstreamH2C bool) *upstreamTransport {
+	return &upstreamTransport{
+		http1Transport: http.DefaultTransport,
+		h2cTransport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network string, address string, _ *tls.Config) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, address)
+			},
+		},
+		upstreamH2C: upstreamH2C,
+	}
+}
+
+func (t *upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.upstreamH2C || isGRPCRequest(req) {
+		return t.h2cTransport.RoundTrip(req)
+	}
+	return t.http1Transport.RoundTrip(req)
+}
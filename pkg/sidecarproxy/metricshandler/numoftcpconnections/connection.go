@@ -0,0 +1,54 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package numoftcpconnections
+
+import (
+	"io"
+	"net"
+
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// countingWriter counts the bytes written through it, and records each write as activity
+type countingWriter struct {
+	writer          io.Writer
+	counter         prometheus.Counter
+	activityTracker *metricshandler.ActivityTracker
+}
+
+func (w *countingWriter) Write(data []byte) (int, error) {
+	written, err := w.writer.Write(data)
+	w.counter.Add(float64(written))
+	if w.activityTracker != nil {
+		w.activityTracker.Track()
+	}
+	return written, err
+}
+
+// pipe copies the source to the destination until the source is done, then closes the destination for writing so
+// the other side sees the end of the stream while the opposite direction keeps flowing
+func pipe(destination net.Conn, source net.Conn, destinationWriter io.Writer) error {
+	_, err := io.Copy(destinationWriter, source)
+
+	if tcpConn, ok := destination.(*net.TCPConn); ok {
+		tcpConn.CloseWrite() // nolint: errcheck
+	} else {
+		destination.Close() // nolint: errcheck
+	}
+	return err
+}
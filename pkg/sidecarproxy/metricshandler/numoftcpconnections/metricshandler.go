@@ -0,0 +1,280 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package numoftcpconnections
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler/abstract"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/tcproute"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const dialTimeout = 10 * time.Second
+
+type metricsHandler struct {
+	*abstract.MetricsHandler
+	metric                  *prometheus.CounterVec
+	activeConnectionsMetric *prometheus.GaugeVec
+	receivedBytesMetric     *prometheus.CounterVec
+	sentBytesMetric         *prometheus.CounterVec
+
+	// listeners and the connections accepted on them, closed when the handler stops
+	connectionsLock  sync.Mutex
+	listeners        []net.Listener
+	connections      map[net.Conn]struct{}
+	connectionsGroup sync.WaitGroup
+}
+
+func NewMetricsHandler(logger logger.Logger,
+	configuration metricshandler.Configuration) (metricshandler.MetricsHandler, error) {
+
+	handler := metricsHandler{}
+	abstractMetricsHandler, err := abstract.NewMetricsHandler(
+		logger.GetChild(string(metricshandler.NumOfTCPConnectionsMetricName)),
+		configuration,
+		metricshandler.NumOfTCPConnectionsMetricName)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create abstract metric handler")
+	}
+
+	handler.MetricsHandler = abstractMetricsHandler
+
+	return &handler, nil
+}
+
+func (n *metricsHandler) RegisterMetrics(registerer prometheus.Registerer) error {
+	connectionsCounter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: n.MetricNamespace,
+		Subsystem: n.MetricSubsystem,
+		Name:      string(n.MetricName),
+		Help:      "Total number of TCP connections forwarded, by route.",
+	}, n.MetricLabels.Names("route"))
+
+	if err := n.RegisterMetric(registerer, connectionsCounter); err != nil {
+		return errors.Wrapf(err, "Failed to register metric: %s", string(n.MetricName))
+	}
+
+	n.Logger.InfoWith("Metric registered successfully", "metricName", string(n.MetricName))
+	n.metric = connectionsCounter
+
+	activeConnectionsGauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: n.MetricNamespace,
+		Subsystem: n.MetricSubsystem,
+		Name:      string(metricshandler.TCPActiveConnectionsMetricName),
+		Help:      "Number of open TCP connections, by route.",
+	}, n.MetricLabels.Names("route"))
+
+	if err := n.RegisterMetric(registerer, activeConnectionsGauge); err != nil {
+		return errors.Wrapf(err, "Failed to register metric: %s",
+			string(metricshandler.TCPActiveConnectionsMetricName))
+	}
+
+	n.Logger.InfoWith("Metric registered successfully",
+		"metricName", string(metricshandler.TCPActiveConnectionsMetricName))
+	n.activeConnectionsMetric = activeConnectionsGauge
+
+	// received from clients and forwarded to the upstream, and the other way around
+	receivedBytesCounter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: n.MetricNamespace,
+		Subsystem: n.MetricSubsystem,
+		Name:      string(metricshandler.TCPReceivedBytesMetricName),
+		Help:      "Total number of bytes received from clients, by route.",
+	}, n.MetricLabels.Names("route"))
+
+	if err := n.RegisterMetric(registerer, receivedBytesCounter); err != nil {
+		return errors.Wrapf(err, "Failed to register metric: %s", string(metricshandler.TCPReceivedBytesMetricName))
+	}
+
+	n.Logger.InfoWith("Metric registered successfully",
+		"metricName", string(metricshandler.TCPReceivedBytesMetricName))
+	n.receivedBytesMetric = receivedBytesCounter
+
+	sentBytesCounter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: n.MetricNamespace,
+		Subsystem: n.MetricSubsystem,
+		Name:      string(metricshandler.TCPSentBytesMetricName),
+		Help:      "Total number of bytes sent to clients, by route.",
+	}, n.MetricLabels.Names("route"))
+
+	if err := n.RegisterMetric(registerer, sentBytesCounter); err != nil {
+		return errors.Wrapf(err, "Failed to register metric: %s", string(metricshandler.TCPSentBytesMetricName))
+	}
+
+	n.Logger.InfoWith("Metric registered successfully",
+		"metricName", string(metricshandler.TCPSentBytesMetricName))
+	n.sentBytesMetric = sentBytesCounter
+
+	return nil
+}
+
+func (n *metricsHandler) Start() error {
+	if len(n.TCPRoutes) == 0 {
+		return errors.New("No TCP routes are configured")
+	}
+
+	n.connectionsLock.Lock()
+	defer n.connectionsLock.Unlock()
+
+	n.connections = map[net.Conn]struct{}{}
+	for _, route := range n.TCPRoutes {
+		listener, err := net.Listen("tcp", route.ListenAddress)
+		if err != nil {
+			n.closeListenersLocked()
+			return errors.Wrapf(err, "Failed to listen on %s for route %s", route.ListenAddress, route.Name)
+		}
+		n.listeners = append(n.listeners, listener)
+
+		// adds the route's data points so they're initialized and queryable
+		labels := n.routeLabels(route)
+		n.metric.With(labels).Add(0)
+		n.activeConnectionsMetric.With(labels).Set(0)
+		n.receivedBytesMetric.With(labels).Add(0)
+		n.sentBytesMetric.With(labels).Add(0)
+
+		n.Logger.InfoWith("Forwarding TCP connections",
+			"route", route.Name,
+			"listenAddress", route.ListenAddress,
+			"forwardAddress", route.ForwardAddress)
+		go n.acceptConnections(route, listener)
+	}
+
+	n.MarkStarted()
+	return nil
+}
+
+// Stop closes the listeners and the open connections
+func (n *metricsHandler) Stop() error {
+	n.connectionsLock.Lock()
+	n.closeListenersLocked()
+	for connection := range n.connections {
+		connection.Close() // nolint: errcheck
+	}
+	n.connectionsLock.Unlock()
+
+	n.connectionsGroup.Wait()
+	n.MarkStopped()
+	return nil
+}
+
+// closeListenersLocked must be called with connectionsLock held
+func (n *metricsHandler) closeListenersLocked() {
+	for _, listener := range n.listeners {
+		listener.Close() // nolint: errcheck
+	}
+	n.listeners = nil
+}
+
+func (n *metricsHandler) acceptConnections(route tcproute.Route, listener net.Listener) {
+	for {
+		clientConnection, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			n.Logger.WarnWith("Failed to accept TCP connection", "route", route.Name, "err", err.Error())
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		if !n.trackConnection(clientConnection) {
+			clientConnection.Close() // nolint: errcheck
+			return
+		}
+		go n.forwardConnection(route, clientConnection)
+	}
+}
+
+// trackConnection keeps the connection so it's closed when the handler stops, returning false if it's stopping
+func (n *metricsHandler) trackConnection(connection net.Conn) bool {
+	n.connectionsLock.Lock()
+	defer n.connectionsLock.Unlock()
+
+	if n.listeners == nil {
+		return false
+	}
+	n.connections[connection] = struct{}{}
+	n.connectionsGroup.Add(1)
+	return true
+}
+
+func (n *metricsHandler) untrackConnection(connection net.Conn) {
+	n.connectionsLock.Lock()
+	defer n.connectionsLock.Unlock()
+
+	delete(n.connections, connection)
+	n.connectionsGroup.Done()
+}
+
+func (n *metricsHandler) forwardConnection(route tcproute.Route, clientConnection net.Conn) {
+	defer n.untrackConnection(clientConnection)
+	defer clientConnection.Close() // nolint: errcheck
+
+	labels := n.routeLabels(route)
+	n.metric.With(labels).Inc()
+	n.activeConnectionsMetric.With(labels).Inc()
+	defer n.activeConnectionsMetric.With(labels).Dec()
+	if n.ConnectionTracker != nil {
+		n.ConnectionTracker.Track()
+	}
+
+	n.Logger.DebugWith("Accepted TCP connection, forwarding",
+		"route", route.Name,
+		"from", clientConnection.RemoteAddr().String())
+
+	upstreamConnection, err := net.DialTimeout("tcp", route.ForwardAddress, dialTimeout)
+	if err != nil {
+		n.Logger.WarnWith("Failed to connect to upstream",
+			"route", route.Name,
+			"forwardAddress", route.ForwardAddress,
+			"err", err.Error())
+		n.MarkFailed(err)
+		return
+	}
+	defer upstreamConnection.Close() // nolint: errcheck
+	n.MarkUpdated()
+
+	upstreamErrChan := make(chan error, 1)
+	go func() {
+		upstreamErrChan <- pipe(upstreamConnection, clientConnection, &countingWriter{
+			writer:          upstreamConnection,
+			counter:         n.receivedBytesMetric.With(labels),
+			activityTracker: n.ConnectionTracker,
+		})
+	}()
+	clientErr := pipe(clientConnection, upstreamConnection, &countingWriter{
+		writer:          clientConnection,
+		counter:         n.sentBytesMetric.With(labels),
+		activityTracker: n.ConnectionTracker,
+	})
+	upstreamErr := <-upstreamErrChan
+
+	n.Logger.DebugWith("TCP connection closed",
+		"route", route.Name,
+		"from", clientConnection.RemoteAddr().String(),
+		"clientErr", clientErr,
+		"upstreamErr", upstreamErr)
+}
+
+func (n *metricsHandler) routeLabels(route tcproute.Route) prometheus.Labels {
+	return n.MetricLabels.Labels(prometheus.Labels{"route": route.Name})
+}
@@ -0,0 +1,111 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package numoftcpconnections
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metriclabels"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/tcproute"
+
+	"github.com/nuclio/loggerus"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestForwardedConnectionIsntUIActivity(t *testing.T) {
+	upstreamListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer upstreamListener.Close() // nolint: errcheck
+	go func() {
+		for {
+			connection, err := upstreamListener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer connection.Close()        // nolint: errcheck
+				io.Copy(connection, connection) // nolint: errcheck
+			}()
+		}
+	}()
+
+	loggerInstance, err := loggerus.NewLoggerusForTests("test")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	metricLabels, err := metriclabels.NewLabelSet(metriclabels.Configuration{}, "namespace", "service", "instance")
+	if err != nil {
+		t.Fatalf("Failed to create metric labels: %v", err)
+	}
+	route := tcproute.Route{
+		Name:           "echo",
+		ListenAddress:  getFreeAddress(t),
+		ForwardAddress: upstreamListener.Addr().String(),
+	}
+	configuration := metricshandler.Configuration{
+		MetricLabels:      metricLabels,
+		TCPRoutes:         []tcproute.Route{route},
+		RequestTracker:    metricshandler.NewActivityTracker(),
+		ConnectionTracker: metricshandler.NewActivityTracker(),
+	}
+
+	metricsHandler, err := NewMetricsHandler(loggerInstance, configuration)
+	if err != nil {
+		t.Fatalf("Failed to create metrics handler: %v", err)
+	}
+	if err := metricsHandler.RegisterMetrics(prometheus.NewRegistry()); err != nil {
+		t.Fatalf("Failed to register metrics: %v", err)
+	}
+	if err := metricsHandler.Start(); err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	defer metricsHandler.Stop() // nolint: errcheck
+
+	connection, err := net.Dial("tcp", route.ListenAddress)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer connection.Close() // nolint: errcheck
+	if _, err := connection.Write([]byte("ping")); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	response := make([]byte, 4)
+	if _, err := io.ReadFull(connection, response); err != nil || string(response) != "ping" {
+		t.Fatalf("Expected the upstream to echo ping, got %q (%v)", response, err)
+	}
+
+	if !configuration.ConnectionTracker.ActiveWithin(metricshandler.ConnectionActivityWindow) {
+		t.Fatalf("Forwarded connection wasn't tracked as connection activity")
+	}
+	if configuration.RequestTracker.ActiveWithin(metricshandler.UIInUseWindow) {
+		t.Fatalf("Forwarded connection was tracked as UI use")
+	}
+}
+
+// getFreeAddress returns a local address nothing listens on
+func getFreeAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close() // nolint: errcheck
+	return listener.Addr().String()
+}
@@ -0,0 +1,232 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package rayclusterbusyness
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler/abstract"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/tracing"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+type metricsHandler struct {
+	*abstract.MetricsHandler
+	metric      *prometheus.GaugeVec
+	tasksMetric *prometheus.GaugeVec
+	jobsMetric  *prometheus.GaugeVec
+	nodesMetric *prometheus.GaugeVec
+}
+
+func NewMetricsHandler(logger logger.Logger,
+	configuration metricshandler.Configuration) (metricshandler.MetricsHandler, error) {
+
+	if configuration.RayDashboardAddress == "" {
+		configuration.RayDashboardAddress = metricshandler.DefaultRayDashboardAddress
+	}
+
+	rayClusterBusynessMetricsHandler := metricsHandler{}
+	abstractMetricsHandler, err := abstract.NewMetricsHandler(
+		logger.GetChild(string(metricshandler.RayClusterBusynessMetricName)),
+		configuration,
+		metricshandler.RayClusterBusynessMetricName)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create abstract metric handler")
+	}
+
+	rayClusterBusynessMetricsHandler.MetricsHandler = abstractMetricsHandler
+	rayClusterBusynessMetricsHandler.ConfigurePolling(10*time.Second, rayClusterBusynessMetricsHandler.updateMetric)
+
+	return &rayClusterBusynessMetricsHandler, nil
+}
+
+func (n *metricsHandler) RegisterMetrics(registerer prometheus.Registerer) error {
+	var err error
+	if n.metric, err = n.RegisterGauge(registerer,
+		n.MetricName,
+		"Ray cluster busyness, 1 while the cluster has running or pending tasks or jobs"); err != nil {
+		return err
+	}
+	if n.tasksMetric, err = n.RegisterGauge(registerer,
+		metricshandler.RayTasksMetricName,
+		"Number of Ray tasks, by state (running, pending)",
+		"state"); err != nil {
+		return err
+	}
+	if n.jobsMetric, err = n.RegisterGauge(registerer,
+		metricshandler.RayJobsMetricName,
+		"Number of Ray jobs, by state (running, pending)",
+		"state"); err != nil {
+		return err
+	}
+	if n.nodesMetric, err = n.RegisterGauge(registerer,
+		metricshandler.RayNodesMetricName,
+		"Number of alive Ray nodes"); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (n *metricsHandler) Start() error {
+	n.Logger.InfoWith("Starting Ray cluster busyness metrics handler", "dashboardAddress", n.RayDashboardAddress)
+	if err := n.StartPolling(); err != nil {
+		return errors.Wrap(err, "Failed to start polling")
+	}
+	n.MarkStarted()
+	return nil
+}
+
+func (n *metricsHandler) updateMetric() error {
+	ctx, span := tracing.Tracer().Start(context.Background(), "ray poll cluster")
+	defer span.End()
+
+	taskCounts, err := n.countTasks(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return errors.Wrap(err, "Failed to count tasks")
+	}
+
+	// jobs are busy from submission, before (and between) their driver's tasks
+	jobCounts, err := n.countJobs(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return errors.Wrap(err, "Failed to count jobs")
+	}
+
+	aliveNodes, err := n.countAliveNodes(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return errors.Wrap(err, "Failed to count nodes")
+	}
+
+	span.SetAttributes(attribute.Int("ray.tasks.running", taskCounts[RunningTaskState]),
+		attribute.Int("ray.tasks.pending", taskCounts[PendingTaskState]),
+		attribute.Int("ray.jobs.running", jobCounts[RunningTaskState]),
+		attribute.Int("ray.jobs.pending", jobCounts[PendingTaskState]),
+		attribute.Int("ray.nodes", aliveNodes))
+	n.setMetrics(taskCounts, jobCounts, aliveNodes)
+
+	return nil
+}
+
+// countTasks counts the cluster's running and pending tasks, from the state API's task summary
+func (n *metricsHandler) countTasks(ctx context.Context) (map[TaskState]int, error) {
+	var tasksSummary tasksSummaryResponse
+	if err := n.getStateAPI(ctx, tasksSummaryPath, &tasksSummary, &tasksSummary.stateAPIResponse); err != nil {
+		return nil, errors.Wrap(err, "Failed to get tasks summary")
+	}
+
+	taskCounts := map[TaskState]int{}
+	for _, nodeSummary := range tasksSummary.Data.Result.NodeIDToSummary {
+		for _, functionSummary := range nodeSummary.Summary {
+			for rayTaskState, count := range functionSummary.StateCounts {
+				if taskState, ok := parseTaskState(rayTaskState); ok {
+					taskCounts[taskState] += count
+				}
+			}
+		}
+	}
+
+	n.Logger.DebugWith("Successfully counted Ray tasks", "taskCounts", taskCounts)
+	return taskCounts, nil
+}
+
+// countJobs counts the cluster's running and pending jobs, from the jobs API
+func (n *metricsHandler) countJobs(ctx context.Context) (map[TaskState]int, error) {
+	var jobs []jobDetails
+	if err := n.GetJSON(ctx, n.getURL(jobsPath), &jobs); err != nil {
+		return nil, errors.Wrap(err, "Failed to get jobs")
+	}
+
+	jobCounts := map[TaskState]int{}
+	for _, job := range jobs {
+		if jobState, ok := parseJobStatus(job.Status); ok {
+			jobCounts[jobState]++
+		}
+	}
+
+	n.Logger.DebugWith("Successfully counted Ray jobs", "jobCounts", jobCounts)
+	return jobCounts, nil
+}
+
+func (n *metricsHandler) countAliveNodes(ctx context.Context) (int, error) {
+	var nodes nodesResponse
+	if err := n.getStateAPI(ctx, nodesPath, &nodes, &nodes.stateAPIResponse); err != nil {
+		return 0, errors.Wrap(err, "Failed to get nodes")
+	}
+
+	aliveNodes := 0
+	for _, node := range nodes.Data.Result.Result {
+		if node.State == aliveNodeState {
+			aliveNodes++
+		}
+	}
+
+	n.Logger.DebugWith("Successfully counted Ray nodes", "aliveNodes", aliveNodes)
+	return aliveNodes, nil
+}
+
+// getStateAPI gets a state API endpoint, failing if the response's envelope reports a failure
+func (n *metricsHandler) getStateAPI(ctx context.Context,
+	path string,
+	out interface{},
+	envelope *stateAPIResponse) error {
+	if err := n.GetJSON(ctx, n.getURL(path), out); err != nil {
+		return err
+	}
+	if !envelope.Result {
+		return errors.Errorf("Endpoint %s reported a failure: %s", path, envelope.Msg)
+	}
+	return nil
+}
+
+func (n *metricsHandler) setMetrics(taskCounts map[TaskState]int, jobCounts map[TaskState]int, aliveNodes int) {
+	labels := n.MetricLabels.Labels(nil)
+
+	metricValue := 0
+	for _, taskState := range taskStates {
+		if taskCounts[taskState] > 0 || jobCounts[taskState] > 0 {
+			metricValue = 1
+		}
+	}
+	n.Logger.DebugWith("Setting metric", "metricValue", metricValue, "labels", labels)
+	n.metric.With(labels).Set(float64(metricValue))
+	n.nodesMetric.With(labels).Set(float64(aliveNodes))
+
+	// set all states, so states without tasks are exposed as 0 rather than keeping their previous count
+	for _, taskState := range taskStates {
+		n.tasksMetric.With(n.MetricLabels.Labels(prometheus.Labels{"state": string(taskState)})).
+			Set(float64(taskCounts[taskState]))
+		n.jobsMetric.With(n.MetricLabels.Labels(prometheus.Labels{"state": string(taskState)})).
+			Set(float64(jobCounts[taskState]))
+	}
+}
+
+// getURL returns the URL of a path of the Ray dashboard's
+func (n *metricsHandler) getURL(path string) string {
+	return fmt.Sprintf("http://%s%s", n.RayDashboardAddress, path)
+}
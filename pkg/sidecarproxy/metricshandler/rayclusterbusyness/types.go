@@ -0,0 +1,102 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package rayclusterbusyness
+
+import (
+	"strings"
+)
+
+const (
+	tasksSummaryPath = "/api/v0/tasks/summarize"
+	jobsPath         = "/api/jobs/"
+	nodesPath        = "/api/v0/nodes"
+
+	aliveNodeState = "ALIVE"
+)
+
+// stateAPIResponse is the envelope of Ray's state API responses
+type stateAPIResponse struct {
+	Result bool   `json:"result"`
+	Msg    string `json:"msg"`
+}
+
+type tasksSummaryResponse struct {
+	stateAPIResponse
+	Data struct {
+		Result struct {
+			NodeIDToSummary map[string]struct {
+				Summary map[string]struct {
+					StateCounts map[string]int `json:"state_counts"`
+				} `json:"summary"`
+			} `json:"node_id_to_summary"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// jobDetails is an entry of the jobs API's response, which isn't enveloped like the state API's
+type jobDetails struct {
+	JobID  string `json:"job_id"`
+	Status string `json:"status"`
+}
+
+type nodesResponse struct {
+	stateAPIResponse
+	Data struct {
+		Result struct {
+			Result []struct {
+				NodeID string `json:"node_id"`
+				State  string `json:"state"`
+			} `json:"result"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// TaskState is the state of a Ray task or job, as far as the cluster's busyness is concerned
+type TaskState string
+
+const (
+	RunningTaskState TaskState = "running"
+	PendingTaskState TaskState = "pending"
+)
+
+var taskStates = []TaskState{
+	RunningTaskState,
+	PendingTaskState,
+}
+
+// parseTaskState maps Ray's task states to running and pending, returning false for tasks that are done
+func parseTaskState(rayTaskState string) (TaskState, bool) {
+	switch {
+	case strings.HasPrefix(rayTaskState, "RUNNING"):
+		return RunningTaskState, true
+	case strings.HasPrefix(rayTaskState, "PENDING"), rayTaskState == "SUBMITTED_TO_WORKER":
+		return PendingTaskState, true
+	default:
+		return "", false
+	}
+}
+
+// parseJobStatus maps Ray's job statuses to running and pending, returning false for jobs that are done
+func parseJobStatus(rayJobStatus string) (TaskState, bool) {
+	switch rayJobStatus {
+	case "RUNNING":
+		return RunningTaskState, true
+	case "PENDING":
+		return PendingTaskState, true
+	default:
+		return "", false
+	}
+}
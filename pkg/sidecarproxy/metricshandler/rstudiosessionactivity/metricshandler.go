@@ -0,0 +1,203 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package rstudiosessionactivity
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler/abstract"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/tracing"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+type metricsHandler struct {
+	*abstract.MetricsHandler
+	metric         *prometheus.GaugeVec
+	sessionsMetric *prometheus.GaugeVec
+}
+
+func NewMetricsHandler(logger logger.Logger,
+	configuration metricshandler.Configuration) (metricshandler.MetricsHandler, error) {
+
+	if configuration.RStudioSessionsDirPath == "" {
+		configuration.RStudioSessionsDirPath = metricshandler.DefaultRStudioSessionsDirPath
+	}
+
+	rstudioSessionActivityMetricsHandler := metricsHandler{}
+	abstractMetricsHandler, err := abstract.NewMetricsHandler(
+		logger.GetChild(string(metricshandler.RStudioSessionActivityMetricName)),
+		configuration,
+		metricshandler.RStudioSessionActivityMetricName)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create abstract metric handler")
+	}
+
+	rstudioSessionActivityMetricsHandler.MetricsHandler = abstractMetricsHandler
+	rstudioSessionActivityMetricsHandler.ConfigurePolling(5*time.Second, rstudioSessionActivityMetricsHandler.updateMetric)
+
+	return &rstudioSessionActivityMetricsHandler, nil
+}
+
+func (n *metricsHandler) RegisterMetrics(registerer prometheus.Registerer) error {
+	gaugeVec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: n.MetricNamespace,
+		Subsystem: n.MetricSubsystem,
+		Name:      string(n.MetricName),
+		Help:      "RStudio session activity, 1 while one or more sessions run code",
+	}, n.MetricLabels.Names())
+
+	if err := n.RegisterMetric(registerer, gaugeVec); err != nil {
+		return errors.Wrapf(err, "Failed to register metric: %s", string(n.MetricName))
+	}
+
+	n.Logger.InfoWith("Metric registered successfully", "metricName", string(n.MetricName))
+	n.metric = gaugeVec
+
+	sessionsGaugeVec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: n.MetricNamespace,
+		Subsystem: n.MetricSubsystem,
+		Name:      string(metricshandler.RStudioSessionsMetricName),
+		Help:      "Number of active RStudio sessions, by state (busy, idle, suspended)",
+	}, n.MetricLabels.Names("state"))
+
+	if err := n.RegisterMetric(registerer, sessionsGaugeVec); err != nil {
+		return errors.Wrapf(err, "Failed to register metric: %s", string(metricshandler.RStudioSessionsMetricName))
+	}
+
+	n.Logger.InfoWith("Metric registered successfully",
+		"metricName", string(metricshandler.RStudioSessionsMetricName))
+	n.sessionsMetric = sessionsGaugeVec
+
+	return nil
+}
+
+func (n *metricsHandler) Start() error {
+	n.Logger.InfoWith("Starting RStudio session activity metrics handler",
+		"sessionsDirPath", n.RStudioSessionsDirPath)
+	if err := n.StartPolling(); err != nil {
+		return errors.Wrap(err, "Failed to start polling")
+	}
+	n.MarkStarted()
+	return nil
+}
+
+func (n *metricsHandler) updateMetric() error {
+	_, span := tracing.Tracer().Start(context.Background(), "rstudio read sessions")
+	defer span.End()
+
+	sessionCounts, err := n.countSessions()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return errors.Wrap(err, "Failed to count sessions")
+	}
+
+	span.SetAttributes(attribute.Int("rstudio.sessions.busy", sessionCounts[BusySessionState]),
+		attribute.Int("rstudio.sessions.idle", sessionCounts[IdleSessionState]),
+		attribute.Int("rstudio.sessions.suspended", sessionCounts[SuspendedSessionState]))
+	n.setMetrics(sessionCounts)
+
+	return nil
+}
+
+// countSessions counts the active sessions by state, reading the session directories RStudio keeps in a directory
+// shared with the main container
+func (n *metricsHandler) countSessions() (map[SessionState]int, error) {
+	sessionCounts := map[SessionState]int{}
+
+	sessionDirEntries, err := os.ReadDir(n.RStudioSessionsDirPath)
+	if err != nil {
+
+		// RStudio creates the directory when the first session starts
+		if os.IsNotExist(err) {
+			return sessionCounts, nil
+		}
+		return nil, errors.Wrapf(err, "Failed to read sessions directory: %s", n.RStudioSessionsDirPath)
+	}
+
+	for _, sessionDirEntry := range sessionDirEntries {
+		if !sessionDirEntry.IsDir() || !strings.HasPrefix(sessionDirEntry.Name(), sessionDirPrefix) {
+			continue
+		}
+
+		sessionState, err := n.getSessionState(filepath.Join(n.RStudioSessionsDirPath, sessionDirEntry.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to get session state: %s", sessionDirEntry.Name())
+		}
+		sessionCounts[sessionState]++
+	}
+
+	n.Logger.DebugWith("Successfully counted RStudio sessions", "sessionCounts", sessionCounts)
+	return sessionCounts, nil
+}
+
+func (n *metricsHandler) getSessionState(sessionDirPath string) (SessionState, error) {
+	running, err := n.readSessionProperty(sessionDirPath, runningPropertyName)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to read session property: %s", runningPropertyName)
+	}
+	if !running {
+		return SuspendedSessionState, nil
+	}
+
+	executing, err := n.readSessionProperty(sessionDirPath, executingPropertyName)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to read session property: %s", executingPropertyName)
+	}
+	if executing {
+		return BusySessionState, nil
+	}
+	return IdleSessionState, nil
+}
+
+// readSessionProperty returns true if a boolean session property is set. RStudio doesn't write properties that were
+// never set, so a missing property is unset
+func (n *metricsHandler) readSessionProperty(sessionDirPath string, propertyName string) (bool, error) {
+	contentBytes, err := os.ReadFile(filepath.Join(sessionDirPath, sessionPropertiesDirName, propertyName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "Failed to read file")
+	}
+	return strings.TrimSpace(string(contentBytes)) == propertyIsSet, nil
+}
+
+func (n *metricsHandler) setMetrics(sessionCounts map[SessionState]int) {
+	metricValue := 0
+	if sessionCounts[BusySessionState] > 0 {
+		metricValue = 1
+	}
+	labels := n.MetricLabels.Labels(nil)
+	n.Logger.DebugWith("Setting metric", "metricValue", metricValue, "labels", labels)
+	n.metric.With(labels).Set(float64(metricValue))
+
+	// set all states, so states without sessions are exposed as 0 rather than keeping their previous count
+	for _, sessionState := range sessionStates {
+		n.sessionsMetric.With(n.MetricLabels.Labels(prometheus.Labels{"state": string(sessionState)})).
+			Set(float64(sessionCounts[sessionState]))
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package rstudiosessionactivity
+
+// RStudio keeps a directory per active session (session-<id>), with a properties directory holding a file per
+// session property
+const (
+	sessionDirPrefix         = "session-"
+	sessionPropertiesDirName = "properties"
+	runningPropertyName      = "running"
+	executingPropertyName    = "executing"
+	propertyIsSet            = "1"
+)
+
+type SessionState string
+
+const (
+
+	// the session's R process runs code
+	BusySessionState SessionState = "busy"
+
+	// the session's R process is up, but doesn't run code
+	IdleSessionState SessionState = "idle"
+
+	// the session has no R process, e.g. it was suspended after being idle
+	SuspendedSessionState SessionState = "suspended"
+)
+
+var sessionStates = []SessionState{
+	BusySessionState,
+	IdleSessionState,
+	SuspendedSessionState,
+}
@@ -0,0 +1,129 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sshconnectionactive
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/v3io/sidecar-proxy/pkg/common"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler/abstract"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type metricsHandler struct {
+	*abstract.MetricsHandler
+	metric *prometheus.GaugeVec
+}
+
+func NewMetricsHandler(logger logger.Logger,
+	configuration metricshandler.Configuration) (metricshandler.MetricsHandler, error) {
+
+	// an empty path disables the handler rather than defaulting, as it does for the server
+	if configuration.SSHConnectionFilePath == "" {
+		return nil, errors.New("SSH connection file path must be set")
+	}
+
+	sshConnectionActiveMetricsHandler := metricsHandler{}
+	abstractMetricsHandler, err := abstract.NewMetricsHandler(
+		logger.GetChild(string(metricshandler.SSHConnectionActiveMetricName)),
+		configuration,
+		metricshandler.SSHConnectionActiveMetricName)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create abstract metric handler")
+	}
+
+	sshConnectionActiveMetricsHandler.MetricsHandler = abstractMetricsHandler
+
+	// check the file every 10 seconds
+	sshConnectionActiveMetricsHandler.ConfigurePolling(10*time.Second, sshConnectionActiveMetricsHandler.checkConnection)
+
+	return &sshConnectionActiveMetricsHandler, nil
+}
+
+func (n *metricsHandler) RegisterMetrics(registerer prometheus.Registerer) error {
+	gaugeVec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: n.MetricNamespace,
+		Subsystem: n.MetricSubsystem,
+		Name:      string(n.MetricName),
+		Help:      "SSH connection activity, 1 while an SSH connection to the service is open",
+	}, n.MetricLabels.Names())
+
+	if err := n.RegisterMetric(registerer, gaugeVec); err != nil {
+		return errors.Wrapf(err, "Failed to register metric: %s", string(n.MetricName))
+	}
+
+	n.Logger.InfoWith("Metric registered successfully", "metricName", string(n.MetricName))
+	n.metric = gaugeVec
+
+	return nil
+}
+
+func (n *metricsHandler) Start() error {
+	n.Logger.InfoWith("Starting SSH connection monitor", "filePath", n.SSHConnectionFilePath)
+
+	// check once right away so the metric is initialized and queryable
+	n.Poll()
+
+	if err := n.StartPolling(); err != nil {
+		return errors.Wrap(err, "Failed to start polling")
+	}
+	n.MarkStarted()
+	return nil
+}
+
+// checkConnection checks if the ssh connection is alive, by reading a file shared between the sidecar and main
+// container
+func (n *metricsHandler) checkConnection() error {
+
+	// if the file doesn't exist, there's no connection
+	if exists, err := common.FileExists(n.SSHConnectionFilePath); !exists {
+		n.setMetric(0)
+		if err != nil {
+			return errors.Wrap(err, "Failed to check if file exists")
+		}
+		return nil
+	}
+
+	// file exists, read it
+	contentBytes, err := os.ReadFile(n.SSHConnectionFilePath)
+	if err != nil {
+		return errors.Wrap(err, "Failed to read file")
+	}
+
+	// if it contains "1", the connection is alive, which counts as activity of the service (though not as use of
+	// its UI, as a forwarded request does)
+	if strings.TrimSpace(string(contentBytes)) == metricshandler.SSHConnectionIsAlive {
+		n.setMetric(1)
+		if n.ConnectionTracker != nil {
+			n.ConnectionTracker.Track()
+		}
+	} else {
+		n.setMetric(0)
+	}
+	return nil
+}
+
+func (n *metricsHandler) setMetric(metricValue int) {
+	labels := n.MetricLabels.Labels(nil)
+	n.Logger.DebugWith("Setting metric", "metricValue", metricValue, "labels", labels)
+	n.metric.With(labels).Set(float64(metricValue))
+}
@@ -0,0 +1,70 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sshconnectionactive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metriclabels"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
+
+	"github.com/nuclio/loggerus"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestOpenConnectionIsntUIActivity(t *testing.T) {
+	loggerInstance, err := loggerus.NewLoggerusForTests("test")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	metricLabels, err := metriclabels.NewLabelSet(metriclabels.Configuration{}, "namespace", "service", "instance")
+	if err != nil {
+		t.Fatalf("Failed to create metric labels: %v", err)
+	}
+
+	configuration := metricshandler.Configuration{
+		MetricLabels:      metricLabels,
+		RequestTracker:    metricshandler.NewActivityTracker(),
+		ConnectionTracker: metricshandler.NewActivityTracker(),
+	}
+	if _, err := NewMetricsHandler(loggerInstance, configuration); err == nil {
+		t.Fatalf("Expected creating a handler without an SSH connection file path to fail")
+	}
+
+	configuration.SSHConnectionFilePath = filepath.Join(t.TempDir(), "opensshconnection")
+	if err := os.WriteFile(configuration.SSHConnectionFilePath, []byte("1\n"), 0600); err != nil {
+		t.Fatalf("Failed to write SSH connection file: %v", err)
+	}
+	metricsHandler, err := NewMetricsHandler(loggerInstance, configuration)
+	if err != nil {
+		t.Fatalf("Failed to create metrics handler: %v", err)
+	}
+	if err := metricsHandler.RegisterMetrics(prometheus.NewRegistry()); err != nil {
+		t.Fatalf("Failed to register metrics: %v", err)
+	}
+	if err := metricsHandler.Probe(); err != nil {
+		t.Fatalf("Failed to check connection: %v", err)
+	}
+
+	if !configuration.ConnectionTracker.ActiveWithin(metricshandler.ConnectionActivityWindow) {
+		t.Fatalf("Open connection wasn't tracked as connection activity")
+	}
+	if configuration.RequestTracker.ActiveWithin(metricshandler.UIInUseWindow) {
+		t.Fatalf("Open connection was tracked as UI use")
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tensorboardactivity
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler/abstract"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/tracing"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+type metricsHandler struct {
+	*abstract.MetricsHandler
+	runActivityMetrics abstract.RunActivityMetrics
+}
+
+func NewMetricsHandler(logger logger.Logger,
+	configuration metricshandler.Configuration) (metricshandler.MetricsHandler, error) {
+
+	tensorBoardActivityMetricsHandler := metricsHandler{}
+	abstractMetricsHandler, err := abstract.NewMetricsHandler(
+		logger.GetChild(string(metricshandler.TensorBoardActivityMetricName)),
+		configuration,
+		metricshandler.TensorBoardActivityMetricName)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create abstract metric handler")
+	}
+
+	tensorBoardActivityMetricsHandler.MetricsHandler = abstractMetricsHandler
+	tensorBoardActivityMetricsHandler.ConfigurePolling(30*time.Second, tensorBoardActivityMetricsHandler.updateMetric)
+
+	return &tensorBoardActivityMetricsHandler, nil
+}
+
+func (n *metricsHandler) RegisterMetrics(registerer prometheus.Registerer) error {
+	var err error
+	if n.runActivityMetrics.Metric, err = n.RegisterGauge(registerer,
+		n.MetricName,
+		"TensorBoard activity, 1 while a run is active or the UI is in use"); err != nil {
+		return err
+	}
+	if n.runActivityMetrics.ActiveRunsMetric, err = n.RegisterGauge(registerer,
+		metricshandler.TensorBoardActiveRunsMetricName,
+		"Number of TensorBoard runs that wrote scalars in the last 5 minutes"); err != nil {
+		return err
+	}
+	if n.runActivityMetrics.UIInUseMetric, err = n.RegisterGauge(registerer,
+		metricshandler.TensorBoardUIInUseMetricName,
+		"TensorBoard UI usage, 1 while requests were forwarded to TensorBoard in the last 5 minutes"); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (n *metricsHandler) Start() error {
+	n.Logger.Info("Starting TensorBoard activity metrics handler")
+	if err := n.StartPolling(); err != nil {
+		return errors.Wrap(err, "Failed to start polling")
+	}
+	n.MarkStarted()
+	return nil
+}
+
+func (n *metricsHandler) updateMetric() error {
+	ctx, span := tracing.Tracer().Start(context.Background(), "tensorboard poll runs")
+	defer span.End()
+
+	activeRuns, err := n.countActiveRuns(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return errors.Wrap(err, "Failed to count active runs")
+	}
+
+	uiInUse := n.RequestTracker != nil && n.RequestTracker.ActiveWithin(metricshandler.UIInUseWindow)
+	span.SetAttributes(attribute.Int("tensorboard.active_runs", activeRuns),
+		attribute.Bool("tensorboard.ui_in_use", uiInUse))
+	n.SetRunActivityMetrics(&n.runActivityMetrics, activeRuns, uiInUse)
+
+	return nil
+}
+
+// countActiveRuns counts the runs whose last scalar was written within the active run window. runs usually write
+// all of their scalars each step, so only the run's first tag is checked
+func (n *metricsHandler) countActiveRuns(ctx context.Context) (int, error) {
+	var runsScalarTags scalarTags
+	if err := n.GetJSON(ctx, n.getURL("/data/plugin/scalars/tags"), &runsScalarTags); err != nil {
+		return 0, errors.Wrap(err, "Failed to get scalar tags")
+	}
+
+	activeRuns := 0
+	for run, tags := range runsScalarTags {
+		if len(tags) == 0 {
+			continue
+		}
+
+		tagNames := make([]string, 0, len(tags))
+		for tagName := range tags {
+			tagNames = append(tagNames, tagName)
+		}
+		sort.Strings(tagNames)
+
+		var scalarEvents []scalarEvent
+		scalarsPath := "/data/plugin/scalars/scalars?" + url.Values{"run": {run}, "tag": {tagNames[0]}}.Encode()
+		if err := n.GetJSON(ctx, n.getURL(scalarsPath), &scalarEvents); err != nil {
+			return 0, errors.Wrapf(err, "Failed to get scalars of run: %s", run)
+		}
+
+		if len(scalarEvents) > 0 &&
+			time.Since(scalarEvents[len(scalarEvents)-1].wallTime()) < activeRunWindow {
+			activeRuns++
+		}
+	}
+
+	n.Logger.DebugWith("Successfully counted TensorBoard active runs",
+		"runs", len(runsScalarTags),
+		"activeRuns", activeRuns)
+	return activeRuns, nil
+}
+
+// getURL returns the URL of a path of TensorBoard's
+func (n *metricsHandler) getURL(path string) string {
+	return fmt.Sprintf("http://%s%s", n.GetForwardAddress(), path)
+}
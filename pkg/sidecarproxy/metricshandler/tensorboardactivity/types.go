@@ -0,0 +1,34 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tensorboardactivity
+
+import (
+	"time"
+)
+
+// a run is active while it keeps writing scalars
+const activeRunWindow = 5 * time.Minute
+
+// scalarTags is TensorBoard's /data/plugin/scalars/tags response, the scalar tags (and their metadata) of each run
+type scalarTags map[string]map[string]interface{}
+
+// scalarEvent is an item of TensorBoard's /data/plugin/scalars/scalars response - [wall time (seconds), step, value]
+type scalarEvent [3]float64
+
+func (e scalarEvent) wallTime() time.Time {
+	seconds := int64(e[0])
+	return time.Unix(seconds, int64((e[0]-float64(seconds))*float64(time.Second)))
+}
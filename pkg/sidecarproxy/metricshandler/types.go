@@ -15,19 +15,175 @@
 
 package metricshandler
 
+import (
+	"net/http"
+	"time"
+
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/activityfilter"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/errorpage"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/headerrule"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metriclabels"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/tcproute"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
 type MetricsHandler interface {
-	RegisterMetrics() error
+	RegisterMetrics(registerer prometheus.Registerer) error
+	UnregisterMetrics(registerer prometheus.Registerer)
 	Start() error
+	Stop() error
+	Probe() error
+	SetPollInterval(interval time.Duration) error
+	SetForwardAddress(forwardAddress string) error
+
+	// Name, IsRunning and GetPollInterval are cheap, unlike Status which gathers the handler's metrics
+	Name() MetricName
+	IsRunning() bool
+	GetPollInterval() time.Duration
+	Status() Status
+}
+
+// Status describes a metrics handler's state and its metrics' current values
+type Status struct {
+	Name           MetricName     `json:"name"`
+	Running        bool           `json:"running"`
+	PollInterval   string         `json:"pollInterval,omitempty"`
+	StartTime      *time.Time     `json:"startTime,omitempty"`
+	LastUpdateTime *time.Time     `json:"lastUpdateTime,omitempty"`
+	LastError      string         `json:"lastError,omitempty"`
+	LastErrorTime  *time.Time     `json:"lastErrorTime,omitempty"`
+	Metrics        []MetricStatus `json:"metrics"`
+}
+
+type MetricStatus struct {
+	Name    string         `json:"name"`
+	Type    string         `json:"type"`
+	Samples []SampleStatus `json:"samples"`
+}
+
+type SampleStatus struct {
+	Labels map[string]string `json:"labels"`
+	Value  float64           `json:"value"`
+}
+
+// Configuration holds the settings metrics handlers are created with
+type Configuration struct {
+	ForwardAddress string
+	ListenAddress  string
+	Namespace      string
+	ServiceName    string
+	InstanceName   string
+
+	// labels all metrics are labeled with
+	MetricLabels *metriclabels.LabelSet
+
+	// prefix of all metric names (<namespace>_<subsystem>_<name>), both optional
+	MetricNamespace string
+	MetricSubsystem string
+
+	// the server's mux, handlers that serve requests register their routes on it
+	ServeMux *http.ServeMux
+
+	// file shared with the main container, holding "1" while an SSH connection is open
+	SSHConnectionFilePath string
+
+	// file code-server touches on activity. if empty, the heartbeat is read from code-server's /healthz endpoint
+	CodeServerHeartbeatFilePath string
+
+	// RStudio's active sessions directory (~/.local/share/rstudio/sessions/active), shared with the main container
+	RStudioSessionsDirPath string
+
+	// requests matching any of these rules are forwarded but not counted as activity
+	IgnoreRules []activityfilter.Rule
+
+	// change headers of the requests forwarded to the upstream and of its responses
+	HeaderRules []headerrule.Rule
+
+	// rendered instead of bare statuses when the upstream fails, nil if disabled
+	ErrorPages *errorpage.Pages
+
+	// host:port of the Ray and Dask dashboards, which run alongside the upstream rather than being it
+	RayDashboardAddress  string
+	DaskDashboardAddress string
+
+	// URL of the upstream's own metrics (defaults to the forward address' /metrics), and a regex their names must
+	// match to be exposed
+	UpstreamMetricsURL    string
+	UpstreamMetricsFilter string
+
+	// connections accepted on a route's listen address are forwarded to its forward address
+	TCPRoutes []tcproute.Route
+
+	// forward all requests over HTTP/2 without TLS (h2c), rather than just gRPC ones
+	UpstreamH2C bool
+
+	// records forwarded requests counting as activity, telling whether a service's UI is in use. shared by all
+	// handlers
+	RequestTracker *ActivityTracker
+
+	// records activity other than forwarded requests - open SSH connections, and forwarded TCP connections and the
+	// data sent over them. it's activity of the service, but doesn't mean its UI is in use
+	ConnectionTracker *ActivityTracker
+
+	// poll intervals overriding the defaults of handlers that poll
+	PollIntervals map[MetricName]time.Duration
 }
 
 type MetricName string
 
 const (
-	NumOfRequestsMetricName         MetricName = "num_of_requests"
+	NumOfRequestsMetricName        MetricName = "num_of_requests"
+	NumOfIgnoredRequestsMetricName MetricName = "num_of_ignored_requests"
+	NumOfResponsesMetricName       MetricName = "num_of_responses"
+
+	NumOfTCPConnectionsMetricName   MetricName = "num_of_tcp_connections"
+	TCPActiveConnectionsMetricName  MetricName = "tcp_active_connections"
+	TCPReceivedBytesMetricName      MetricName = "tcp_received_bytes"
+	TCPSentBytesMetricName          MetricName = "tcp_sent_bytes"
 	JupyterKernelBusynessMetricName MetricName = "jupyter_kernel_busyness"
+	SSHConnectionActiveMetricName   MetricName = "ssh_connection_active"
+
+	CodeServerActivityMetricName              MetricName = "code_server_activity"
+	CodeServerSecondsSinceHeartbeatMetricName MetricName = "code_server_seconds_since_heartbeat"
+
+	RStudioSessionActivityMetricName MetricName = "rstudio_session_activity"
+	RStudioSessionsMetricName        MetricName = "rstudio_sessions"
+
+	TensorBoardActivityMetricName   MetricName = "tensorboard_activity"
+	TensorBoardActiveRunsMetricName MetricName = "tensorboard_active_runs"
+	TensorBoardUIInUseMetricName    MetricName = "tensorboard_ui_in_use"
+
+	MLflowActivityMetricName   MetricName = "mlflow_activity"
+	MLflowActiveRunsMetricName MetricName = "mlflow_active_runs"
+	MLflowUIInUseMetricName    MetricName = "mlflow_ui_in_use"
+
+	RayClusterBusynessMetricName MetricName = "ray_cluster_busyness"
+	RayTasksMetricName           MetricName = "ray_tasks"
+	RayJobsMetricName            MetricName = "ray_jobs"
+	RayNodesMetricName           MetricName = "ray_nodes"
+
+	DaskClusterBusynessMetricName MetricName = "dask_cluster_busyness"
+	DaskTasksMetricName           MetricName = "dask_tasks"
+	DaskWorkersMetricName         MetricName = "dask_workers"
+
+	UpstreamMetricsMetricName   MetricName = "upstream_metrics"
+	UpstreamMetricsUpMetricName MetricName = "upstream_metrics_up"
+
+	UpstreamMetricsDroppedFamiliesMetricName MetricName = "upstream_metrics_dropped_families"
+)
+
+const (
+	DefaultOpenSSHConnectionFilePath = "/intercontainer/opensshconnection"
+	SSHConnectionIsAlive             = "1"
+	DefaultRStudioSessionsDirPath    = "/intercontainer/rstudio/sessions/active"
+	DefaultRayDashboardAddress       = "127.0.0.1:8265"
+	DefaultDaskDashboardAddress      = "127.0.0.1:8787"
 )
 
+// UIInUseWindow is how long after the last forwarded request a service's UI is considered in use, and
+// ConnectionActivityWindow how long after the last connection activity the service is considered active
 const (
-	OpenSSHConnectionFilePath = "/intercontainer/opensshconnection"
-	SSHConnectionIsAlive      = "1"
+	UIInUseWindow            = 5 * time.Minute
+	ConnectionActivityWindow = 5 * time.Minute
 )
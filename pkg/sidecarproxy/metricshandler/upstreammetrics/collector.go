@@ -0,0 +1,108 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package upstreammetrics
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// collector exposes the metrics last scraped from the upstream. it's an unchecked collector - the metrics it
+// collects aren't known when it's registered
+type collector struct {
+	lock        sync.RWMutex
+	metrics     []prometheus.Metric
+	familyNames map[string]bool
+}
+
+func (c *collector) Describe(chan<- *prometheus.Desc) {}
+
+func (c *collector) Collect(metricsChan chan<- prometheus.Metric) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	for _, metric := range c.metrics {
+		metricsChan <- metric
+	}
+}
+
+func (c *collector) setMetrics(metrics []prometheus.Metric, familyNames map[string]bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.metrics = metrics
+	c.familyNames = familyNames
+}
+
+// getFamilyNames returns the names of the metric families the collector exposes
+func (c *collector) getFamilyNames() map[string]bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.familyNames
+}
+
+// upstreamMetric is a scraped metric, written as is
+type upstreamMetric struct {
+	desc   *prometheus.Desc
+	metric *dto.Metric
+}
+
+func (m *upstreamMetric) Desc() *prometheus.Desc {
+	return m.desc
+}
+
+func (m *upstreamMetric) Write(out *dto.Metric) error {
+	proto.Reset(out)
+	proto.Merge(out, m.metric)
+	return nil
+}
+
+// relabelMetric returns a copy of the metric labeled with the given labels. upstream labels named like one of them
+// are kept with an "exported_" prefix, as Prometheus does when scraping
+func relabelMetric(metric *dto.Metric, labels prometheus.Labels) *dto.Metric {
+	relabeledMetric := proto.Clone(metric).(*dto.Metric)
+	relabeledMetric.Label = nil
+
+	takenLabelNames := map[string]bool{}
+	for labelName := range labels {
+		takenLabelNames[labelName] = true
+	}
+	for _, labelPair := range metric.GetLabel() {
+		labelName := labelPair.GetName()
+		for takenLabelNames[labelName] {
+			labelName = "exported_" + labelName
+		}
+		takenLabelNames[labelName] = true
+		relabeledMetric.Label = append(relabeledMetric.Label, &dto.LabelPair{
+			Name:  proto.String(labelName),
+			Value: proto.String(labelPair.GetValue()),
+		})
+	}
+	for labelName, labelValue := range labels {
+		relabeledMetric.Label = append(relabeledMetric.Label, &dto.LabelPair{
+			Name:  proto.String(labelName),
+			Value: proto.String(labelValue),
+		})
+	}
+
+	sort.Slice(relabeledMetric.Label, func(i, j int) bool {
+		return relabeledMetric.Label[i].GetName() < relabeledMetric.Label[j].GetName()
+	})
+	return relabeledMetric
+}
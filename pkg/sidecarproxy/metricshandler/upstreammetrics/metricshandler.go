@@ -0,0 +1,282 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package upstreammetrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler/abstract"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/tracing"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// the formats the upstream is asked for, both of which expfmt decodes
+const acceptHeader = "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.7," +
+	"text/plain;version=0.0.4;q=0.3"
+
+type metricsHandler struct {
+	*abstract.MetricsHandler
+	metric                *prometheus.GaugeVec
+	droppedFamiliesMetric *prometheus.GaugeVec
+	collector             *collector
+	nameFilter            *regexp.Regexp
+	httpClient            *http.Client
+
+	// the registry the upstream's metrics are exposed through, whose other families they mustn't collide with
+	gatherer prometheus.Gatherer
+
+	// the registerer the collector was registered with. being unchecked, a registry can't unregister it - so it's
+	// registered once and collects nothing while the handler is stopped
+	collectorRegisterer prometheus.Registerer
+}
+
+func NewMetricsHandler(logger logger.Logger,
+	configuration metricshandler.Configuration) (metricshandler.MetricsHandler, error) {
+
+	upstreamMetricsHandler := metricsHandler{
+		collector: &collector{},
+	}
+	abstractMetricsHandler, err := abstract.NewMetricsHandler(
+		logger.GetChild(string(metricshandler.UpstreamMetricsMetricName)),
+		configuration,
+		metricshandler.UpstreamMetricsMetricName)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create abstract metric handler")
+	}
+
+	// the filter must match the whole metric name, as Prometheus' relabeling regexes do
+	if configuration.UpstreamMetricsFilter != "" {
+		upstreamMetricsHandler.nameFilter, err = regexp.Compile("^(?:" + configuration.UpstreamMetricsFilter + ")$")
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to compile upstream metrics filter: %s",
+				configuration.UpstreamMetricsFilter)
+		}
+	}
+
+	upstreamMetricsHandler.MetricsHandler = abstractMetricsHandler
+	upstreamMetricsHandler.ConfigurePolling(15*time.Second, upstreamMetricsHandler.updateMetric)
+	upstreamMetricsHandler.httpClient = &http.Client{
+		Transport: tracing.NewTransport(http.DefaultTransport),
+		Timeout:   10 * time.Second,
+	}
+
+	return &upstreamMetricsHandler, nil
+}
+
+func (n *metricsHandler) RegisterMetrics(registerer prometheus.Registerer) error {
+	gaugeVec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: n.MetricNamespace,
+		Subsystem: n.MetricSubsystem,
+		Name:      string(metricshandler.UpstreamMetricsUpMetricName),
+		Help:      "Upstream metrics scrape health, 1 if the last scrape succeeded",
+	}, n.MetricLabels.Names())
+
+	if err := n.RegisterMetric(registerer, gaugeVec); err != nil {
+		return errors.Wrapf(err, "Failed to register metric: %s", string(metricshandler.UpstreamMetricsUpMetricName))
+	}
+
+	n.Logger.InfoWith("Metric registered successfully",
+		"metricName", string(metricshandler.UpstreamMetricsUpMetricName))
+	n.metric = gaugeVec
+
+	droppedFamiliesGaugeVec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: n.MetricNamespace,
+		Subsystem: n.MetricSubsystem,
+		Name:      string(metricshandler.UpstreamMetricsDroppedFamiliesMetricName),
+		Help:      "Number of upstream metric families dropped by the last scrape, as they're named like one of the proxy's own",
+	}, n.MetricLabels.Names())
+
+	if err := n.RegisterMetric(registerer, droppedFamiliesGaugeVec); err != nil {
+		return errors.Wrapf(err, "Failed to register metric: %s",
+			string(metricshandler.UpstreamMetricsDroppedFamiliesMetricName))
+	}
+
+	n.Logger.InfoWith("Metric registered successfully",
+		"metricName", string(metricshandler.UpstreamMetricsDroppedFamiliesMetricName))
+	n.droppedFamiliesMetric = droppedFamiliesGaugeVec
+
+	if n.collectorRegisterer != registerer {
+		if err := registerer.Register(n.collector); err != nil {
+			return errors.Wrap(err, "Failed to register upstream metrics collector")
+		}
+		n.collectorRegisterer = registerer
+	}
+
+	// the server's registry is a gatherer as well
+	n.gatherer, _ = registerer.(prometheus.Gatherer)
+
+	return nil
+}
+
+func (n *metricsHandler) Start() error {
+	n.Logger.InfoWith("Starting upstream metrics handler",
+		"url", n.getURL(),
+		"filter", n.UpstreamMetricsFilter)
+	if err := n.StartPolling(); err != nil {
+		return errors.Wrap(err, "Failed to start polling")
+	}
+	n.MarkStarted()
+	return nil
+}
+
+// Stop stops polling and drops the metrics last scraped, so they aren't exported with stale values
+func (n *metricsHandler) Stop() error {
+	if err := n.MetricsHandler.Stop(); err != nil {
+		return errors.Wrap(err, "Failed to stop metrics handler")
+	}
+	n.collector.setMetrics(nil, nil)
+	return nil
+}
+
+func (n *metricsHandler) updateMetric() error {
+	ctx, span := tracing.Tracer().Start(context.Background(), "upstream scrape metrics")
+	defer span.End()
+
+	labels := n.MetricLabels.Labels(nil)
+	metricFamilies, err := n.scrape(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		// like a scrape by Prometheus that failed, the upstream's metrics are absent rather than stale
+		n.collector.setMetrics(nil, nil)
+		n.metric.With(labels).Set(0)
+		return errors.Wrap(err, "Failed to scrape upstream metrics")
+	}
+
+	// a family named like one the proxy exposes (e.g. go_* of a Go upstream, while runtime metrics are included)
+	// would fail gathering the whole registry, taking the proxy's own metrics down with it
+	proxyFamilyNames := n.getProxyFamilyNames()
+
+	var metrics []prometheus.Metric
+	var droppedMetricFamilyNames []string
+	familyNames := map[string]bool{}
+	numOfFilteredMetricFamilies := 0
+	for _, metricFamily := range metricFamilies {
+		if n.nameFilter != nil && !n.nameFilter.MatchString(metricFamily.GetName()) {
+			numOfFilteredMetricFamilies++
+			continue
+		}
+		if proxyFamilyNames[metricFamily.GetName()] {
+			droppedMetricFamilyNames = append(droppedMetricFamilyNames, metricFamily.GetName())
+			continue
+		}
+		familyNames[metricFamily.GetName()] = true
+
+		desc := prometheus.NewDesc(metricFamily.GetName(), metricFamily.GetHelp(), nil, nil)
+		for _, metric := range metricFamily.GetMetric() {
+			metrics = append(metrics, &upstreamMetric{
+				desc:   desc,
+				metric: relabelMetric(metric, labels),
+			})
+		}
+	}
+
+	if len(droppedMetricFamilyNames) > 0 {
+		n.Logger.WarnWith("Dropped upstream metric families named like the proxy's own",
+			"metricFamilies", droppedMetricFamilyNames)
+	}
+
+	span.SetAttributes(attribute.Int("upstream.metric_families", len(metricFamilies)),
+		attribute.Int("upstream.filtered_metric_families", numOfFilteredMetricFamilies),
+		attribute.Int("upstream.dropped_metric_families", len(droppedMetricFamilyNames)),
+		attribute.Int("upstream.metrics", len(metrics)))
+	n.Logger.DebugWith("Scraped upstream metrics",
+		"metricFamilies", len(metricFamilies),
+		"filteredMetricFamilies", numOfFilteredMetricFamilies,
+		"droppedMetricFamilies", len(droppedMetricFamilyNames),
+		"metrics", len(metrics))
+
+	n.collector.setMetrics(metrics, familyNames)
+	n.metric.With(labels).Set(1)
+	n.droppedFamiliesMetric.With(labels).Set(float64(len(droppedMetricFamilyNames)))
+
+	return nil
+}
+
+func (n *metricsHandler) scrape(ctx context.Context) ([]*dto.MetricFamily, error) {
+	metricsURL := n.getURL()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metricsURL, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to create request to metrics endpoint: %s", metricsURL)
+	}
+	req.Header.Set("Accept", acceptHeader)
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to send request to metrics endpoint: %s", metricsURL)
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, errors.Errorf("Metrics endpoint responded with status %d: %s", resp.StatusCode, body)
+	}
+
+	var metricFamilies []*dto.MetricFamily
+	decoder := expfmt.NewDecoder(resp.Body, expfmt.ResponseFormat(resp.Header))
+	for {
+		metricFamily := &dto.MetricFamily{}
+		if err := decoder.Decode(metricFamily); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, errors.Wrap(err, "Failed to decode metrics")
+		}
+		metricFamilies = append(metricFamilies, metricFamily)
+	}
+
+	return metricFamilies, nil
+}
+
+// getProxyFamilyNames returns the names of the metric families in the registry other than the upstream's. the
+// registry is gathered as is, since handlers may register and unregister their metrics at runtime
+func (n *metricsHandler) getProxyFamilyNames() map[string]bool {
+	proxyFamilyNames := map[string]bool{}
+	if n.gatherer == nil {
+		return proxyFamilyNames
+	}
+
+	// families gathered despite an error are still taken, the error is the registry's to report
+	metricFamilies, _ := n.gatherer.Gather()
+	upstreamFamilyNames := n.collector.getFamilyNames()
+	for _, metricFamily := range metricFamilies {
+		if !upstreamFamilyNames[metricFamily.GetName()] {
+			proxyFamilyNames[metricFamily.GetName()] = true
+		}
+	}
+	return proxyFamilyNames
+}
+
+// getURL returns the configured URL, or the upstream's /metrics if none is
+func (n *metricsHandler) getURL() string {
+	if n.UpstreamMetricsURL != "" {
+		return n.UpstreamMetricsURL
+	}
+	return fmt.Sprintf("http://%s/metrics", n.GetForwardAddress())
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package upstreammetrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metriclabels"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
+
+	"github.com/nuclio/loggerus"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestStopAndRestart(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write([]byte("# TYPE upstream_foo gauge\nupstream_foo 1\n")) // nolint: errcheck
+	}))
+	defer upstream.Close()
+
+	metricsHandler := newTestMetricsHandler(t, upstream.URL)
+	registry := prometheus.NewRegistry()
+
+	for _, iteration := range []string{"first start", "restart"} {
+		if err := metricsHandler.RegisterMetrics(registry); err != nil {
+			t.Fatalf("%s: failed to register metrics: %v", iteration, err)
+		}
+		if err := metricsHandler.Start(); err != nil {
+			t.Fatalf("%s: failed to start: %v", iteration, err)
+		}
+		if err := metricsHandler.Probe(); err != nil {
+			t.Fatalf("%s: failed to scrape: %v", iteration, err)
+		}
+		if numOfMetrics := gatherFamily(t, registry, "upstream_foo"); numOfMetrics != 1 {
+			t.Fatalf("%s: expected a single upstream_foo metric, got %d", iteration, numOfMetrics)
+		}
+
+		if err := metricsHandler.Stop(); err != nil {
+			t.Fatalf("%s: failed to stop: %v", iteration, err)
+		}
+		metricsHandler.UnregisterMetrics(registry)
+		if numOfMetrics := gatherFamily(t, registry, "upstream_foo"); numOfMetrics != 0 {
+			t.Fatalf("%s: expected no upstream_foo metrics once stopped, got %d", iteration, numOfMetrics)
+		}
+	}
+}
+
+func newTestMetricsHandler(t *testing.T, upstreamMetricsURL string) metricshandler.MetricsHandler {
+	loggerInstance, err := loggerus.NewLoggerusForTests("test")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	metricLabels, err := metriclabels.NewLabelSet(metriclabels.Configuration{}, "namespace", "service", "instance")
+	if err != nil {
+		t.Fatalf("Failed to create metric labels: %v", err)
+	}
+
+	metricsHandler, err := NewMetricsHandler(loggerInstance, metricshandler.Configuration{
+		MetricLabels:       metricLabels,
+		UpstreamMetricsURL: upstreamMetricsURL,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create metrics handler: %v", err)
+	}
+	return metricsHandler
+}
+
+// gatherFamily gathers the registry, failing if gathering does, and returns the number of metrics in the family
+func gatherFamily(t *testing.T, registry *prometheus.Registry, familyName string) int {
+	t.Helper()
+
+	metricFamilies, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather: %v", err)
+	}
+	for _, metricFamily := range metricFamilies {
+		if metricFamily.GetName() == familyName {
+			return len(metricFamily.GetMetric())
+		}
+	}
+	return 0
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sidecarproxy
+
+import (
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
+
+	"github.com/nuclio/errors"
+)
+
+// ProbeResult is the outcome of probing a metrics handler
+type ProbeResult struct {
+	Status metricshandler.Status
+	Err    error
+}
+
+// Probe runs each metrics handler's collection once, without starting the server or the handlers
+func (s *Server) Probe() ([]ProbeResult, error) {
+	s.metricsHandlersLock.Lock()
+	defer s.metricsHandlersLock.Unlock()
+
+	if s.metricsHandlersStarted {
+		return nil, errors.New("Can't probe a server that was started")
+	}
+
+	var probeResults []ProbeResult
+	for _, metricsHandler := range s.metricsHandlers {
+		if err := metricsHandler.RegisterMetrics(s.registry); err != nil {
+			return nil, errors.Wrap(err, "Failed registering metrics")
+		}
+
+		probeErr := metricsHandler.Probe()
+		probeResults = append(probeResults, ProbeResult{
+			Status: metricsHandler.Status(),
+			Err:    probeErr,
+		})
+	}
+
+	return probeResults, nil
+}
@@ -0,0 +1,168 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package proxyprotocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/nuclio/errors"
+)
+
+const (
+	v1Prefix = "PROXY "
+
+	// the longest v1 header, "PROXY TCP6" with the longest addresses and ports, including the CRLF
+	v1MaxLength = 107
+
+	v2HeaderLength = 16
+)
+
+// v2Signature opens every v2 header
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+type header struct {
+	sourceAddress      net.Addr
+	destinationAddress net.Addr
+}
+
+// readHeader reads the header the connection starts with, if it starts with one. It returns a nil header if there is
+// none, or if the header doesn't carry addresses (e.g. health checks by the load balancer itself)
+func readHeader(reader *bufio.Reader) (*header, error) {
+	firstByte, err := reader.Peek(1)
+	if err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "Failed to read connection")
+	}
+
+	switch firstByte[0] {
+	case v1Prefix[0]:
+		if prefix, _ := reader.Peek(len(v1Prefix)); string(prefix) == v1Prefix {
+			return readV1Header(reader)
+		}
+	case v2Signature[0]:
+		if signature, _ := reader.Peek(len(v2Signature)); bytes.Equal(signature, v2Signature) {
+			return readV2Header(reader)
+		}
+	}
+
+	// not a header, the connection's data is read as is
+	return nil, nil
+}
+
+// readV1Header reads a header of the form "PROXY TCP4 <source> <destination> <source port> <destination port>\r\n"
+func readV1Header(reader *bufio.Reader) (*header, error) {
+	var line []byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) == v1MaxLength {
+			return nil, errors.New("PROXY protocol v1 header is too long")
+		}
+		nextByte, err := reader.ReadByte()
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read PROXY protocol v1 header")
+		}
+		line = append(line, nextByte)
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errors.Errorf("Invalid PROXY protocol v1 header: %q", strings.TrimSpace(string(line)))
+	}
+
+	sourceAddress, err := parseV1Address(fields[2], fields[4])
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid source address")
+	}
+	destinationAddress, err := parseV1Address(fields[3], fields[5])
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid destination address")
+	}
+
+	return &header{sourceAddress: sourceAddress, destinationAddress: destinationAddress}, nil
+}
+
+func parseV1Address(ipStr string, portStr string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return nil, errors.Errorf("Invalid IP: %s", ipStr)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, errors.Errorf("Invalid port: %s", portStr)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readV2Header reads a binary header - the signature, version and command, address family and protocol, the length of
+// what follows, then the addresses and any TLVs (which are skipped)
+func readV2Header(reader *bufio.Reader) (*header, error) {
+	fixedPart := make([]byte, v2HeaderLength)
+	if _, err := io.ReadFull(reader, fixedPart); err != nil {
+		return nil, errors.Wrap(err, "Failed to read PROXY protocol v2 header")
+	}
+
+	versionAndCommand, familyAndProtocol := fixedPart[12], fixedPart[13]
+	if versionAndCommand>>4 != 2 {
+		return nil, errors.Errorf("Unsupported PROXY protocol version: %d", versionAndCommand>>4)
+	}
+
+	addresses := make([]byte, binary.BigEndian.Uint16(fixedPart[14:16]))
+	if _, err := io.ReadFull(reader, addresses); err != nil {
+		return nil, errors.Wrap(err, "Failed to read PROXY protocol v2 addresses")
+	}
+
+	// LOCAL connections are made by the load balancer itself, and only TCP addresses are of interest
+	const proxyCommand, streamProtocol = 0x1, 0x1
+	if versionAndCommand&0xf != proxyCommand || familyAndProtocol&0xf != streamProtocol {
+		return nil, nil
+	}
+
+	var ipLength int
+	switch familyAndProtocol >> 4 {
+	case 0x1:
+		ipLength = net.IPv4len
+	case 0x2:
+		ipLength = net.IPv6len
+	default:
+		return nil, nil
+	}
+
+	if len(addresses) < 2*ipLength+4 {
+		return nil, errors.Errorf("PROXY protocol v2 addresses are too short: %d bytes", len(addresses))
+	}
+	ports := addresses[2*ipLength:]
+
+	return &header{
+		sourceAddress: &net.TCPAddr{
+			IP:   net.IP(addresses[:ipLength]),
+			Port: int(binary.BigEndian.Uint16(ports[0:2])),
+		},
+		destinationAddress: &net.TCPAddr{
+			IP:   net.IP(addresses[ipLength : 2*ipLength]),
+			Port: int(binary.BigEndian.Uint16(ports[2:4])),
+		},
+	}, nil
+}
@@ -0,0 +1,215 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package proxyprotocol
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestReadHeader(t *testing.T) {
+	ipv4Addresses := append(append(net.ParseIP("10.0.0.1").To4(), net.ParseIP("10.0.0.2").To4()...), 0x1f, 0x90, 0x00, 0x50)
+	ipv6Addresses := append(append(net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")...), 0x1f, 0x90, 0x00, 0x50)
+	longestV1Header := "PROXY TCP6 ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe 65535 65535\r\n"
+
+	for _, testCase := range []struct {
+		name                       string
+		input                      string
+		expectedSourceAddress      string
+		expectedDestinationAddress string
+		expectedError              string
+		expectedRemainder          string
+	}{
+		{
+			name:              "no header",
+			input:             "GET / HTTP/1.1\r\n",
+			expectedRemainder: "GET / HTTP/1.1\r\n",
+		},
+		{
+			name: "empty connection",
+		},
+		{
+			name:              "shorter than the v1 prefix",
+			input:             "PRO",
+			expectedRemainder: "PRO",
+		},
+		{
+			name:              "looks like the v1 prefix",
+			input:             "PROXIES\r\n",
+			expectedRemainder: "PROXIES\r\n",
+		},
+		{
+			name:                       "v1 TCP4",
+			input:                      "PROXY TCP4 192.168.1.10 10.0.0.1 56324 8080\r\nGET / HTTP/1.1\r\n",
+			expectedSourceAddress:      "192.168.1.10:56324",
+			expectedDestinationAddress: "10.0.0.1:8080",
+			expectedRemainder:          "GET / HTTP/1.1\r\n",
+		},
+		{
+			name:                       "v1 TCP6",
+			input:                      "PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n",
+			expectedSourceAddress:      "[2001:db8::1]:56324",
+			expectedDestinationAddress: "[2001:db8::2]:443",
+		},
+		{
+			name:                       "v1 with the longest addresses",
+			input:                      longestV1Header + "data",
+			expectedSourceAddress:      "[ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff]:65535",
+			expectedDestinationAddress: "[ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe]:65535",
+			expectedRemainder:          "data",
+		},
+		{
+			name:              "v1 UNKNOWN",
+			input:             "PROXY UNKNOWN\r\ndata",
+			expectedRemainder: "data",
+		},
+		{
+			name:          "v1 truncated",
+			input:         "PROXY TCP4 192.168.1.10 10.0.0.1",
+			expectedError: "Failed to read PROXY protocol v1 header",
+		},
+		{
+			name:          "v1 oversized",
+			input:         "PROXY TCP4 " + strings.Repeat("1", v1MaxLength) + "\r\n",
+			expectedError: "PROXY protocol v1 header is too long",
+		},
+		{
+			name:          "v1 missing a port",
+			input:         "PROXY TCP4 192.168.1.10 10.0.0.1 56324\r\n",
+			expectedError: "Invalid PROXY protocol v1 header",
+		},
+		{
+			name:          "v1 unknown protocol",
+			input:         "PROXY UDP4 192.168.1.10 10.0.0.1 56324 8080\r\n",
+			expectedError: "Invalid PROXY protocol v1 header",
+		},
+		{
+			name:          "v1 invalid IP",
+			input:         "PROXY TCP4 192.168.1 10.0.0.1 56324 8080\r\n",
+			expectedError: "Invalid source address",
+		},
+		{
+			name:          "v1 invalid port",
+			input:         "PROXY TCP4 192.168.1.10 10.0.0.1 56324 70000\r\n",
+			expectedError: "Invalid destination address",
+		},
+		{
+			name:                       "v2 TCP over IPv4",
+			input:                      v2Header(0x21, 0x11, ipv4Addresses) + "data",
+			expectedSourceAddress:      "10.0.0.1:8080",
+			expectedDestinationAddress: "10.0.0.2:80",
+			expectedRemainder:          "data",
+		},
+		{
+			name:                       "v2 TCP over IPv6",
+			input:                      v2Header(0x21, 0x21, ipv6Addresses) + "data",
+			expectedSourceAddress:      "[2001:db8::1]:8080",
+			expectedDestinationAddress: "[2001:db8::2]:80",
+			expectedRemainder:          "data",
+		},
+		{
+			name:                       "v2 with TLVs",
+			input:                      v2Header(0x21, 0x11, append(ipv4Addresses, 0x04, 0x00, 0x01, 0x00)) + "data",
+			expectedSourceAddress:      "10.0.0.1:8080",
+			expectedDestinationAddress: "10.0.0.2:80",
+			expectedRemainder:          "data",
+		},
+		{
+			name:              "v2 LOCAL",
+			input:             v2Header(0x20, 0x11, ipv4Addresses) + "data",
+			expectedRemainder: "data",
+		},
+		{
+			name:              "v2 UDP",
+			input:             v2Header(0x21, 0x12, ipv4Addresses) + "data",
+			expectedRemainder: "data",
+		},
+		{
+			name:              "v2 unspecified family",
+			input:             v2Header(0x21, 0x01, nil) + "data",
+			expectedRemainder: "data",
+		},
+		{
+			name:          "v2 unsupported version",
+			input:         v2Header(0x11, 0x11, ipv4Addresses),
+			expectedError: "Unsupported PROXY protocol version: 1",
+		},
+		{
+			name:          "v2 truncated fixed part",
+			input:         v2Header(0x21, 0x11, ipv4Addresses)[:14],
+			expectedError: "Failed to read PROXY protocol v2 header",
+		},
+		{
+			name:          "v2 truncated addresses",
+			input:         v2Header(0x21, 0x11, ipv4Addresses)[:20],
+			expectedError: "Failed to read PROXY protocol v2 addresses",
+		},
+		{
+			name:          "v2 addresses too short for their family",
+			input:         v2Header(0x21, 0x21, ipv4Addresses),
+			expectedError: "PROXY protocol v2 addresses are too short: 12 bytes",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			reader := bufio.NewReader(strings.NewReader(testCase.input))
+			readHeader, err := readHeader(reader)
+
+			if testCase.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), testCase.expectedError) {
+					t.Fatalf("Expected error containing %q, got: %v", testCase.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var sourceAddress, destinationAddress string
+			if readHeader != nil {
+				sourceAddress = readHeader.sourceAddress.String()
+				destinationAddress = readHeader.destinationAddress.String()
+			}
+			if sourceAddress != testCase.expectedSourceAddress {
+				t.Errorf("Expected source address %q, got %q", testCase.expectedSourceAddress, sourceAddress)
+			}
+			if destinationAddress != testCase.expectedDestinationAddress {
+				t.Errorf("Expected destination address %q, got %q",
+					testCase.expectedDestinationAddress,
+					destinationAddress)
+			}
+
+			remainder, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("Failed to read remainder: %v", err)
+			}
+			if string(remainder) != testCase.expectedRemainder {
+				t.Errorf("Expected remainder %q, got %q", testCase.expectedRemainder, remainder)
+			}
+		})
+	}
+}
+
+// v2Header encodes a v2 header of the given version and command, family and protocol, and addresses (and TLVs)
+func v2Header(versionAndCommand byte, familyAndProtocol byte, addresses []byte) string {
+	encoded := append([]byte{}, v2Signature...)
+	encoded = append(encoded, versionAndCommand, familyAndProtocol)
+	encoded = binary.BigEndian.AppendUint16(encoded, uint16(len(addresses)))
+	return string(append(encoded, addresses...))
+}
@@ -0,0 +1,124 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package proxyprotocol
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/forwarded"
+
+	"github.com/nuclio/logger"
+)
+
+// DefaultHeaderTimeout limits how long a connection may take to send its PROXY protocol header
+const DefaultHeaderTimeout = 10 * time.Second
+
+// Listener accepts connections that may start with a PROXY protocol (v1 or v2) header, as sent by load balancers to
+// pass on the client's address. Connections whose header names a client report its address as their remote address
+type Listener struct {
+	net.Listener
+	logger          logger.Logger
+	trustedNetworks []*net.IPNet
+	headerTimeout   time.Duration
+}
+
+// NewListener wraps the listener. Headers are only parsed on connections from the trusted networks, so that clients
+// can't spoof their address by sending a header of their own
+func NewListener(logger logger.Logger,
+	listener net.Listener,
+	trustedNetworks []*net.IPNet,
+	headerTimeout time.Duration) *Listener {
+	return &Listener{
+		Listener:        listener,
+		logger:          logger,
+		trustedNetworks: trustedNetworks,
+		headerTimeout:   headerTimeout,
+	}
+}
+
+// Accept doesn't wait for the header - it's read by the connection on first use, so a slow peer doesn't hold up
+// accepting others
+func (l *Listener) Accept() (net.Conn, error) {
+	connection, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	peerAddress, ok := connection.RemoteAddr().(*net.TCPAddr)
+	if !ok || !forwarded.Contains(l.trustedNetworks, peerAddress.IP) {
+		return connection, nil
+	}
+
+	return &conn{
+		Conn:          connection,
+		logger:        l.logger,
+		reader:        bufio.NewReader(connection),
+		headerTimeout: l.headerTimeout,
+	}, nil
+}
+
+type conn struct {
+	net.Conn
+	logger        logger.Logger
+	reader        *bufio.Reader
+	headerTimeout time.Duration
+	headerOnce    sync.Once
+	headerErr     error
+	header        *header
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.headerErr != nil {
+		return 0, c.headerErr
+	}
+	return c.reader.Read(b)
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.header != nil && c.header.sourceAddress != nil {
+		return c.header.sourceAddress
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *conn) LocalAddr() net.Addr {
+	c.readHeader()
+	if c.header != nil && c.header.destinationAddress != nil {
+		return c.header.destinationAddress
+	}
+	return c.Conn.LocalAddr()
+}
+
+func (c *conn) readHeader() {
+	c.headerOnce.Do(func() {
+		if c.headerTimeout > 0 {
+			_ = c.Conn.SetReadDeadline(time.Now().Add(c.headerTimeout))
+			defer c.Conn.SetReadDeadline(time.Time{}) // nolint: errcheck
+		}
+
+		c.header, c.headerErr = readHeader(c.reader)
+		if c.headerErr != nil {
+			c.logger.DebugWith("Failed to read PROXY protocol header",
+				"from", c.Conn.RemoteAddr().String(),
+				"err", c.headerErr.Error())
+		}
+	})
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package proxyprotocol
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/forwarded"
+
+	"github.com/nuclio/loggerus"
+)
+
+func TestListener(t *testing.T) {
+	const header = "PROXY TCP4 192.168.1.10 10.0.0.1 56324 8080\r\n"
+
+	for _, testCase := range []struct {
+		name                    string
+		trustedProxies          string
+		expectedRemoteAddressIP string
+		expectedData            string
+	}{
+		{
+			name:                    "trusted peer",
+			trustedProxies:          "127.0.0.0/8",
+			expectedRemoteAddressIP: "192.168.1.10",
+			expectedData:            "data",
+		},
+		{
+			name:                    "untrusted peer",
+			trustedProxies:          "10.0.0.0/8",
+			expectedRemoteAddressIP: "127.0.0.1",
+			expectedData:            header + "data",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			logger, err := loggerus.NewLoggerusForTests("test")
+			if err != nil {
+				t.Fatalf("Failed to create logger: %v", err)
+			}
+			trustedNetworks, err := forwarded.ParseNetworks(testCase.trustedProxies)
+			if err != nil {
+				t.Fatalf("Failed to parse trusted proxies: %v", err)
+			}
+
+			tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("Failed to listen: %v", err)
+			}
+			listener := NewListener(logger, tcpListener, trustedNetworks, time.Second)
+			defer listener.Close() // nolint: errcheck
+
+			go func() {
+				clientConnection, err := net.Dial("tcp", tcpListener.Addr().String())
+				if err != nil {
+					return
+				}
+				defer clientConnection.Close() // nolint: errcheck
+				_, _ = clientConnection.Write([]byte(header + "data"))
+			}()
+
+			connection, err := listener.Accept()
+			if err != nil {
+				t.Fatalf("Failed to accept: %v", err)
+			}
+			defer connection.Close() // nolint: errcheck
+
+			remoteAddress, ok := connection.RemoteAddr().(*net.TCPAddr)
+			if !ok || remoteAddress.IP.String() != testCase.expectedRemoteAddressIP {
+				t.Errorf("Expected remote address IP %s, got %s",
+					testCase.expectedRemoteAddressIP,
+					connection.RemoteAddr())
+			}
+
+			data, err := io.ReadAll(connection)
+			if err != nil {
+				t.Fatalf("Failed to read: %v", err)
+			}
+			if string(data) != testCase.expectedData {
+				t.Errorf("Expected data %q, got %q", testCase.expectedData, data)
+			}
+		})
+	}
+}
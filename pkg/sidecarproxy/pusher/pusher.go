@@ -0,0 +1,153 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pusher
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Pusher periodically pushes a registry to a pushgateway or a remote write endpoint, and once more when stopped, so
+// that activity since the last scrape / push isn't lost when the pod goes away
+type Pusher struct {
+	logger        logger.Logger
+	configuration Configuration
+	client        client
+	stopChan      chan struct{}
+	stopOnce      sync.Once
+	doneChan      chan struct{}
+
+	// the pushing goroutine closes doneChan, so Stop only waits for it if Start ran
+	stateLock sync.Mutex
+	started   bool
+	stopped   bool
+}
+
+// NewPusher returns nil if pushing is disabled
+func NewPusher(logger logger.Logger,
+	configuration Configuration,
+	gatherer prometheus.Gatherer,
+	instanceName string) (*Pusher, error) {
+
+	if configuration.Mode == "" || configuration.Mode == DisabledMode {
+		return nil, nil
+	}
+
+	if err := configuration.Validate(); err != nil {
+		return nil, errors.Wrap(err, "Invalid push configuration")
+	}
+	if configuration.Timeout <= 0 {
+		configuration.Timeout = 10 * time.Second
+	}
+	if configuration.Job == "" {
+		configuration.Job = "sidecar-proxy"
+	}
+
+	newPusher := Pusher{
+		logger:        logger.GetChild("pusher"),
+		configuration: configuration,
+		stopChan:      make(chan struct{}),
+		doneChan:      make(chan struct{}),
+	}
+
+	switch configuration.Mode {
+	case PushgatewayMode:
+		newPusher.client = newPushgatewayClient(configuration, gatherer, instanceName)
+	case RemoteWriteMode:
+		newPusher.client = newRemoteWriteClient(configuration, gatherer)
+	default:
+		return nil, errors.Errorf("Unknown push mode: %s", configuration.Mode)
+	}
+
+	return &newPusher, nil
+}
+
+func (p *Pusher) Start() {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+	if p.started || p.stopped {
+		return
+	}
+	p.started = true
+
+	p.logger.InfoWith("Starting metrics pusher",
+		"mode", p.configuration.Mode,
+		"url", p.configuration.URL,
+		"interval", p.configuration.Interval)
+
+	go func() {
+		defer close(p.doneChan)
+
+		ticker := time.NewTicker(p.configuration.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				p.push(context.Background())
+			case <-p.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the periodic pushes and pushes one last time. If the pusher wasn't started (e.g. the server was stopped
+// while starting) there's nothing to push
+func (p *Pusher) Stop(ctx context.Context) error {
+	p.stateLock.Lock()
+	started := p.started
+	p.stopped = true
+	p.stateLock.Unlock()
+
+	p.stopOnce.Do(func() {
+		close(p.stopChan)
+	})
+	if !started {
+		return nil
+	}
+
+	select {
+	case <-p.doneChan:
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "Timed out waiting for the pusher to stop")
+	}
+
+	p.logger.Info("Pushing metrics before shutdown")
+	pushCtx, cancel := context.WithTimeout(ctx, p.configuration.Timeout)
+	defer cancel()
+
+	if err := p.client.push(pushCtx); err != nil {
+		return errors.Wrap(err, "Failed to push metrics before shutdown")
+	}
+	return nil
+}
+
+func (p *Pusher) push(ctx context.Context) {
+	pushCtx, cancel := context.WithTimeout(ctx, p.configuration.Timeout)
+	defer cancel()
+
+	if err := p.client.push(pushCtx); err != nil {
+		p.logger.WarnWith("Failed pushing metrics", "err", errors.GetErrorStackString(err, 10))
+		return
+	}
+	p.logger.Debug("Pushed metrics")
+}
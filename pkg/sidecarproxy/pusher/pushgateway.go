@@ -0,0 +1,47 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pusher
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+type pushgatewayClient struct {
+	pusher *push.Pusher
+}
+
+func newPushgatewayClient(configuration Configuration,
+	gatherer prometheus.Gatherer,
+	instanceName string) *pushgatewayClient {
+
+	pusher := push.New(configuration.URL, configuration.Job).
+		Gatherer(gatherer).
+		Client(&http.Client{Timeout: configuration.Timeout})
+	if instanceName != "" {
+		pusher = pusher.Grouping("instance", instanceName)
+	}
+
+	return &pushgatewayClient{pusher: pusher}
+}
+
+// push replaces all metrics of the group, so series that are gone from the registry are gone from the pushgateway
+func (p *pushgatewayClient) push(ctx context.Context) error {
+	return p.pusher.PushContext(ctx)
+}
@@ -0,0 +1,195 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pusher
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/nuclio/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type label struct {
+	name  string
+	value string
+}
+
+type timeSeries struct {
+	labels []label
+	value  float64
+}
+
+type remoteWriteClient struct {
+	url        string
+	job        string
+	gatherer   prometheus.Gatherer
+	httpClient *http.Client
+}
+
+func newRemoteWriteClient(configuration Configuration, gatherer prometheus.Gatherer) *remoteWriteClient {
+	return &remoteWriteClient{
+		url:        configuration.URL,
+		job:        configuration.Job,
+		gatherer:   gatherer,
+		httpClient: &http.Client{Timeout: configuration.Timeout},
+	}
+}
+
+func (r *remoteWriteClient) push(ctx context.Context) error {
+	metricFamilies, err := r.gatherer.Gather()
+	if err != nil {
+		return errors.Wrap(err, "Failed to gather metrics")
+	}
+
+	var series []timeSeries
+	for _, metricFamily := range metricFamilies {
+		series = append(series, r.toTimeSeries(metricFamily)...)
+	}
+	if len(series) == 0 {
+		return nil
+	}
+
+	body := snappy.Encode(nil, encodeWriteRequest(series, time.Now().UnixMilli()))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "Failed to create remote write request")
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to send remote write request: %s", r.url)
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode/100 != 2 {
+		responseBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return errors.Errorf("Remote write failed with status %d: %s", resp.StatusCode, responseBody)
+	}
+
+	return nil
+}
+
+// toTimeSeries flattens a metric family into samples, the same way Prometheus does when scraping it
+func (r *remoteWriteClient) toTimeSeries(metricFamily *dto.MetricFamily) []timeSeries {
+	var series []timeSeries
+	name := metricFamily.GetName()
+
+	for _, metric := range metricFamily.GetMetric() {
+		newSeries := func(nameSuffix string, value float64, extraLabels ...label) {
+			labels := []label{{"__name__", name + nameSuffix}}
+			if r.job != "" {
+				labels = append(labels, label{"job", r.job})
+			}
+			for _, labelPair := range metric.GetLabel() {
+
+				// an empty label is the same as no label to prometheus, and some receivers reject them
+				if labelPair.GetValue() != "" {
+					labels = append(labels, label{labelPair.GetName(), labelPair.GetValue()})
+				}
+			}
+			labels = append(labels, extraLabels...)
+			series = append(series, timeSeries{labels: labels, value: value})
+		}
+
+		switch metricFamily.GetType() {
+		case dto.MetricType_COUNTER:
+			newSeries("", metric.GetCounter().GetValue())
+		case dto.MetricType_GAUGE:
+			newSeries("", metric.GetGauge().GetValue())
+		case dto.MetricType_UNTYPED:
+			newSeries("", metric.GetUntyped().GetValue())
+		case dto.MetricType_SUMMARY:
+			summary := metric.GetSummary()
+			for _, quantile := range summary.GetQuantile() {
+				newSeries("", quantile.GetValue(), label{"quantile", formatFloat(quantile.GetQuantile())})
+			}
+			newSeries("_sum", summary.GetSampleSum())
+			newSeries("_count", float64(summary.GetSampleCount()))
+		case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+			histogram := metric.GetHistogram()
+			for _, bucket := range histogram.GetBucket() {
+				newSeries("_bucket", float64(bucket.GetCumulativeCount()), label{"le", formatFloat(bucket.GetUpperBound())})
+			}
+			newSeries("_bucket", float64(histogram.GetSampleCount()), label{"le", "+Inf"})
+			newSeries("_sum", histogram.GetSampleSum())
+			newSeries("_count", float64(histogram.GetSampleCount()))
+		}
+	}
+
+	return series
+}
+
+// encodeWriteRequest encodes a prometheus.WriteRequest protobuf message:
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(series []timeSeries, timestamp int64) []byte {
+	var writeRequest []byte
+	for _, singleSeries := range series {
+
+		// receivers require labels sorted by name
+		sort.Slice(singleSeries.labels, func(i, j int) bool {
+			return singleSeries.labels[i].name < singleSeries.labels[j].name
+		})
+
+		var encodedSeries []byte
+		for _, seriesLabel := range singleSeries.labels {
+			var encodedLabel []byte
+			encodedLabel = protowire.AppendTag(encodedLabel, 1, protowire.BytesType)
+			encodedLabel = protowire.AppendString(encodedLabel, seriesLabel.name)
+			encodedLabel = protowire.AppendTag(encodedLabel, 2, protowire.BytesType)
+			encodedLabel = protowire.AppendString(encodedLabel, seriesLabel.value)
+
+			encodedSeries = protowire.AppendTag(encodedSeries, 1, protowire.BytesType)
+			encodedSeries = protowire.AppendBytes(encodedSeries, encodedLabel)
+		}
+
+		var encodedSample []byte
+		encodedSample = protowire.AppendTag(encodedSample, 1, protowire.Fixed64Type)
+		encodedSample = protowire.AppendFixed64(encodedSample, math.Float64bits(singleSeries.value))
+		encodedSample = protowire.AppendTag(encodedSample, 2, protowire.VarintType)
+		encodedSample = protowire.AppendVarint(encodedSample, uint64(timestamp))
+
+		encodedSeries = protowire.AppendTag(encodedSeries, 2, protowire.BytesType)
+		encodedSeries = protowire.AppendBytes(encodedSeries, encodedSample)
+
+		writeRequest = protowire.AppendTag(writeRequest, 1, protowire.BytesType)
+		writeRequest = protowire.AppendBytes(writeRequest, encodedSeries)
+	}
+	return writeRequest
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,381 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pusher
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/nuclio/loggerus"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// decodedSeries is a time series as decoded by the protobuf library, rather than by hand
+type decodedSeries struct {
+	labels    []label
+	value     float64
+	timestamp int64
+}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	for _, testCase := range []struct {
+		name      string
+		series    []timeSeries
+		timestamp int64
+		expected  []decodedSeries
+	}{
+		{
+			name:      "no series",
+			timestamp: 1,
+		},
+		{
+			name: "labels are sorted",
+			series: []timeSeries{
+				{labels: []label{{"job", "sidecar-proxy"}, {"__name__", "num_of_requests"}, {"app", "x"}}, value: 3},
+			},
+			timestamp: 1700000000000,
+			expected: []decodedSeries{
+				{
+					labels:    []label{{"__name__", "num_of_requests"}, {"app", "x"}, {"job", "sidecar-proxy"}},
+					value:     3,
+					timestamp: 1700000000000,
+				},
+			},
+		},
+		{
+			name: "multiple series",
+			series: []timeSeries{
+				{labels: []label{{"__name__", "a"}}, value: -1.5},
+				{labels: []label{{"__name__", "b"}, {"le", "+Inf"}}, value: math.Inf(1)},
+			},
+			timestamp: 42,
+			expected: []decodedSeries{
+				{labels: []label{{"__name__", "a"}}, value: -1.5, timestamp: 42},
+				{labels: []label{{"__name__", "b"}, {"le", "+Inf"}}, value: math.Inf(1), timestamp: 42},
+			},
+		},
+		{
+			name: "empty and non ascii values",
+			series: []timeSeries{
+				{labels: []label{{"__name__", "c"}, {"path", ""}, {"user", "café"}}, value: 0},
+			},
+			timestamp: 0,
+			expected: []decodedSeries{
+				{labels: []label{{"__name__", "c"}, {"path", ""}, {"user", "café"}}, value: 0, timestamp: 0},
+			},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			decoded := decodeWriteRequest(t, encodeWriteRequest(testCase.series, testCase.timestamp))
+			if !reflect.DeepEqual(decoded, testCase.expected) {
+				t.Fatalf("Unexpected write request\nexpected: %+v\ngot:      %+v", testCase.expected, decoded)
+			}
+		})
+	}
+}
+
+func TestToTimeSeries(t *testing.T) {
+	for _, testCase := range []struct {
+		name         string
+		job          string
+		metricFamily *dto.MetricFamily
+		expected     []timeSeries
+	}{
+		{
+			name: "counter with an empty label",
+			job:  "sidecar-proxy",
+			metricFamily: &dto.MetricFamily{
+				Name: proto.String("num_of_requests"),
+				Type: dto.MetricType_COUNTER.Enum(),
+				Metric: []*dto.Metric{
+					{
+						Label: []*dto.LabelPair{
+							{Name: proto.String("namespace"), Value: proto.String("default")},
+							{Name: proto.String("service_name"), Value: proto.String("")},
+						},
+						Counter: &dto.Counter{Value: proto.Float64(7)},
+					},
+				},
+			},
+			expected: []timeSeries{
+				{
+					labels: []label{{"__name__", "num_of_requests"}, {"job", "sidecar-proxy"}, {"namespace", "default"}},
+					value:  7,
+				},
+			},
+		},
+		{
+			name: "summary",
+			metricFamily: &dto.MetricFamily{
+				Name: proto.String("latency"),
+				Type: dto.MetricType_SUMMARY.Enum(),
+				Metric: []*dto.Metric{
+					{
+						Summary: &dto.Summary{
+							SampleCount: proto.Uint64(2),
+							SampleSum:   proto.Float64(0.3),
+							Quantile: []*dto.Quantile{
+								{Quantile: proto.Float64(0.5), Value: proto.Float64(0.1)},
+							},
+						},
+					},
+				},
+			},
+			expected: []timeSeries{
+				{labels: []label{{"__name__", "latency"}, {"quantile", "0.5"}}, value: 0.1},
+				{labels: []label{{"__name__", "latency_sum"}}, value: 0.3},
+				{labels: []label{{"__name__", "latency_count"}}, value: 2},
+			},
+		},
+		{
+			name: "histogram",
+			metricFamily: &dto.MetricFamily{
+				Name: proto.String("size"),
+				Type: dto.MetricType_HISTOGRAM.Enum(),
+				Metric: []*dto.Metric{
+					{
+						Histogram: &dto.Histogram{
+							SampleCount: proto.Uint64(3),
+							SampleSum:   proto.Float64(12),
+							Bucket: []*dto.Bucket{
+								{UpperBound: proto.Float64(1), CumulativeCount: proto.Uint64(1)},
+								{UpperBound: proto.Float64(10), CumulativeCount: proto.Uint64(2)},
+							},
+						},
+					},
+				},
+			},
+			expected: []timeSeries{
+				{labels: []label{{"__name__", "size_bucket"}, {"le", "1"}}, value: 1},
+				{labels: []label{{"__name__", "size_bucket"}, {"le", "10"}}, value: 2},
+				{labels: []label{{"__name__", "size_bucket"}, {"le", "+Inf"}}, value: 3},
+				{labels: []label{{"__name__", "size_sum"}}, value: 12},
+				{labels: []label{{"__name__", "size_count"}}, value: 3},
+			},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			client := remoteWriteClient{job: testCase.job}
+			series := client.toTimeSeries(testCase.metricFamily)
+			if !reflect.DeepEqual(series, testCase.expected) {
+				t.Fatalf("Unexpected time series\nexpected: %+v\ngot:      %+v", testCase.expected, series)
+			}
+		})
+	}
+}
+
+func TestRemoteWritePush(t *testing.T) {
+	requestChan := make(chan *http.Request, 1)
+	bodyChan := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		requestChan <- req
+		bodyChan <- body
+		res.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "num_of_requests"})
+	registry.MustRegister(counter)
+	counter.Add(5)
+
+	client := newRemoteWriteClient(Configuration{
+		URL:     server.URL,
+		Job:     "sidecar-proxy",
+		Timeout: 5 * time.Second,
+	}, registry)
+
+	pushTime := time.Now().UnixMilli()
+	if err := client.push(context.Background()); err != nil {
+		t.Fatalf("Failed to push: %v", err)
+	}
+
+	req := <-requestChan
+	for headerName, expectedValue := range map[string]string{
+		"Content-Encoding":                  "snappy",
+		"Content-Type":                      "application/x-protobuf",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+	} {
+		if value := req.Header.Get(headerName); value != expectedValue {
+			t.Errorf("Expected header %s to be %q, got %q", headerName, expectedValue, value)
+		}
+	}
+
+	writeRequest, err := snappy.Decode(nil, <-bodyChan)
+	if err != nil {
+		t.Fatalf("Failed to decode snappy body: %v", err)
+	}
+
+	decoded := decodeWriteRequest(t, writeRequest)
+	if len(decoded) != 1 {
+		t.Fatalf("Expected a single series, got %+v", decoded)
+	}
+	expectedLabels := []label{{"__name__", "num_of_requests"}, {"job", "sidecar-proxy"}}
+	if !reflect.DeepEqual(decoded[0].labels, expectedLabels) || decoded[0].value != 5 {
+		t.Fatalf("Unexpected series: %+v", decoded[0])
+	}
+	if decoded[0].timestamp < pushTime || decoded[0].timestamp > time.Now().UnixMilli() {
+		t.Fatalf("Unexpected timestamp: %d", decoded[0].timestamp)
+	}
+}
+
+func TestStopWithoutStart(t *testing.T) {
+	logger, err := loggerus.NewLoggerusForTests("test")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	pusher, err := NewPusher(logger, Configuration{
+		Mode:     RemoteWriteMode,
+		URL:      "http://127.0.0.1:1/api/v1/write",
+		Interval: time.Minute,
+	}, prometheus.NewRegistry(), "")
+	if err != nil {
+		t.Fatalf("Failed to create pusher: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := pusher.Stop(ctx); err != nil {
+		t.Fatalf("Expected stopping a pusher that wasn't started to succeed, got: %v", err)
+	}
+
+	// starting after stopping is a no-op
+	pusher.Start()
+	if err := pusher.Stop(ctx); err != nil {
+		t.Fatalf("Expected stopping twice to succeed, got: %v", err)
+	}
+}
+
+// decodeWriteRequest decodes a write request with the protobuf library, by the remote write protocol's schema
+func decodeWriteRequest(t *testing.T, encoded []byte) []decodedSeries {
+	t.Helper()
+
+	writeRequest := dynamicpb.NewMessage(writeRequestDescriptor(t))
+	if err := proto.Unmarshal(encoded, writeRequest); err != nil {
+		t.Fatalf("Failed to unmarshal write request: %v", err)
+	}
+
+	var decoded []decodedSeries
+	timeSeriesList := writeRequest.Get(writeRequest.Descriptor().Fields().ByName("timeseries")).List()
+	for seriesIndex := 0; seriesIndex < timeSeriesList.Len(); seriesIndex++ {
+		series := timeSeriesList.Get(seriesIndex).Message()
+		seriesFields := series.Descriptor().Fields()
+
+		var singleDecoded decodedSeries
+		labelList := series.Get(seriesFields.ByName("labels")).List()
+		for labelIndex := 0; labelIndex < labelList.Len(); labelIndex++ {
+			labelMessage := labelList.Get(labelIndex).Message()
+			labelFields := labelMessage.Descriptor().Fields()
+			singleDecoded.labels = append(singleDecoded.labels, label{
+				name:  labelMessage.Get(labelFields.ByName("name")).String(),
+				value: labelMessage.Get(labelFields.ByName("value")).String(),
+			})
+		}
+
+		sampleList := series.Get(seriesFields.ByName("samples")).List()
+		if sampleList.Len() != 1 {
+			t.Fatalf("Expected a single sample per series, got %d", sampleList.Len())
+		}
+		sample := sampleList.Get(0).Message()
+		sampleFields := sample.Descriptor().Fields()
+		singleDecoded.value = sample.Get(sampleFields.ByName("value")).Float()
+		singleDecoded.timestamp = sample.Get(sampleFields.ByName("timestamp")).Int()
+
+		decoded = append(decoded, singleDecoded)
+	}
+	return decoded
+}
+
+// writeRequestDescriptor describes prometheus.WriteRequest, as defined by Prometheus' remote.proto and types.proto
+func writeRequestDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+
+	field := func(name string,
+		number int32,
+		fieldType descriptorpb.FieldDescriptorProto_Type,
+		typeName string,
+		repeated bool) *descriptorpb.FieldDescriptorProto {
+		fieldDescriptor := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(number),
+			Type:   fieldType.Enum(),
+			Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}
+		if typeName != "" {
+			fieldDescriptor.TypeName = proto.String(typeName)
+		}
+		if repeated {
+			fieldDescriptor.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		}
+		return fieldDescriptor
+	}
+
+	fileDescriptor, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("remote.proto"),
+		Package: proto.String("prometheus"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("WriteRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("timeseries", 1, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".prometheus.TimeSeries", true),
+				},
+			},
+			{
+				Name: proto.String("TimeSeries"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("labels", 1, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".prometheus.Label", true),
+					field("samples", 2, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".prometheus.Sample", true),
+				},
+			},
+			{
+				Name: proto.String("Label"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", false),
+					field("value", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", false),
+				},
+			},
+			{
+				Name: proto.String("Sample"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("value", 1, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, "", false),
+					field("timestamp", 2, descriptorpb.FieldDescriptorProto_TYPE_INT64, "", false),
+				},
+			},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create write request descriptor: %v", err)
+	}
+
+	return fileDescriptor.Messages().ByName("WriteRequest")
+}
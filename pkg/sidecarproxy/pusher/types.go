@@ -0,0 +1,89 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pusher
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/v3io/sidecar-proxy/pkg/common"
+
+	"github.com/nuclio/errors"
+)
+
+type Mode string
+
+const (
+	DisabledMode    Mode = "none"
+	PushgatewayMode Mode = "pushgateway"
+	RemoteWriteMode Mode = "remote-write"
+)
+
+func ParseMode(modeStr string) (Mode, error) {
+	switch modeStr {
+	case "", string(DisabledMode):
+		return DisabledMode, nil
+	case string(PushgatewayMode):
+		return PushgatewayMode, nil
+	case string(RemoteWriteMode):
+		return RemoteWriteMode, nil
+	default:
+		return "", errors.Errorf("Unknown push mode: %s", modeStr)
+	}
+}
+
+type Configuration struct {
+	Mode Mode
+
+	// pushgateway base URL, or the full URL of the remote write endpoint
+	URL string
+
+	Interval time.Duration
+	Timeout  time.Duration
+
+	// job the pushed metrics are grouped by (pushgateway) or labeled with (remote write)
+	Job string
+}
+
+// Validate checks the settings needed to push are given, returning all problems found
+func (c *Configuration) Validate() error {
+	var validationErrors common.MultiError
+
+	switch c.Mode {
+	case "", DisabledMode:
+		return nil
+	case PushgatewayMode, RemoteWriteMode:
+	default:
+		validationErrors.Addf("Unknown push mode: %s", c.Mode)
+	}
+
+	if c.URL == "" {
+		validationErrors.Addf("Push URL must be set")
+	} else if parsedURL, err := url.Parse(c.URL); err != nil || parsedURL.Host == "" {
+		validationErrors.Addf("Invalid push URL: %q", c.URL)
+	}
+	if c.Interval <= 0 {
+		validationErrors.Addf("Push interval must be positive")
+	}
+
+	return validationErrors.ErrorOrNil()
+}
+
+// client pushes the registry's current state to the receiver
+type client interface {
+	push(ctx context.Context) error
+}
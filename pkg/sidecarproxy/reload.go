@@ -0,0 +1,141 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sidecarproxy
+
+import (
+	"github.com/v3io/sidecar-proxy/pkg/common"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/reloader"
+
+	"github.com/nuclio/errors"
+)
+
+// ApplyConfiguration applies a configuration to the running server. It's applied all or nothing - if a change fails,
+// the changes already made are rolled back
+func (s *Server) ApplyConfiguration(configuration reloader.Configuration) error {
+	if err := configuration.Validate(); err != nil {
+		return errors.Wrap(err, "Invalid configuration")
+	}
+	logLevel, _ := common.ParseLogLevel(configuration.LogLevel)
+	configuration.MetricNames = withDefaultMetricNames(configuration.MetricNames,
+		s.metricsHandlerConfiguration.SSHConnectionFilePath)
+
+	s.metricsHandlersLock.Lock()
+	defer s.metricsHandlersLock.Unlock()
+
+	if !s.metricsHandlersStarted {
+		return errors.New("Server hasn't started yet")
+	}
+
+	leveledLogger, canSetLogLevel := s.rootLogger.(levelSetter)
+	if !canSetLogLevel {
+		return errors.New("Logger doesn't support changing its level")
+	}
+
+	var rollbacks []func() error
+	rollBack := func(cause error) error {
+		for rollbackIndex := len(rollbacks) - 1; rollbackIndex >= 0; rollbackIndex-- {
+			if err := rollbacks[rollbackIndex](); err != nil {
+				s.logger.WarnWith("Failed to roll back configuration change", "err", err.Error())
+			}
+		}
+		return cause
+	}
+
+	// forward address - set on all handlers, including stopped ones, and on the configuration of ones created later
+	if configuration.ForwardAddress != s.forwardAddress {
+		previousForwardAddress := s.forwardAddress
+		for _, metricsHandler := range s.metricsHandlers {
+			if err := metricsHandler.SetForwardAddress(configuration.ForwardAddress); err != nil {
+				return rollBack(errors.Wrap(err, "Failed to set forward address"))
+			}
+			rollbackHandler := metricsHandler
+			rollbacks = append(rollbacks, func() error {
+				return rollbackHandler.SetForwardAddress(previousForwardAddress)
+			})
+		}
+		s.setForwardAddress(configuration.ForwardAddress)
+		rollbacks = append(rollbacks, func() error {
+			s.setForwardAddress(previousForwardAddress)
+			return nil
+		})
+	}
+
+	// poll intervals of handlers created from now on
+	previousPollIntervals := s.metricsHandlerConfiguration.PollIntervals
+	s.metricsHandlerConfiguration.PollIntervals = configuration.PollIntervals
+	rollbacks = append(rollbacks, func() error {
+		s.metricsHandlerConfiguration.PollIntervals = previousPollIntervals
+		return nil
+	})
+
+	// stop handlers that were disabled
+	for _, metricsHandler := range s.metricsHandlers {
+		metricName := metricsHandler.Name()
+		if !metricsHandler.IsRunning() || common.StringInSlice(string(metricName), configuration.MetricNames) {
+			continue
+		}
+		if err := s.stopMetricsHandlerLocked(metricName); err != nil {
+			return rollBack(errors.Wrapf(err, "Failed to stop metrics handler %s", metricName))
+		}
+		rollbacks = append(rollbacks, func() error {
+			return s.startMetricsHandlerLocked(metricName)
+		})
+	}
+
+	// start handlers that were enabled
+	for _, metricNameStr := range configuration.MetricNames {
+		metricName := metricshandler.MetricName(metricNameStr)
+		if metricsHandler, found := s.findMetricsHandler(metricName); found && metricsHandler.IsRunning() {
+			continue
+		}
+		if err := s.startMetricsHandlerLocked(metricName); err != nil {
+			return rollBack(errors.Wrapf(err, "Failed to start metrics handler %s", metricName))
+		}
+		rollbacks = append(rollbacks, func() error {
+			return s.stopMetricsHandlerLocked(metricName)
+		})
+	}
+
+	// poll intervals of existing handlers
+	for metricName, interval := range configuration.PollIntervals {
+		metricsHandler, found := s.findMetricsHandler(metricName)
+		if !found {
+			continue
+		}
+		previousInterval := metricsHandler.GetPollInterval()
+		if previousInterval == interval {
+			continue
+		}
+		if err := metricsHandler.SetPollInterval(interval); err != nil {
+			return rollBack(errors.Wrapf(err, "Failed to set poll interval of %s", metricName))
+		}
+		rollbacks = append(rollbacks, func() error {
+			return metricsHandler.SetPollInterval(previousInterval)
+		})
+	}
+
+	// can't fail, so it's changed last
+	leveledLogger.SetLevel(logLevel)
+
+	return nil
+}
+
+// setForwardAddress must be called with metricsHandlersLock held
+func (s *Server) setForwardAddress(forwardAddress string) {
+	s.forwardAddress = forwardAddress
+	s.metricsHandlerConfiguration.ForwardAddress = forwardAddress
+}
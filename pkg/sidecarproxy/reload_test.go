@@ -0,0 +1,141 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sidecarproxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/v3io/sidecar-proxy/pkg/common"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/reloader"
+
+	"github.com/nuclio/logger"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestApplyConfiguration(t *testing.T) {
+	upstream := newTestUpstream(t)
+	server := newStartedTestServer(t, Configuration{UpstreamMetricsURL: upstream.URL + "/metrics"})
+
+	// toggling upstream_metrics on, off and on again leaves /metrics gatherable, without stale families
+	for _, iteration := range []string{"enable", "disable", "re-enable"} {
+		configuration := reloader.Configuration{
+			ForwardAddress: "127.0.0.1:2",
+			LogLevel:       "debug",
+			PollIntervals:  map[metricshandler.MetricName]time.Duration{metricshandler.UpstreamMetricsMetricName: time.Hour},
+		}
+		if iteration != "disable" {
+			configuration.MetricNames = []string{string(metricshandler.UpstreamMetricsMetricName)}
+		}
+
+		if err := server.ApplyConfiguration(configuration); err != nil {
+			t.Fatalf("%s: failed to apply configuration: %v", iteration, err)
+		}
+
+		metricsHandler, found := server.getMetricsHandler(metricshandler.UpstreamMetricsMetricName)
+		if !found {
+			t.Fatalf("%s: handler isn't listed", iteration)
+		}
+		expectedNumOfMetrics := 0
+		if iteration != "disable" {
+			if !metricsHandler.IsRunning() {
+				t.Fatalf("%s: enabled handler isn't running", iteration)
+			}
+			if metricsHandler.GetPollInterval() != time.Hour {
+				t.Fatalf("%s: expected poll interval 1h, got %s", iteration, metricsHandler.GetPollInterval())
+			}
+			if err := metricsHandler.Probe(); err != nil {
+				t.Fatalf("%s: failed to scrape: %v", iteration, err)
+			}
+			expectedNumOfMetrics = 1
+		} else if metricsHandler.IsRunning() {
+			t.Fatalf("%s: disabled handler is running", iteration)
+		}
+
+		if numOfMetrics := gatherFamily(t, server.registry, "upstream_foo"); numOfMetrics != expectedNumOfMetrics {
+			t.Fatalf("%s: expected %d upstream_foo metrics, got %d", iteration, expectedNumOfMetrics, numOfMetrics)
+		}
+	}
+
+	if server.forwardAddress != "127.0.0.1:2" || server.metricsHandlerConfiguration.ForwardAddress != "127.0.0.1:2" {
+		t.Fatalf("Forward address wasn't changed: %s", server.forwardAddress)
+	}
+	if level := server.rootLogger.(levelSetter).GetLevel(); level != logger.LevelDebug {
+		t.Fatalf("Expected log level debug, got %s", common.LogLevelName(level))
+	}
+}
+
+func TestApplyConfigurationRollsBack(t *testing.T) {
+	upstream := newTestUpstream(t)
+	server := newStartedTestServer(t, Configuration{
+		MetricNames:        []string{string(metricshandler.UpstreamMetricsMetricName)},
+		UpstreamMetricsURL: upstream.URL + "/metrics",
+	})
+
+	// dask_cluster_busyness fails registering its metrics, after upstream_metrics was stopped
+	server.registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: string(metricshandler.DaskClusterBusynessMetricName),
+		Help: "Conflicting",
+	}))
+
+	err := server.ApplyConfiguration(reloader.Configuration{
+		ForwardAddress: "127.0.0.1:2",
+		LogLevel:       "debug",
+		MetricNames:    []string{string(metricshandler.DaskClusterBusynessMetricName)},
+	})
+	if err == nil {
+		t.Fatalf("Expected applying the configuration to fail")
+	}
+
+	if server.forwardAddress != "127.0.0.1:1" {
+		t.Fatalf("Forward address wasn't rolled back: %s", server.forwardAddress)
+	}
+	if level := server.rootLogger.(levelSetter).GetLevel(); level != logger.LevelInfo {
+		t.Fatalf("Log level changed to %s", common.LogLevelName(level))
+	}
+	if _, found := server.getMetricsHandler(metricshandler.DaskClusterBusynessMetricName); found {
+		t.Fatalf("Handler that failed to start is listed")
+	}
+
+	// the stopped handler was restarted, and its metrics are gathered as before
+	metricsHandler, found := server.getMetricsHandler(metricshandler.UpstreamMetricsMetricName)
+	if !found || !metricsHandler.IsRunning() {
+		t.Fatalf("Stopped handler wasn't restarted")
+	}
+	if err := metricsHandler.Probe(); err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if numOfMetrics := gatherFamily(t, server.registry, "upstream_foo"); numOfMetrics != 1 {
+		t.Fatalf("Expected a single upstream_foo metric, got %d", numOfMetrics)
+	}
+}
+
+// newStartedTestServer creates a test server and starts its metrics handlers, without listening
+func newStartedTestServer(t *testing.T, configuration Configuration) *Server {
+	server := newTestServer(t, configuration)
+	if err := server.startMetricsHandlers(); err != nil {
+		t.Fatalf("Failed to start metrics handlers: %v", err)
+	}
+	t.Cleanup(func() {
+		server.metricsHandlersLock.Lock()
+		defer server.metricsHandlersLock.Unlock()
+		for _, metricsHandler := range server.metricsHandlers {
+			metricsHandler.Stop() // nolint: errcheck
+		}
+	})
+	return server
+}
@@ -0,0 +1,179 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reloader
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+	"gopkg.in/yaml.v3"
+)
+
+// ApplyFunc applies a validated configuration, leaving the previous one in effect if it fails
+type ApplyFunc func(configuration Configuration) error
+
+// Reloader re-reads a configuration file (typically a mounted ConfigMap) when its contents change or when SIGHUP is
+// received, and applies it on top of the configuration given by flags
+type Reloader struct {
+	logger             logger.Logger
+	filePath           string
+	checkInterval      time.Duration
+	baseConfiguration  Configuration
+	apply              ApplyFunc
+	lastFileHash       []byte
+	lastFailedFileHash []byte
+	stopChan           chan struct{}
+	stopOnce           sync.Once
+	doneChan           chan struct{}
+}
+
+func NewReloader(logger logger.Logger,
+	filePath string,
+	checkInterval time.Duration,
+	baseConfiguration Configuration) (*Reloader, error) {
+
+	if filePath == "" {
+		return nil, errors.New("Configuration file path must be set")
+	}
+	if checkInterval <= 0 {
+		return nil, errors.New("Configuration check interval must be positive")
+	}
+
+	return &Reloader{
+		logger:            logger.GetChild("reloader"),
+		filePath:          filePath,
+		checkInterval:     checkInterval,
+		baseConfiguration: baseConfiguration,
+		stopChan:          make(chan struct{}),
+		doneChan:          make(chan struct{}),
+	}, nil
+}
+
+// Load reads the configuration file, returning it merged over the base configuration
+func (r *Reloader) Load() (Configuration, error) {
+	configuration, fileHash, err := r.load()
+	if err != nil {
+		return Configuration{}, err
+	}
+
+	r.lastFileHash = fileHash
+	return configuration, nil
+}
+
+// Start watches the configuration file, calling apply whenever it changes or SIGHUP is received
+func (r *Reloader) Start(apply ApplyFunc) {
+	r.apply = apply
+
+	r.logger.InfoWith("Watching configuration file", "path", r.filePath, "checkInterval", r.checkInterval)
+
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGHUP)
+
+	go func() {
+		defer close(r.doneChan)
+		defer signal.Stop(signalChan)
+
+		ticker := time.NewTicker(r.checkInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				r.reload(false)
+			case <-signalChan:
+				r.logger.Info("Received SIGHUP, reloading configuration")
+				r.reload(true)
+			case <-r.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+func (r *Reloader) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stopChan)
+	})
+	<-r.doneChan
+}
+
+// reload applies the configuration file if it changed since it was last read, or regardless if forced
+func (r *Reloader) reload(force bool) {
+	configuration, fileHash, err := r.load()
+	if err != nil {
+
+		// don't repeat the error every check while the same invalid file is mounted
+		if force || !bytes.Equal(fileHash, r.lastFileHash) {
+			r.logger.WarnWith("Failed to load configuration, keeping the current one",
+				"path", r.filePath,
+				"err", errors.GetErrorStackString(err, 10))
+		}
+		if fileHash != nil {
+			r.lastFileHash = fileHash
+		}
+		return
+	}
+
+	if !force && bytes.Equal(fileHash, r.lastFileHash) {
+		return
+	}
+
+	// the file is only recorded as read once it's applied, so failing to apply it (e.g. before the server has
+	// started) is retried every check
+	if err := r.apply(configuration); err != nil {
+		if force || !bytes.Equal(fileHash, r.lastFailedFileHash) {
+			r.logger.WarnWith("Failed to apply configuration, keeping the current one",
+				"path", r.filePath,
+				"err", errors.GetErrorStackString(err, 10))
+		}
+		r.lastFailedFileHash = fileHash
+		return
+	}
+	r.lastFileHash = fileHash
+	r.lastFailedFileHash = nil
+
+	r.logger.InfoWith("Applied configuration",
+		"path", r.filePath,
+		"forwardAddress", configuration.ForwardAddress,
+		"logLevel", configuration.LogLevel,
+		"metricNames", configuration.MetricNames)
+}
+
+// load returns the merged configuration and the hash of the file's contents (when it could be read)
+func (r *Reloader) load() (Configuration, []byte, error) {
+	fileContents, err := os.ReadFile(r.filePath)
+	if err != nil {
+		return Configuration{}, nil, errors.Wrap(err, "Failed to read configuration file")
+	}
+	fileHash := sha256.Sum256(fileContents)
+
+	var fileConfiguration Configuration
+	decoder := yaml.NewDecoder(bytes.NewReader(fileContents))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&fileConfiguration); err != nil && err != io.EOF {
+		return Configuration{}, fileHash[:], errors.Wrap(err, "Failed to parse configuration file")
+	}
+
+	return Merge(r.baseConfiguration, fileConfiguration), fileHash[:], nil
+}
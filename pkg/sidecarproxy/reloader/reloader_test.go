@@ -0,0 +1,128 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reloader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/loggerus"
+)
+
+func TestReload(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "configuration.yaml")
+	writeConfigurationFile(t, filePath, "logLevel: debug\n")
+
+	loggerInstance, err := loggerus.NewLoggerusForTests("test")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	reloader, err := NewReloader(loggerInstance, filePath, time.Hour, Configuration{
+		ForwardAddress: "127.0.0.1:8080",
+		LogLevel:       "info",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create reloader: %v", err)
+	}
+
+	configuration, err := reloader.Load()
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	if configuration.LogLevel != "debug" || configuration.ForwardAddress != "127.0.0.1:8080" {
+		t.Fatalf("Unexpected loaded configuration: %+v", configuration)
+	}
+
+	var appliedConfigurations []Configuration
+	var applyErr error
+	reloader.apply = func(configuration Configuration) error {
+		appliedConfigurations = append(appliedConfigurations, configuration)
+		return applyErr
+	}
+
+	for _, step := range []struct {
+		name                 string
+		fileContents         string
+		force                bool
+		applyErr             error
+		expectedNumOfApplies int
+	}{
+		{
+			name:                 "unchanged file is skipped",
+			expectedNumOfApplies: 0,
+		},
+		{
+			name:                 "forced reload applies an unchanged file",
+			force:                true,
+			expectedNumOfApplies: 1,
+		},
+		{
+			name:                 "changed file is applied",
+			fileContents:         "logLevel: warn\n",
+			expectedNumOfApplies: 2,
+		},
+		{
+			name:                 "applied file is skipped",
+			expectedNumOfApplies: 2,
+		},
+		{
+			name:                 "invalid file isn't applied",
+			fileContents:         "unknownField: 1\n",
+			expectedNumOfApplies: 2,
+		},
+		{
+			name:                 "file that failed to apply",
+			fileContents:         "logLevel: error\n",
+			applyErr:             errors.New("Server hasn't started yet"),
+			expectedNumOfApplies: 3,
+		},
+		{
+			name:                 "file that failed to apply is retried",
+			expectedNumOfApplies: 4,
+		},
+		{
+			name:                 "file that was finally applied is skipped",
+			expectedNumOfApplies: 4,
+		},
+	} {
+		t.Run(step.name, func(t *testing.T) {
+			if step.fileContents != "" {
+				writeConfigurationFile(t, filePath, step.fileContents)
+			}
+			applyErr = step.applyErr
+			reloader.reload(step.force)
+
+			if len(appliedConfigurations) != step.expectedNumOfApplies {
+				t.Fatalf("Expected %d applies, got %d", step.expectedNumOfApplies, len(appliedConfigurations))
+			}
+		})
+	}
+
+	if lastConfiguration := appliedConfigurations[len(appliedConfigurations)-1]; lastConfiguration.LogLevel != "error" {
+		t.Fatalf("Expected the last applied log level to be error, got %s", lastConfiguration.LogLevel)
+	}
+}
+
+func writeConfigurationFile(t *testing.T, filePath string, contents string) {
+	t.Helper()
+
+	if err := os.WriteFile(filePath, []byte(contents), 0600); err != nil {
+		t.Fatalf("Failed to write configuration file: %v", err)
+	}
+}
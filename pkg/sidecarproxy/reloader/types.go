@@ -0,0 +1,94 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reloader
+
+import (
+	"time"
+
+	"github.com/v3io/sidecar-proxy/pkg/common"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler/factory"
+)
+
+// Configuration holds the settings that can be changed without restarting. In a configuration file, settings that
+// are omitted keep the values given by flags
+type Configuration struct {
+	ForwardAddress string                                      `yaml:"forwardAddress,omitempty"`
+	LogLevel       string                                      `yaml:"logLevel,omitempty"`
+	MetricNames    []string                                    `yaml:"metricNames,omitempty"`
+	PollIntervals  map[metricshandler.MetricName]time.Duration `yaml:"pollIntervals,omitempty"`
+}
+
+// Merge returns the base configuration, overridden by the settings set in override
+func Merge(base Configuration, override Configuration) Configuration {
+	merged := base
+	if override.ForwardAddress != "" {
+		merged.ForwardAddress = override.ForwardAddress
+	}
+	if override.LogLevel != "" {
+		merged.LogLevel = override.LogLevel
+	}
+	if override.MetricNames != nil {
+		merged.MetricNames = append([]string{}, override.MetricNames...)
+	}
+
+	merged.PollIntervals = map[metricshandler.MetricName]time.Duration{}
+	for metricName, interval := range base.PollIntervals {
+		merged.PollIntervals[metricName] = interval
+	}
+	for metricName, interval := range override.PollIntervals {
+		merged.PollIntervals[metricName] = interval
+	}
+
+	// num_of_requests is the proxy itself, so it's always enabled
+	if !common.StringInSlice(string(metricshandler.NumOfRequestsMetricName), merged.MetricNames) {
+		merged.MetricNames = append(merged.MetricNames, string(metricshandler.NumOfRequestsMetricName))
+	}
+
+	return merged
+}
+
+// Validate checks the configuration can be applied, returning all problems found
+func (c *Configuration) Validate() error {
+	var validationErrors common.MultiError
+
+	if c.ForwardAddress == "" {
+		validationErrors.Addf("Forward address must be set")
+	} else {
+		validationErrors.AddWrap(common.ValidateAddress(c.ForwardAddress, true), "Invalid forward address")
+	}
+
+	if _, err := common.ParseLogLevel(c.LogLevel); err != nil {
+		validationErrors.AddWrap(err, "Invalid log level")
+	}
+
+	for _, metricName := range c.MetricNames {
+		if !factory.IsSupported(metricName) {
+			validationErrors.Addf("Unknown metric name: %s", metricName)
+		}
+	}
+
+	for metricName, interval := range c.PollIntervals {
+		if !factory.IsSupported(string(metricName)) {
+			validationErrors.Addf("Poll interval given for unknown metric name: %s", metricName)
+		}
+		if interval <= 0 {
+			validationErrors.Addf("Poll interval of %s must be positive", metricName)
+		}
+	}
+
+	return validationErrors.ErrorOrNil()
+}
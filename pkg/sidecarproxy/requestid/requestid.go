@@ -0,0 +1,81 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+// HeaderName is the header used to propagate the request ID to the upstream and back to the client
+const HeaderName = "X-Request-ID"
+
+// maxLength limits the size of request IDs accepted from clients
+const maxLength = 128
+
+// loggerus reads the request ID from the context using this exact (string) key
+const contextKey = "RequestID"
+
+// Ensure returns the request ID of the given request, generating one if the client didn't send a valid one.
+// The request's header is updated so that the ID is forwarded to the upstream
+func Ensure(req *http.Request) string {
+	requestID := req.Header.Get(HeaderName)
+	if !isValid(requestID) {
+		requestID = Generate()
+	}
+
+	req.Header.Set(HeaderName, requestID)
+	return requestID
+}
+
+// Generate returns a new random (version 4) UUID
+func Generate() string {
+	var uuid [16]byte
+
+	// crypto/rand.Read never returns an error on supported platforms
+	_, _ = rand.Read(uuid[:])
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+}
+
+// WithContext returns a copy of the context holding the request ID, so that *Ctx log functions will include it
+func WithContext(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, contextKey, requestID) // nolint: staticcheck
+}
+
+// FromContext returns the request ID held by the context, or an empty string if there is none
+func FromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(contextKey).(string)
+	return requestID
+}
+
+func isValid(requestID string) bool {
+	if requestID == "" || len(requestID) > maxLength {
+		return false
+	}
+
+	// only allow printable ascii so the value can be safely logged and forwarded
+	for _, char := range requestID {
+		if char < 0x21 || char > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -16,60 +16,291 @@
 package sidecarproxy
 
 import (
+	"context"
+	"fmt"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/v3io/sidecar-proxy/pkg/common"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/auth"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/errorpage"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/forwarded"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metriclabels"
 	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler"
 	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/metricshandler/factory"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/proxyprotocol"
+	"github.com/v3io/sidecar-proxy/pkg/sidecarproxy/pusher"
 
 	"github.com/nuclio/errors"
 	"github.com/nuclio/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 type Server struct {
-	logger          logger.Logger
-	listenAddress   string
-	forwardAddress  string
-	metricsHandlers []metricshandler.MetricsHandler
+	logger                      logger.Logger
+	rootLogger                  logger.Logger
+	listenAddress               string
+	forwardAddress              string
+	metricsHandlerConfiguration metricshandler.Configuration
+	metricsHandlersLock         sync.Mutex
+	metricsHandlers             []metricshandler.MetricsHandler
+	metricsHandlersStarted      bool
+	registry                    *prometheus.Registry
+	includeRuntimeMetrics       bool
+	serveMux                    *http.ServeMux
+	authFailuresCounter         *prometheus.CounterVec
+	upstreamAuthGate            *auth.Gate
+	metricsAuthGate             *auth.Gate
+	adminAuthGate               *auth.Gate
+	httpServer                  *http.Server
+	proxyProtocol               bool
+	trustedProxies              []*net.IPNet
+	adminServeMux               *http.ServeMux
+	debugEndpoints              bool
+	adminHTTPServer             *http.Server
+	pusher                      *pusher.Pusher
+	startTime                   time.Time
 }
 
-func NewServer(logger logger.Logger,
-	listenAddress string,
-	forwardAddress string,
-	namespace string,
-	serviceName string,
-	instanceName string,
-	metricNames []string) (*Server, error) {
+func NewServer(logger logger.Logger, configuration Configuration) (*Server, error) {
+	if err := configuration.Validate(); err != nil {
+		return nil, err
+	}
 
-	// num_of_requests metric must exist since its metric handler contains the logic that makes the server a proxy,
-	// without it requests won't be forwarded to the forwardAddress
-	if !common.StringInSlice(string(metricshandler.NumOfRequestsMetricName), metricNames) {
-		metricNames = append(metricNames, string(metricshandler.NumOfRequestsMetricName))
+	metricNames := withDefaultMetricNames(configuration.MetricNames, configuration.SSHConnectionFilePath)
+
+	metricLabels, err := metriclabels.NewLabelSet(configuration.MetricLabels,
+		configuration.Namespace,
+		configuration.ServiceName,
+		configuration.InstanceName)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create metric labels")
+	}
+
+	// each server has its own registry and mux, so several servers can live in one process
+	registry := prometheus.NewRegistry()
+	if configuration.IncludeRuntimeMetrics {
+		registry.MustRegister(collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	}
+	serveMux := http.NewServeMux()
+
+	errorPages, err := errorpage.NewPages(configuration.ErrorPages, configuration.ServiceName)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create error pages")
+	}
+
+	metricsHandlerConfiguration := metricshandler.Configuration{
+		ForwardAddress:              configuration.ForwardAddress,
+		ListenAddress:               configuration.ListenAddress,
+		Namespace:                   configuration.Namespace,
+		ServiceName:                 configuration.ServiceName,
+		InstanceName:                configuration.InstanceName,
+		MetricLabels:                metricLabels,
+		MetricNamespace:             configuration.MetricNamespace,
+		MetricSubsystem:             configuration.MetricSubsystem,
+		ServeMux:                    serveMux,
+		SSHConnectionFilePath:       configuration.SSHConnectionFilePath,
+		CodeServerHeartbeatFilePath: configuration.CodeServerHeartbeatFilePath,
+		RStudioSessionsDirPath:      configuration.RStudioSessionsDirPath,
+		RayDashboardAddress:         configuration.RayDashboardAddress,
+		DaskDashboardAddress:        configuration.DaskDashboardAddress,
+		UpstreamMetricsURL:          configuration.UpstreamMetricsURL,
+		UpstreamMetricsFilter:       configuration.UpstreamMetricsFilter,
+		UpstreamH2C:                 configuration.UpstreamH2C,
+		IgnoreRules:                 configuration.IgnoreRules,
+		HeaderRules:                 configuration.HeaderRules,
+		ErrorPages:                  errorPages,
+		TCPRoutes:                   configuration.TCPRoutes,
+		RequestTracker:              metricshandler.NewActivityTracker(),
+		ConnectionTracker:           metricshandler.NewActivityTracker(),
+		PollIntervals:               configuration.PollIntervals,
 	}
 
 	var metricsHandlers []metricshandler.MetricsHandler
 	for _, metricName := range metricNames {
-		metricsHandler, err := factory.Create(metricName, logger, forwardAddress, listenAddress, namespace, serviceName, instanceName)
+		metricsHandler, err := factory.Create(metricName, logger, metricsHandlerConfiguration)
 		if err != nil {
-			panic(err)
+			return nil, errors.Wrapf(err, "Failed to create metrics handler %s", metricName)
 		}
 		metricsHandlers = append(metricsHandlers, metricsHandler)
 	}
 
-	return &Server{
-		logger:          logger.GetChild("server"),
-		listenAddress:   listenAddress,
-		forwardAddress:  forwardAddress,
-		metricsHandlers: metricsHandlers,
-	}, nil
+	// requests to the upstream, to /metrics and to the admin listener are authenticated independently
+	authFailuresCounter := auth.NewFailuresCounter(configuration.MetricNamespace,
+		configuration.MetricSubsystem,
+		metricLabels)
+	upstreamAuthGate, err := auth.NewGate(logger,
+		configuration.UpstreamAuth,
+		"upstream",
+		authFailuresCounter,
+		metricLabels)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create upstream auth gate")
+	}
+	metricsAuthGate, err := auth.NewGate(logger,
+		configuration.MetricsAuth,
+		"metrics",
+		authFailuresCounter,
+		metricLabels)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create metrics auth gate")
+	}
+	adminAuthGate, err := auth.NewGate(logger,
+		configuration.AdminAuth,
+		"admin",
+		authFailuresCounter,
+		metricLabels)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create admin auth gate")
+	}
+
+	metricsPusher, err := pusher.NewPusher(logger, configuration.Pusher, registry, configuration.InstanceName)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create metrics pusher")
+	}
+
+	newServer := Server{
+		logger:                      logger.GetChild("server"),
+		rootLogger:                  logger,
+		listenAddress:               configuration.ListenAddress,
+		forwardAddress:              configuration.ForwardAddress,
+		metricsHandlerConfiguration: metricsHandlerConfiguration,
+		metricsHandlers:             metricsHandlers,
+		registry:                    registry,
+		includeRuntimeMetrics:       configuration.IncludeRuntimeMetrics,
+		debugEndpoints:              configuration.DebugEndpoints,
+		serveMux:                    serveMux,
+		authFailuresCounter:         authFailuresCounter,
+		upstreamAuthGate:            upstreamAuthGate,
+		metricsAuthGate:             metricsAuthGate,
+		adminAuthGate:               adminAuthGate,
+		pusher:                      metricsPusher,
+		proxyProtocol:               configuration.ProxyProtocol,
+		trustedProxies:              configuration.TrustedProxies,
+
+		// everything other than /metrics goes to the upstream and must pass the upstream's gate. the client's address
+		// is resolved (through trusted proxies) first, so that all of them see it
+		httpServer: &http.Server{
+			Addr: configuration.ListenAddress,
+			Handler: forwarded.NewResolver(configuration.TrustedProxies).Wrap(
+				upstreamAuthGate.Wrap(serveMux, "/metrics")),
+		},
+	}
+
+	// gRPC clients speak HTTP/2 without TLS, either by prior knowledge or by upgrading an HTTP/1 connection
+	if configuration.H2C {
+		newServer.httpServer.Handler = h2c.NewHandler(newServer.httpServer.Handler, &http2.Server{})
+	}
+
+	// admin endpoints are served on a listener of their own, so they're never exposed alongside the upstream
+	if configuration.AdminListenAddress != "" {
+		newServer.adminServeMux = http.NewServeMux()
+		newServer.adminHTTPServer = &http.Server{
+			Addr:    configuration.AdminListenAddress,
+			Handler: adminAuthGate.Wrap(newServer.adminServeMux),
+		}
+	}
+
+	return &newServer, nil
+}
+
+// withDefaultMetricNames adds the handlers that run regardless of the configured metric names. num_of_requests must
+// exist since its metric handler contains the logic that makes the server a proxy, without it requests won't be
+// forwarded to the forwardAddress. ssh_connection_active runs unless disabled with an empty SSH connection file path,
+// as open SSH connections counted as activity before it was split out of num_of_requests
+func withDefaultMetricNames(metricNames []string, sshConnectionFilePath string) []string {
+	metricNames = append([]string{}, metricNames...)
+	if !common.StringInSlice(string(metricshandler.NumOfRequestsMetricName), metricNames) {
+		metricNames = append(metricNames, string(metricshandler.NumOfRequestsMetricName))
+	}
+	if sshConnectionFilePath != "" &&
+		!common.StringInSlice(string(metricshandler.SSHConnectionActiveMetricName), metricNames) {
+		metricNames = append(metricNames, string(metricshandler.SSHConnectionActiveMetricName))
+	}
+	return metricNames
 }
 
 func (s *Server) Start() error {
+	s.startTime = time.Now()
+
+	if err := s.startMetricsHandlers(); err != nil {
+		return errors.Wrap(err, "Failed to start metrics handlers")
+	}
+	if err := s.registry.Register(s.authFailuresCounter); err != nil {
+		return errors.Wrap(err, "Failed registering auth failures metric")
+	}
+
+	s.logger.Info("Registering metrics endpoint")
+
+	// start server - metrics endpoint will be handled first and not be forwarded
+	s.serveMux.Handle("/metrics", s.metricsAuthGate.Wrap(s.logMetrics(s.createMetricsHandler())))
+
+	if s.pusher != nil {
+		s.pusher.Start()
+	}
+
+	adminErrChan := make(chan error, 1)
+	if s.adminHTTPServer != nil {
+		s.logger.InfoWith("Starting admin listener", "address", s.adminHTTPServer.Addr)
+		s.registerAdminRoutes()
+		go func() {
+			if err := s.adminHTTPServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				adminErrChan <- errors.Wrap(err, "Failed while listening to incoming admin requests")
+			}
+		}()
+	}
+
+	serverErrChan := make(chan error, 1)
+	go func() {
+		serverErrChan <- s.serve()
+	}()
+
+	select {
+	case err := <-serverErrChan:
+		if err != nil && err != http.ErrServerClosed {
+			return errors.Wrap(err, "Failed while listening to incoming requests")
+		}
+	case err := <-adminErrChan:
+		return err
+	}
+
+	return nil
+}
+
+// serve accepts requests on the listen address, reading the client's address from PROXY protocol headers if enabled
+func (s *Server) serve() error {
+	listener, err := net.Listen("tcp", s.listenAddress)
+	if err != nil {
+		return err
+	}
+
+	if s.proxyProtocol {
+		s.logger.InfoWith("Accepting PROXY protocol headers", "numOfTrustedProxies", len(s.trustedProxies))
+		listener = proxyprotocol.NewListener(s.logger.GetChild("proxyprotocol"),
+			listener,
+			s.trustedProxies,
+			proxyprotocol.DefaultHeaderTimeout)
+	}
+
+	return s.httpServer.Serve(listener)
+}
+
+func (s *Server) startMetricsHandlers() error {
+	s.metricsHandlersLock.Lock()
+	defer s.metricsHandlersLock.Unlock()
 
 	s.logger.Info("Registering metrics")
 	for _, metricsHandler := range s.metricsHandlers {
-		if err := metricsHandler.RegisterMetrics(); err != nil {
+		if err := metricsHandler.RegisterMetrics(s.registry); err != nil {
 			return errors.Wrap(err, "Failed registering metrics")
 		}
 	}
@@ -80,25 +311,93 @@ func (s *Server) Start() error {
 			return errors.Wrap(err, "Failed starting metrics handler")
 		}
 	}
+	s.metricsHandlersStarted = true
 
-	s.logger.Info("Registering metrics endpoint")
+	return nil
+}
 
-	// start server - metrics endpoint will be handled first and not be forwarded
-	http.Handle("/metrics", s.logMetrics(promhttp.Handler()))
+// Stop stops accepting requests, waits for in flight requests to complete and pushes the metrics one last time (if
+// pushing is enabled)
+func (s *Server) Stop(ctx context.Context) error {
+	s.logger.Info("Stopping server")
 
-	if err := http.ListenAndServe(s.listenAddress, nil); err != nil {
-		return errors.Wrap(err, "Failed while listening to incoming requests")
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		s.logger.WarnWith("Failed to gracefully shut down server", "err", err.Error())
+	}
+	if s.adminHTTPServer != nil {
+		if err := s.adminHTTPServer.Shutdown(ctx); err != nil {
+			s.logger.WarnWith("Failed to gracefully shut down admin server", "err", err.Error())
+		}
+	}
+
+	if s.pusher != nil {
+		if err := s.pusher.Stop(ctx); err != nil {
+			return errors.Wrap(err, "Failed to stop metrics pusher")
+		}
 	}
 
 	return nil
 }
 
+// Registry returns the registry holding the server's metrics
+func (s *Server) Registry() *prometheus.Registry {
+	return s.registry
+}
+
+func (s *Server) createMetricsHandler() http.Handler {
+	// OpenMetrics is served to scrapers that ask for it, along with the counters' creation time
+	metricsHandler := promhttp.HandlerFor(createdSamplesGatherer{s.registry}, promhttp.HandlerOpts{
+		ErrorLog:                            promhttpErrorLogger{logger: s.logger},
+		EnableOpenMetrics:                   true,
+		EnableOpenMetricsTextCreatedSamples: true,
+	})
+
+	// the metrics endpoint's own metrics (promhttp_*) are runtime metrics too
+	if !s.includeRuntimeMetrics {
+		return metricsHandler
+	}
+	return promhttp.InstrumentMetricHandler(s.registry, metricsHandler)
+}
+
 func (s *Server) logMetrics(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
 		s.logger.DebugWith("Received new metrics request, invoking handler",
-			"from", req.RemoteAddr,
+			"from", forwarded.ClientIP(req),
 			"uri", req.RequestURI,
 			"method", req.Method)
 		h.ServeHTTP(res, req) // call original
 	})
 }
+
+// createdSamplesGatherer drops the creation time of counters whose names don't end with "_total". OpenMetrics
+// only types those as counters, and a _created sample is invalid for the others
+type createdSamplesGatherer struct {
+	prometheus.Gatherer
+}
+
+func (g createdSamplesGatherer) Gather() ([]*dto.MetricFamily, error) {
+	metricFamilies, err := g.Gatherer.Gather()
+
+	for _, metricFamily := range metricFamilies {
+		if metricFamily.GetType() != dto.MetricType_COUNTER || strings.HasSuffix(metricFamily.GetName(), "_total") {
+			continue
+		}
+
+		for _, metric := range metricFamily.GetMetric() {
+			if metric.Counter != nil {
+				metric.Counter.CreatedTimestamp = nil
+			}
+		}
+	}
+
+	return metricFamilies, err
+}
+
+// promhttpErrorLogger adapts our logger to promhttp's error logger
+type promhttpErrorLogger struct {
+	logger logger.Logger
+}
+
+func (p promhttpErrorLogger) Println(v ...interface{}) {
+	p.logger.WarnWith("Failed serving metrics", "err", fmt.Sprint(v...))
+}
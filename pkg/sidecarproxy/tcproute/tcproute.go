@@ -0,0 +1,86 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tcproute
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/v3io/sidecar-proxy/pkg/common"
+
+	"github.com/nuclio/errors"
+)
+
+// Route forwards the connections accepted on a listen address to a forward address, as is
+type Route struct {
+	Name           string
+	ListenAddress  string
+	ForwardAddress string
+}
+
+// ParseRoute parses a route of the form "key=value;key=value", where keys are name, listen (host:port to listen
+// on) and forward (host:port to forward to)
+func ParseRoute(routeStr string, defaultName string) (Route, error) {
+	route := Route{Name: defaultName}
+
+	for _, part := range strings.Split(routeStr, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		key, value, found := strings.Cut(part, "=")
+		if !found || value == "" {
+			return Route{}, errors.Errorf("Route part must be in the form key=value: %s", part)
+		}
+
+		switch strings.TrimSpace(key) {
+		case "name":
+			route.Name = value
+		case "listen":
+			if err := common.ValidateAddress(value, false); err != nil {
+				return Route{}, errors.Wrap(err, "Invalid listen address")
+			}
+			route.ListenAddress = value
+		case "forward":
+			if err := common.ValidateAddress(value, true); err != nil {
+				return Route{}, errors.Wrap(err, "Invalid forward address")
+			}
+			route.ForwardAddress = value
+		default:
+			return Route{}, errors.Errorf("Unknown route part: %s", key)
+		}
+	}
+
+	if route.ListenAddress == "" || route.ForwardAddress == "" {
+		return Route{}, errors.Errorf("Route must have a listen and a forward address: %s", routeStr)
+	}
+
+	return route, nil
+}
+
+// ParseRoutes parses the given routes, naming unnamed routes by their position
+func ParseRoutes(routeStrs []string) ([]Route, error) {
+	var routes []Route
+	for routeIndex, routeStr := range routeStrs {
+		route, err := ParseRoute(routeStr, fmt.Sprintf("route-%d", routeIndex))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse route: %s", routeStr)
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
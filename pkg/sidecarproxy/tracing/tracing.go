@@ -0,0 +1,167 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/semconv/v1.17.0/httpconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/v3io/sidecar-proxy"
+
+type Configuration struct {
+
+	// host:port of an OTLP/HTTP collector. tracing is disabled when empty
+	Endpoint string
+
+	// URL path traces are sent to, defaults to /v1/traces
+	URLPath string
+
+	// send traces over plain http instead of https
+	Insecure bool
+
+	// fraction of root traces that are sampled. parent based, so traces started upstream keep their decision
+	SampleRatio float64
+}
+
+// Setup installs the global W3C trace context propagator and, if an endpoint is configured, a tracer provider
+// exporting spans via OTLP. The returned function flushes and shuts down the provider
+func Setup(logger logger.Logger,
+	configuration Configuration,
+	namespace string,
+	serviceName string,
+	instanceName string) (func(context.Context) error, error) {
+
+	// propagate trace context even when we don't export spans ourselves, so traces aren't broken by the sidecar
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{},
+		propagation.Baggage{}))
+
+	if configuration.Endpoint == "" {
+		logger.Debug("Tracing endpoint not configured, spans will not be exported")
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporterOptions := []otlptracehttp.Option{otlptracehttp.WithEndpoint(configuration.Endpoint)}
+	if configuration.URLPath != "" {
+		exporterOptions = append(exporterOptions, otlptracehttp.WithURLPath(configuration.URLPath))
+	}
+	if configuration.Insecure {
+		exporterOptions = append(exporterOptions, otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), exporterOptions...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create OTLP trace exporter")
+	}
+
+	tracerProviderResource, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName("sidecar-proxy"),
+		semconv.K8SNamespaceName(namespace),
+		attribute.String("service_name", serviceName),
+		attribute.String("instance_name", instanceName)))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create tracing resource")
+	}
+
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(tracerProviderResource),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(configuration.SampleRatio))))
+	otel.SetTracerProvider(tracerProvider)
+
+	logger.InfoWith("Tracing enabled",
+		"endpoint", configuration.Endpoint,
+		"sampleRatio", configuration.SampleRatio)
+
+	return tracerProvider.Shutdown, nil
+}
+
+// Tracer returns the tracer all sidecar spans are created with
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// StartServerSpan extracts the trace context sent by the client and starts a server span for the request. The
+// returned request carries the span in its context
+func StartServerSpan(req *http.Request, spanName string) (*http.Request, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+	ctx, span := Tracer().Start(ctx,
+		spanName,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(httpconv.ServerRequest("", req)...))
+
+	return req.WithContext(ctx), span
+}
+
+// Transport is an http.RoundTripper that creates a client span per request, injects the trace context into the
+// outgoing headers and records the response status and upstream timing on both the client span and its parent
+type Transport struct {
+	Base http.RoundTripper
+}
+
+func NewTransport(base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{Base: base}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	parentSpan := trace.SpanFromContext(req.Context())
+	ctx, span := Tracer().Start(req.Context(),
+		"upstream "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(httpconv.ClientRequest(req)...))
+	defer span.End()
+
+	// round trippers must not modify the given request
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	startTime := time.Now()
+	resp, err := t.Base.RoundTrip(req)
+	upstreamDuration := attribute.Int64("upstream.duration_ms", time.Since(startTime).Milliseconds())
+	span.SetAttributes(upstreamDuration)
+	parentSpan.SetAttributes(upstreamDuration)
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		parentSpan.SetStatus(codes.Error, err.Error())
+		return resp, err
+	}
+
+	span.SetAttributes(httpconv.ClientResponse(resp)...)
+	span.SetStatus(httpconv.ClientStatus(resp.StatusCode))
+	parentSpan.SetAttributes(semconv.HTTPStatusCode(resp.StatusCode))
+	parentSpan.SetStatus(httpconv.ServerStatus(resp.StatusCode))
+
+	return resp, nil
+}
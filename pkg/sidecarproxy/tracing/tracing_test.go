@@ -0,0 +1,150 @@
+// Copyright 2019 Iguazio
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const clientTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestProxiedRequestSpans(t *testing.T) {
+	spanRecorder := tracetest.NewSpanRecorder()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder))
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	var upstreamTraceParent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		upstreamTraceParent = req.Header.Get("traceparent")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer upstream.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "/some/path", nil)
+	req.Header.Set("traceparent", clientTraceParent)
+	req, serverSpan := StartServerSpan(req, "proxy")
+
+	upstreamReq, err := http.NewRequestWithContext(req.Context(), http.MethodGet, upstream.URL+"/some/path", nil)
+	if err != nil {
+		t.Fatalf("Failed to create upstream request: %v", err)
+	}
+	resp, err := NewTransport(nil).RoundTrip(upstreamReq)
+	if err != nil {
+		t.Fatalf("Failed to round trip: %v", err)
+	}
+	resp.Body.Close() // nolint: errcheck
+	serverSpan.End()
+
+	spans := spanRecorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	clientSpan, proxySpan := spans[0], spans[1]
+
+	if proxySpan.SpanKind() != trace.SpanKindServer || clientSpan.SpanKind() != trace.SpanKindClient {
+		t.Fatalf("Unexpected span kinds: %v, %v", proxySpan.SpanKind(), clientSpan.SpanKind())
+	}
+
+	// the server span continues the client's trace and the client span is its child
+	if proxySpan.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("Server span isn't a child of the client's span: %s", proxySpan.Parent().SpanID())
+	}
+	if clientSpan.Parent().SpanID() != proxySpan.SpanContext().SpanID() {
+		t.Fatalf("Client span isn't a child of the server span")
+	}
+	if clientSpan.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("Client span has an unexpected trace ID: %s", clientSpan.SpanContext().TraceID())
+	}
+
+	// the upstream sees the client span as its parent
+	expectedTraceParent := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + clientSpan.SpanContext().SpanID().String() + "-01"
+	if upstreamTraceParent != expectedTraceParent {
+		t.Fatalf("Expected upstream traceparent %q, got %q", expectedTraceParent, upstreamTraceParent)
+	}
+
+	// a 404 fails the client span but not the server span
+	if clientSpan.Status().Code != codes.Error {
+		t.Fatalf("Expected client span status error, got %v", clientSpan.Status().Code)
+	}
+	if proxySpan.Status().Code != codes.Unset {
+		t.Fatalf("Expected server span status unset, got %v", proxySpan.Status().Code)
+	}
+	requireAttribute(t, proxySpan, string(semconv.HTTPStatusCodeKey), "404")
+	requireAttribute(t, clientSpan, string(semconv.HTTPStatusCodeKey), "404")
+	requireAttribute(t, clientSpan, "upstream.duration_ms", "")
+	requireAttribute(t, proxySpan, "upstream.duration_ms", "")
+}
+
+func TestUnreachableUpstreamSpans(t *testing.T) {
+	spanRecorder := tracetest.NewSpanRecorder()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder))
+	otel.SetTracerProvider(tracerProvider)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	// grab a free address and close it so nothing is listening
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	upstream.Close()
+
+	req, serverSpan := StartServerSpan(httptest.NewRequest(http.MethodGet, "/", nil), "proxy")
+	upstreamReq, err := http.NewRequestWithContext(req.Context(), http.MethodGet, upstream.URL, nil)
+	if err != nil {
+		t.Fatalf("Failed to create upstream request: %v", err)
+	}
+	if _, err := NewTransport(nil).RoundTrip(upstreamReq); err == nil {
+		t.Fatalf("Expected round trip to a closed upstream to fail")
+	}
+	serverSpan.End()
+
+	spans := spanRecorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	for _, span := range spans {
+		if span.Status().Code != codes.Error {
+			t.Fatalf("Expected %s span status error, got %v", span.Name(), span.Status().Code)
+		}
+	}
+	if len(spans[0].Events()) != 1 || spans[0].Events()[0].Name != "exception" {
+		t.Fatalf("Expected the client span to record the error, got %v", spans[0].Events())
+	}
+}
+
+// requireAttribute fails unless span has the attribute. an empty value only checks the attribute is set
+func requireAttribute(t *testing.T, span sdktrace.ReadOnlySpan, key string, value string) {
+	t.Helper()
+
+	for _, attribute := range span.Attributes() {
+		if string(attribute.Key) == key {
+			if value != "" && attribute.Value.Emit() != value {
+				t.Fatalf("Expected %s attribute %s=%s, got %s", span.Name(), key, value, attribute.Value.Emit())
+			}
+			return
+		}
+	}
+	t.Fatalf("%s span is missing attribute %s", span.Name(), key)
+}